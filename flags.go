@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"local-clipboard/internal/client"
+	"local-clipboard/internal/config"
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/sensitive"
+	"local-clipboard/internal/server"
+)
+
+// configModes are the modes that read the config file, each from the section
+// of its name.
+var configModes = []string{"server", "client", "run"}
+
+// reloadableFlags are the settings SIGHUP applies to a running server or
+// client (see server.Config.Reload and client.Config.Reload).
+var reloadableFlags = map[string]bool{
+	"allow": true, "trusted-proxy": true,
+	"read-rate": true, "read-burst": true, "write-rate": true, "write-burst": true, "max-body": true, "max-body-route": true,
+	"max-entries": true, "max-age": true, "max-bytes": true,
+	"sensitive": true, "sensitive-ttl": true,
+	"interval": true, "tag": true,
+}
+
+// secretFlags are masked by "config show".
+var secretFlags = map[string]bool{"token": true}
+
+// newModeFlags returns a flag set with the flags of one of configModes.
+func newModeFlags(mode string) *flag.FlagSet {
+	fs := flag.NewFlagSet(mode, flag.ContinueOnError)
+	switch mode {
+	case "server":
+		newServerFlags(fs)
+	case "client":
+		newClientFlags(fs)
+	case "run":
+		newRunFlags(fs)
+	}
+	return fs
+}
+
+// parseFlags parses args into fs, filling the flags args leaves out from
+// LOCAL_CLIPBOARD_* variables and the config file, and rejects settings in the
+// file that no mode has.
+func parseFlags(fs *flag.FlagSet, args []string) (*config.Result, error) {
+	res, err := config.Parse(fs, args, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	modes := map[string]*flag.FlagSet{}
+	for _, mode := range configModes {
+		modes[mode] = newModeFlags(mode)
+	}
+	return res, res.File.Check(modes)
+}
+
+// reloadOnHangup re-reads the config file and the environment on every SIGHUP
+// until ctx is done. It parses the command line again into a fresh flag set
+// prepared by register, so flags keep precedence, then calls the function
+// register returned. Changed settings outside reloadableFlags are logged as
+// needing a restart.
+func reloadOnHangup(ctx context.Context, fs *flag.FlagSet, register func(*flag.FlagSet) func() error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		next := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+		apply := register(next)
+		_, err := parseFlags(next, os.Args[2:])
+		if err == nil {
+			err = apply()
+		}
+		if err != nil {
+			log.Printf("reload: %v; keeping the previous settings", err)
+			continue
+		}
+		var restart []string
+		next.VisitAll(func(f *flag.Flag) {
+			if old := fs.Lookup(f.Name); old != nil && !reloadableFlags[f.Name] && old.Value.String() != f.Value.String() {
+				restart = append(restart, f.Name)
+			}
+		})
+		if len(restart) > 0 {
+			sort.Strings(restart)
+			log.Printf("reload: restart to apply %s", strings.Join(restart, ", "))
+		}
+	}
+}
+
+// replacePending hands next to the mode reading ch without blocking the
+// SIGHUP loop: settings it has not taken yet are dropped, as only the newest
+// matter.
+func replacePending[T any](ch chan T, next T) {
+	for {
+		select {
+		case ch <- next:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
+
+// serverFlags are the flags of server mode.
+type serverFlags struct {
+	cfg         server.Config
+	noBuild     bool
+	withMetrics bool
+	retention   *history.Retention
+	sensitive   *sensitive.Action
+	logs        *requestLogOptions
+	limits      *server.Limits
+	access      *accessOptions
+}
+
+func newServerFlags(fs *flag.FlagSet) *serverFlags {
+	f := &serverFlags{}
+	c := &f.cfg
+	fs.StringVar(&c.Addr, "addr", ":8080", "listen address for the web server")
+	fs.StringVar(&c.DBPath, "db", "clipboard.db", "path to sqlite database")
+	fs.StringVar(&c.StaticDir, "static", "web/dist", "directory containing built Vue app (e.g. web/dist); empty = embedded fallback")
+	fs.BoolVar(&f.noBuild, "no-build", false, "skip automatic Vue build before starting")
+	fs.BoolVar(&c.TLS, "tls", false, "serve HTTPS with a self-signed certificate stored next to the database")
+	fs.BoolVar(&c.DisableAuth, "no-auth", false, "disable device pairing; anyone on the network can use the API")
+	fs.BoolVar(&c.TrustLoopback, "trust-loopback", true, "allow direct requests from 127.0.0.1/::1, not through a proxy, without a device token")
+	fs.BoolVar(&c.RequireE2E, "require-e2e", false, "reject text entries that are not end-to-end encrypted")
+	fs.BoolVar(&c.MDNS, "mdns", true, "advertise the server on the LAN over mDNS (for client -server auto)")
+	fs.DurationVar(&c.OfflineAfter, "offline-after", 2*time.Minute, "show clients as offline after this long without contact")
+	fs.StringVar(&c.BindInterface, "bind-interface", "", "listen only on the addresses of this network interface, e.g. wlan0 (-addr then gives just the port)")
+	f.retention = retentionFlags(fs)
+	fs.DurationVar(&c.PruneInterval, "prune-interval", time.Hour, "how often to enforce the retention limits")
+	f.sensitive = sensitiveFlag(fs, "what to do with text that looks like a secret")
+	fs.DurationVar(&c.SensitiveTTL, "sensitive-ttl", 10*time.Minute, "how long entries flagged as sensitive are kept")
+	fs.BoolVar(&f.withMetrics, "metrics", true, "serve Prometheus metrics on /metrics")
+	f.logs = requestLogFlags(fs)
+	f.limits = limitFlags(fs)
+	f.access = accessFlags(fs)
+	return f
+}
+
+// config returns the server settings the flags describe, without Metrics.
+func (f *serverFlags) config() server.Config {
+	c := f.cfg
+	c.Retention, c.Sensitive = *f.retention, *f.sensitive
+	c.PersistLogs, c.LogRetention, c.LogBodies = f.logs.persist, f.logs.retention, f.logs.bodies
+	c.Limits = *f.limits
+	c.Allow, c.TrustedProxies = f.access.allow.values, f.access.proxies.values
+	return c
+}
+
+// clientFlags are the flags of client mode.
+type clientFlags struct {
+	cfg              client.Config
+	passphraseFile   string
+	channelTokenFile string
+	sensitive        *sensitive.Action
+	tags             *listFlag
+}
+
+func newClientFlags(fs *flag.FlagSet) *clientFlags {
+	f := &clientFlags{}
+	c := &f.cfg
+	fs.StringVar(&c.ServerURL, "server", "http://127.0.0.1:8080", "base URL of clipboard server, or \"auto\" to find it over mDNS")
+	fs.DurationVar(&c.Interval, "interval", 1*time.Second, "poll interval for local clipboard")
+	fs.StringVar(&c.Source, "source", client.HostName(), "source label for this machine (also the device name when pairing)")
+	fs.StringVar(&c.Token, "token", "", "device token (default: the token saved for this server)")
+	fs.StringVar(&c.TokenFile, "token-file", client.DefaultTokenFile(), "file where paired device tokens are saved")
+	fs.StringVar(&c.PairCode, "pair", "", "pair this device using the code shown by the server, then run")
+	fs.StringVar(&c.Fingerprint, "fingerprint", "", "SHA-256 fingerprint of the server's TLS certificate to pin (printed by server -tls)")
+	fs.StringVar(&f.passphraseFile, "e2e-passphrase-file", "", "file holding the shared end-to-end encryption passphrase (or set "+passphraseEnv+")")
+	fs.StringVar(&c.Channel, "channel", "", "clipboard channel to sync (default: the server's default channel)")
+	fs.StringVar(&f.channelTokenFile, "channel-token-file", "", "file holding the token of a protected channel (or set "+channelTokenEnv+")")
+	fs.StringVar(&c.ClientIDFile, "client-id-file", client.DefaultClientIDFile(), "file holding this client's stable id for the server's device list")
+	f.sensitive = sensitiveFlag(fs, "what to do with copied text that looks like a secret before sending it")
+	f.tags = tagFlag(fs)
+	return f
+}
+
+// config returns the client settings the flags describe, reading the secret files.
+func (f *clientFlags) config() (client.Config, error) {
+	c := f.cfg
+	c.Sensitive, c.Tags = *f.sensitive, f.tags.values
+	var err error
+	if c.Passphrase, err = readSecret(f.passphraseFile, passphraseEnv); err != nil {
+		return c, err
+	}
+	c.ChannelToken, err = readSecret(f.channelTokenFile, channelTokenEnv)
+	return c, err
+}
+
+// runFlags are the flags of run mode, which runs a server and a client.
+type runFlags struct {
+	server         server.Config
+	client         client.Config
+	noBuild        bool
+	withMetrics    bool
+	passphraseFile string
+	retention      *history.Retention
+	sensitive      *sensitive.Action
+	tags           *listFlag
+	logs           *requestLogOptions
+	limits         *server.Limits
+	access         *accessOptions
+}
+
+func newRunFlags(fs *flag.FlagSet) *runFlags {
+	f := &runFlags{}
+	s, c := &f.server, &f.client
+	fs.StringVar(&s.Addr, "addr", ":8080", "listen address for the web server")
+	fs.StringVar(&s.DBPath, "db", "clipboard.db", "path to sqlite database")
+	fs.StringVar(&s.StaticDir, "static", "web/dist", "directory containing built Vue app; empty = embedded fallback")
+	fs.BoolVar(&f.noBuild, "no-build", false, "skip automatic Vue build before starting")
+	fs.DurationVar(&c.Interval, "interval", 1*time.Second, "poll interval for local clipboard")
+	fs.StringVar(&c.Source, "source", client.HostName(), "source label for this machine")
+	fs.BoolVar(&s.TLS, "tls", false, "serve HTTPS with a self-signed certificate stored next to the database")
+	fs.BoolVar(&s.DisableAuth, "no-auth", false, "disable device pairing; anyone on the network can use the API")
+	fs.StringVar(&f.passphraseFile, "e2e-passphrase-file", "", "file holding the shared end-to-end encryption passphrase (or set "+passphraseEnv+")")
+	fs.BoolVar(&s.MDNS, "mdns", true, "advertise the server on the LAN over mDNS (for client -server auto)")
+	fs.StringVar(&c.Channel, "channel", "", "clipboard channel the built-in client syncs")
+	f.retention = retentionFlags(fs)
+	f.sensitive = sensitiveFlag(fs, "what to do with text that looks like a secret")
+	f.tags = tagFlag(fs)
+	fs.BoolVar(&f.withMetrics, "metrics", true, "serve Prometheus metrics for the server and the built-in client on /metrics")
+	f.logs = requestLogFlags(fs)
+	f.limits = limitFlags(fs)
+	f.access = accessFlags(fs)
+	return f
+}
+
+// serverConfig returns the settings of the built-in server, without Metrics.
+func (f *runFlags) serverConfig() server.Config {
+	c := f.server
+	// The in-process client talks to the server over loopback, so loopback is always trusted here.
+	c.TrustLoopback = true
+	c.Retention, c.Sensitive = *f.retention, *f.sensitive
+	c.PersistLogs, c.LogRetention, c.LogBodies = f.logs.persist, f.logs.retention, f.logs.bodies
+	c.Limits = *f.limits
+	c.TrustedProxies = f.access.proxies.values
+	if allow := f.access.allow.values; len(allow) > 0 {
+		// The in-process client connects over loopback, so it must be allowed too.
+		c.Allow = append(append([]string(nil), allow...), server.AllowLoopback)
+	}
+	return c
+}
+
+// clientConfig returns the settings of the built-in client, without the
+// server URL and certificate fingerprint, which depend on the server.
+func (f *runFlags) clientConfig() (client.Config, error) {
+	c := f.client
+	c.Sensitive, c.Tags = *f.sensitive, f.tags.values
+	c.ChannelToken = os.Getenv(channelTokenEnv)
+	c.ClientIDFile = client.DefaultClientIDFile()
+	var err error
+	c.Passphrase, err = readSecret(f.passphraseFile, passphraseEnv)
+	return c, err
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"context"
+
+	"local-clipboard/internal/models"
+)
+
+type deviceKey struct{}
+
+// WithDevice returns a context carrying the authenticated device.
+func WithDevice(ctx context.Context, d models.Device) context.Context {
+	return context.WithValue(ctx, deviceKey{}, d)
+}
+
+// DeviceFromContext returns the authenticated device, if the request had one.
+func DeviceFromContext(ctx context.Context) (models.Device, bool) {
+	d, ok := ctx.Value(deviceKey{}).(models.Device)
+	return d, ok
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	maxPairFailures = 5
+	// pairLockout is how long pairing is refused after a code was replaced
+	// because of wrong guesses. It doubles with every such code, up to
+	// maxPairLockout, so guessing codes gets nowhere.
+	pairLockout    = time.Minute
+	maxPairLockout = time.Hour
+)
+
+// Pairing manages the short one-time code a new device exchanges for a token.
+// A code is valid until it is used, it expires, or too many wrong guesses were
+// made; in each case a fresh code is generated and reported through OnNew.
+// Wrong guesses also lock pairing for a while (see LockedFor).
+type Pairing struct {
+	// OnNew is called (with the lock held) whenever a new code is generated,
+	// e.g. to print it to the server log.
+	OnNew func(code string, expires time.Time)
+
+	mu          sync.Mutex
+	ttl         time.Duration
+	code        string
+	expires     time.Time
+	failures    int
+	lockouts    int       // Codes replaced because of wrong guesses since the last pairing
+	lockedUntil time.Time // Redeem fails until then
+}
+
+// NewPairing returns a Pairing whose codes are valid for ttl.
+func NewPairing(ttl time.Duration) *Pairing {
+	return &Pairing{ttl: ttl}
+}
+
+// Code returns the current code, generating one if none is valid.
+func (p *Pairing) Code() (string, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.code == "" || time.Now().After(p.expires) {
+		p.rotate()
+	}
+	return p.code, p.expires
+}
+
+// Rotate replaces the current code and returns the new one. It is asked for by
+// an already paired device, so it also lifts a lockout.
+func (p *Pairing) Rotate() (string, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lockouts, p.lockedUntil = 0, time.Time{}
+	p.rotate()
+	return p.code, p.expires
+}
+
+// LockedFor returns how long pairing stays locked after wrong guesses, or 0.
+func (p *Pairing) LockedFor() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return max(time.Until(p.lockedUntil), 0)
+}
+
+// Redeem reports whether code matches the current valid code. A successful
+// redeem consumes the code. While pairing is locked every code is rejected.
+func (p *Pairing) Redeem(code string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.code == "" || now.Before(p.lockedUntil) {
+		return false
+	}
+	if now.After(p.expires) {
+		p.rotate()
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(p.code)) == 1 {
+		p.lockouts = 0
+		p.rotate()
+		return true
+	}
+	p.failures++
+	if p.failures >= maxPairFailures {
+		p.lockedUntil = now.Add(min(pairLockout<<min(p.lockouts, 10), maxPairLockout))
+		p.lockouts++
+		p.rotate()
+	}
+	return false
+}
+
+func (p *Pairing) rotate() {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		// crypto/rand does not fail on supported platforms; never fall back to a guessable code.
+		panic(err)
+	}
+	p.code = fmt.Sprintf("%06d", n.Int64())
+	p.expires = time.Now().Add(p.ttl)
+	p.failures = 0
+	if p.OnNew != nil {
+		p.OnNew(p.code, p.expires)
+	}
+}
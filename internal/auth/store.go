@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// ErrNotFound is returned when revoking a device that does not exist.
+var ErrNotFound = errors.New("device not found")
+
+// Store persists paired devices in SQLite. Only a SHA-256 hash of each token is
+// stored; all devices are cached in memory so per-request lookups do not hit the database.
+type Store struct {
+	db     *sql.DB
+	mu     sync.RWMutex
+	byHash map[string]models.Device
+}
+
+// NewStore returns a Store backed by db. Call Init before use.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db, byHash: make(map[string]models.Device)}
+}
+
+// Init loads existing devices. The devices table is created by the history
+// database migrations.
+func (s *Store) Init() error {
+	rows, err := s.db.Query("SELECT id,name,token_hash,created_at FROM devices")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rows.Next() {
+		var (
+			d         models.Device
+			hash      string
+			createdAt string
+		)
+		if err := rows.Scan(&d.ID, &d.Name, &hash, &createdAt); err != nil {
+			return err
+		}
+		d.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		s.byHash[hash] = d
+	}
+	return rows.Err()
+}
+
+// Create registers a new device and returns it with its bearer token.
+// The token is only ever returned here.
+func (s *Store) Create(name string) (models.Device, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return models.Device{}, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	hash := hashToken(token)
+	now := time.Now().UTC()
+	res, err := s.db.Exec("INSERT INTO devices(name,token_hash,created_at) VALUES(?,?,?)", name, hash, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return models.Device{}, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.Device{}, "", err
+	}
+	d := models.Device{ID: id, Name: name, CreatedAt: now}
+	s.mu.Lock()
+	s.byHash[hash] = d
+	s.mu.Unlock()
+	return d, token, nil
+}
+
+// Lookup returns the device that owns token.
+func (s *Store) Lookup(token string) (models.Device, bool) {
+	if token == "" {
+		return models.Device{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.byHash[hashToken(token)]
+	return d, ok
+}
+
+// List returns all paired devices, oldest first.
+func (s *Store) List() []models.Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]models.Device, 0, len(s.byHash))
+	for _, d := range s.byHash {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Revoke deletes the device so its token stops working immediately.
+func (s *Store) Revoke(id int64) error {
+	res, err := s.db.Exec("DELETE FROM devices WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, d := range s.byHash {
+		if d.ID == id {
+			delete(s.byHash, hash)
+		}
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,145 @@
+// Package channels keeps the registry of named clipboard channels and their
+// optional access tokens.
+package channels
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// ErrExists is returned when creating a channel that is already registered or
+// already has history (the default channel always exists and cannot be
+// protected).
+var ErrExists = errors.New("channel already exists")
+
+// ErrInvalidName is returned for names that do not match ValidName.
+var ErrInvalidName = errors.New("invalid channel name: use 1-32 lowercase letters, digits, '-' or '_'")
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidName reports whether name can be used as a channel name (it appears in URL paths).
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+type record struct {
+	channel   models.Channel
+	tokenHash string // empty for unprotected channels
+}
+
+// Store persists registered channels in SQLite and caches them in memory.
+// Channels do not have to be registered to be used; registering one records
+// when it was created and optionally protects it with a token.
+type Store struct {
+	db     *sql.DB
+	mu     sync.RWMutex
+	byName map[string]record
+}
+
+// NewStore returns a Store backed by db. Call Init before use.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db, byName: make(map[string]record)}
+}
+
+// Init loads existing channels. The channels table is created by the history
+// database migrations.
+func (s *Store) Init() error {
+	rows, err := s.db.Query("SELECT name,token_hash,created_at FROM channels")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rows.Next() {
+		var (
+			r         record
+			createdAt string
+		)
+		if err := rows.Scan(&r.channel.Name, &r.tokenHash, &createdAt); err != nil {
+			return err
+		}
+		r.channel.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		r.channel.Protected = r.tokenHash != ""
+		s.byName[r.channel.Name] = r
+	}
+	return rows.Err()
+}
+
+// Create registers a channel. A non-empty token protects it: requests for the
+// channel must then present the token. Only its SHA-256 hash is stored.
+// A channel already in use, with entries in clipboard_history, cannot be
+// registered: that would let anyone lock its users out with a token of their own.
+func (s *Store) Create(name, token string) (models.Channel, error) {
+	if !ValidName(name) {
+		return models.Channel{}, ErrInvalidName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byName[name]; ok || name == models.DefaultChannel {
+		return models.Channel{}, ErrExists
+	}
+	r := record{channel: models.Channel{Name: name, Protected: token != "", CreatedAt: time.Now().UTC()}}
+	if token != "" {
+		r.tokenHash = hashToken(token)
+	}
+	res, err := s.db.Exec(`INSERT INTO channels(name,token_hash,created_at)
+		SELECT ?,?,? WHERE NOT EXISTS (SELECT 1 FROM clipboard_history WHERE channel=?)`,
+		name, r.tokenHash, r.channel.CreatedAt.Format(time.RFC3339Nano), name)
+	if err != nil {
+		return models.Channel{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.Channel{}, err
+	} else if n == 0 {
+		return models.Channel{}, ErrExists
+	}
+	s.byName[name] = r
+	return r.channel, nil
+}
+
+// Get returns the registered channel called name.
+func (s *Store) Get(name string) (models.Channel, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.byName[name]
+	return r.channel, ok
+}
+
+// Authorize reports whether token grants access to channel name. Unregistered
+// and unprotected channels accept any token.
+func (s *Store) Authorize(name, token string) bool {
+	s.mu.RLock()
+	r, ok := s.byName[name]
+	s.mu.RUnlock()
+	if !ok || r.tokenHash == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(r.tokenHash)) == 1
+}
+
+// List returns all registered channels sorted by name.
+func (s *Store) List() []models.Channel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]models.Channel, 0, len(s.byName))
+	for _, r := range s.byName {
+		out = append(out, r.channel)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,373 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"local-clipboard/internal/e2e"
+	"local-clipboard/internal/models"
+	"local-clipboard/internal/version"
+)
+
+// ErrUnauthorized is returned when the server rejects the device token (or none was set).
+var ErrUnauthorized = errors.New("unauthorized: pair this device with -pair <code>")
+
+// ErrChannelForbidden is returned when the channel is protected and the channel token is missing or wrong.
+var ErrChannelForbidden = errors.New("channel token required or wrong")
+
+// ErrRefused is returned when the server refuses to store text that looks like a secret.
+var ErrRefused = errors.New("server refused the text: it looks like a secret")
+
+// ErrTooLarge is returned when an entry is larger than the server accepts
+// (see the limits in /api/server-info).
+var ErrTooLarge = errors.New("entry is larger than the server accepts")
+
+// ErrBlobRejected is returned when the server does not accept a binary entry,
+// e.g. because it requires end-to-end encryption, which binary entries lack.
+var ErrBlobRejected = errors.New("server does not accept binary entries")
+
+// RateLimitedError is returned when the server answers 429 Too Many Requests.
+type RateLimitedError struct {
+	RetryAfter time.Duration // How long the server asks to wait before the next request
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited by the server; retry in %s", e.RetryAfter)
+}
+
+// ErrNoPassphrase is returned for an encrypted entry when the client has no E2E passphrase.
+var ErrNoPassphrase = errors.New("entry is end-to-end encrypted; set a passphrase to read it")
+
+// API is an HTTP client for the clipboard server.
+type API struct {
+	Token      string       // Device bearer token from pairing; empty if the server does not require one
+	HTTP       *http.Client // Defaults to http.DefaultClient
+	Passphrase string       // When set, text is encrypted before sending and decrypted after fetching
+	Tags       []string     // Tags added to every entry this client sends
+
+	Channel      string // Channel to read and write; empty uses the server's default channel
+	ChannelToken string // Token of a protected channel
+
+	ClientID   string // Stable id for the server's device registry (see LoadClientID)
+	ClientName string // Source label reported to the device registry
+	Backend    string // Clipboard tool in use, reported to the device registry
+
+	mu       sync.RWMutex
+	baseURL  string       // Server base URL without trailing slash; may change after rediscovery
+	failures atomic.Int32 // Consecutive requests that failed before reaching the server
+
+	boxMu sync.Mutex
+	box   *e2e.Box // Derived from Passphrase by e2eBox
+}
+
+// NewAPI returns an API for baseURL authenticating with token.
+func NewAPI(baseURL, token string) *API {
+	a := &API{Token: token, HTTP: http.DefaultClient}
+	a.SetBaseURL(baseURL)
+	return a
+}
+
+// BaseURL returns the server base URL requests are sent to.
+func (a *API) BaseURL() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.baseURL
+}
+
+// SetBaseURL points the API at a different server address; safe for concurrent use.
+func (a *API) SetBaseURL(baseURL string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// Failures reports how many requests in a row failed at the transport level
+// (connection refused, timeout, ...), i.e. without any answer from the server.
+func (a *API) Failures() int {
+	return int(a.failures.Load())
+}
+
+func (a *API) do(req *http.Request) (*http.Response, error) {
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+	if a.Channel != "" {
+		req.Header.Set("X-Clipboard-Channel", a.Channel)
+	}
+	if a.ChannelToken != "" {
+		req.Header.Set("X-Channel-Token", a.ChannelToken)
+	}
+	if a.ClientID != "" {
+		req.Header.Set("X-Client-ID", a.ClientID)
+		req.Header.Set("X-Client-Name", a.ClientName)
+		req.Header.Set("X-Client-Version", version.Version)
+		req.Header.Set("X-Clipboard-Backend", a.Backend)
+	}
+	resp, err := a.HTTP.Do(req)
+	if err != nil {
+		if req.Context().Err() == nil {
+			a.failures.Add(1)
+		}
+		return nil, err
+	}
+	a.failures.Store(0)
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		resp.Body.Close()
+		return nil, ErrUnauthorized
+	case http.StatusForbidden:
+		resp.Body.Close()
+		return nil, ErrChannelForbidden
+	case http.StatusRequestEntityTooLarge:
+		resp.Body.Close()
+		return nil, ErrTooLarge
+	case http.StatusTooManyRequests:
+		resp.Body.Close()
+		wait := time.Second
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			wait = time.Duration(secs) * time.Second
+		}
+		return nil, &RateLimitedError{RetryAfter: wait}
+	}
+	return resp, nil
+}
+
+func (a *API) get(path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, a.BaseURL()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return a.do(req)
+}
+
+func (a *API) post(path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, a.BaseURL()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return a.do(req)
+}
+
+// Pair exchanges a one-time pairing code for a device token and stores it in a.Token.
+func (a *API) Pair(code, name string) (models.Device, error) {
+	b, _ := json.Marshal(map[string]string{"code": code, "name": name})
+	resp, err := a.post("/api/pair", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return models.Device{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return models.Device{}, fmt.Errorf("pairing failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var out struct {
+		Token  string        `json:"token"`
+		Device models.Device `json:"device"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return models.Device{}, err
+	}
+	a.Token = out.Token
+	return out.Device, nil
+}
+
+// ServerInfo is the part of /api/server-info the client uses.
+type ServerInfo struct {
+	E2ESalt string `json:"e2e_salt"` // Empty on servers older than e2e format version 2
+}
+
+// ServerInfo fetches the server's settings.
+func (a *API) ServerInfo() (ServerInfo, error) {
+	resp, err := a.get("/api/server-info")
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ServerInfo{}, fmt.Errorf("status %s", resp.Status)
+	}
+	var out ServerInfo
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return ServerInfo{}, err
+	}
+	return out, nil
+}
+
+// e2eBox returns the box for a.Passphrase, deriving it with the server's salt
+// on first use.
+func (a *API) e2eBox() (*e2e.Box, error) {
+	a.boxMu.Lock()
+	defer a.boxMu.Unlock()
+	if a.box != nil {
+		return a.box, nil
+	}
+	info, err := a.ServerInfo()
+	if err != nil {
+		return nil, fmt.Errorf("e2e: fetch the server's salt: %w", err)
+	}
+	if info.E2ESalt == "" {
+		log.Printf("warning: the server does not advertise an end-to-end encryption salt; using the fixed salt of format version 1")
+	}
+	box, err := e2e.NewBox(a.Passphrase, info.E2ESalt)
+	if err != nil {
+		return nil, fmt.Errorf("e2e: %w", err)
+	}
+	log.Printf("end-to-end encryption on (key id %s)", box.KeyID())
+	a.box = box
+	return box, nil
+}
+
+// PostClipboard sends text to the server clipboard API, encrypted if a.Passphrase is set.
+// flagged marks text that contains a secret, so the server stores it as sensitive
+// with a short lifetime even when it cannot read the (encrypted) text.
+func (a *API) PostClipboard(text, source string, flagged bool) error {
+	payload := map[string]any{"text": text, "source": source}
+	if len(a.Tags) > 0 {
+		payload["tags"] = a.Tags
+	}
+	if flagged {
+		payload["sensitive"] = true
+	}
+	if a.Passphrase != "" {
+		box, err := a.e2eBox()
+		if err != nil {
+			return err
+		}
+		ct, nonce, err := box.Seal([]byte(text))
+		if err != nil {
+			return err
+		}
+		payload["text"], payload["nonce"], payload["key_id"] = ct, nonce, box.KeyID()
+	}
+	b, _ := json.Marshal(payload)
+	resp, err := a.post("/api/clipboard", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return ErrRefused
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// PostBlob uploads a binary clipboard payload (e.g. an image) and returns the stored entry.
+func (a *API) PostBlob(mimeType string, data []byte, source string) (models.ClipboardUpdate, error) {
+	q := url.Values{"source": {source}}
+	if len(a.Tags) > 0 {
+		q.Set("tags", strings.Join(a.Tags, ","))
+	}
+	resp, err := a.post("/api/clipboard/blob?"+q.Encode(), mimeType, bytes.NewReader(data))
+	if err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		return models.ClipboardUpdate{}, ErrBlobRejected
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return models.ClipboardUpdate{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var out models.ClipboardUpdate
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	return out, nil
+}
+
+// FetchBlob returns the binary payload of the entry with the given id.
+func (a *API) FetchBlob(id int64) ([]byte, error) {
+	resp, err := a.get("/api/clipboard/blob?id=" + strconv.FormatInt(id, 10))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Decrypt replaces the ciphertext of an end-to-end encrypted entry with its
+// plaintext. Unencrypted entries are left untouched.
+func (a *API) Decrypt(e *models.ClipboardUpdate) error {
+	if !e.Encrypted {
+		return nil
+	}
+	if a.Passphrase == "" {
+		return ErrNoPassphrase
+	}
+	box, err := a.e2eBox()
+	if err != nil {
+		return err
+	}
+	pt, err := box.Open(e.Text, e.Nonce, e.KeyID)
+	if err != nil {
+		return err
+	}
+	e.Text = string(pt)
+	e.Encrypted, e.Nonce, e.KeyID = false, "", ""
+	return nil
+}
+
+// FetchClipboard returns the current clipboard from the server, decrypted if needed.
+func (a *API) FetchClipboard() (models.ClipboardUpdate, error) {
+	resp, err := a.get("/api/clipboard")
+	if err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.ClipboardUpdate{}, fmt.Errorf("status %s", resp.Status)
+	}
+	var out models.ClipboardUpdate
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	if err := a.Decrypt(&out); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	return out, nil
+}
+
+// Devices returns the server's device registry with each client's online state.
+func (a *API) Devices() ([]models.DeviceStatus, error) {
+	resp, err := a.get("/api/devices")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	var out []models.DeviceStatus
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Ping reports to the server's device registry that this client is running.
+func (a *API) Ping() error {
+	resp, err := a.post("/api/devices/ping", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+func TestPostClipboardReportsServerLimits(t *testing.T) {
+	status := http.StatusTooManyRequests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	api := NewAPI(srv.URL, "")
+
+	var limited *RateLimitedError
+	if err := api.PostClipboard("hello", "test", false); !errors.As(err, &limited) || limited.RetryAfter != 3*time.Second {
+		t.Fatalf("429: %v", err)
+	}
+	status = http.StatusRequestEntityTooLarge
+	if err := api.PostClipboard("hello", "test", false); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("413: %v", err)
+	}
+}
+
+func TestPostClipboardEncryptsWithServerSalt(t *testing.T) {
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA"
+	var posted models.ClipboardUpdate
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/server-info":
+			json.NewEncoder(w).Encode(map[string]string{"e2e_salt": salt})
+		case "/api/clipboard":
+			json.NewDecoder(r.Body).Decode(&posted)
+			posted.Encrypted = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+	api := NewAPI(srv.URL, "")
+	api.Passphrase = "correct horse battery staple"
+
+	if err := api.PostClipboard("hello", "test", false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(posted.KeyID, "v2."+salt+".") || posted.Text == "hello" {
+		t.Fatalf("posted %+v, want text sealed with the server's salt", posted)
+	}
+	if err := api.Decrypt(&posted); err != nil || posted.Text != "hello" {
+		t.Fatalf("decrypt: %q %v", posted.Text, err)
+	}
+}
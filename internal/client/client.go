@@ -1,17 +1,21 @@
 package client
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"local-clipboard/internal/clipboard"
+	"local-clipboard/internal/metrics"
 	"local-clipboard/internal/models"
+	"local-clipboard/internal/sensitive"
 )
 
 // Config holds client options.
@@ -19,76 +23,370 @@ type Config struct {
 	ServerURL string
 	Interval  time.Duration
 	Source    string
+	Token     string // Device token; when empty it is loaded from TokenFile
+	TokenFile string // Where paired tokens are persisted (see DefaultTokenFile); empty disables persistence
+	PairCode  string // One-time pairing code; when set, pairs before starting and saves the token
+
+	Fingerprint string // SHA-256 fingerprint of the server's self-signed certificate to pin (https only)
+	Passphrase  string // Shared end-to-end encryption passphrase; empty sends plaintext
+
+	Channel      string // Channel to sync; empty uses the server's default channel
+	ChannelToken string // Token for a protected channel
+
+	ClientIDFile string // Where the stable client id is kept (see DefaultClientIDFile)
+
+	Sensitive sensitive.Action // What to do with copied text that looks like a secret; zero means off (the -sensitive flag defaults to expire)
+	Tags      []string         // Tags added to every entry this client sends
+
+	Metrics *metrics.Registry // Registry for client metrics ("run" mode shares the server's); nil disables them
+
+	Reload <-chan Config // New settings to apply while running: Interval, Sensitive and Tags; others need a restart
+}
+
+const maxReconnectDelay = 30 * time.Second
+
+// pingInterval is how often a client without an event stream tells the server it is still running.
+const pingInterval = 30 * time.Second
+
+// imageType is the MIME type used to sync images with the clipboard tools.
+const imageType = "image/png"
+
+// lastSent tracks the content most recently synced in either direction (the text
+// itself, or blobKey of a binary payload), so the push loop and the remote stream
+// do not echo each other's writes.
+type lastSent struct {
+	mu   sync.Mutex
+	text string
+}
+
+func (l *lastSent) get() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.text
+}
+
+func (l *lastSent) set(text string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.text = text
 }
 
-// Run runs the clipboard client: poll local clipboard, push to server, optionally pull remote.
+// Run runs the clipboard client until ctx is done: poll local clipboard and push to server, and
+// (if a write command exists) follow the server event stream to pull remote changes.
 // On Linux, if no clipboard tool is found, attempts to install wl-clipboard or xclip (may prompt for sudo).
-func Run(cfg Config) {
+// On shutdown it pushes anything copied since the last poll before returning nil.
+func Run(ctx context.Context, cfg Config) error {
 	localRead, localWrite, err := clipboard.EnsureDetect()
 	if err != nil {
-		log.Fatalf("clipboard command setup failed: %v", err)
+		return fmt.Errorf("clipboard command setup failed: %w", err)
 	}
 	if localWrite == nil {
 		log.Printf("note: no clipboard write command found; this client will only push local copy events")
 	}
 
-	baseURL := strings.TrimRight(cfg.ServerURL, "/")
-	var lastSent string
+	api, err := connect(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("client setup failed: %w", err)
+	}
+	if api.ClientID, err = LoadClientID(cfg.ClientIDFile); err != nil {
+		return fmt.Errorf("client id: %w", err)
+	}
+	api.ClientName, api.Backend = cfg.Source, localRead.Name
+	m := newClientMetrics(cfg.Metrics)
+	p := &pusher{api: api, cfg: cfg, read: localRead, last: &lastSent{}, m: m}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if localWrite != nil {
+			pullRemote(ctx, api, cfg, localWrite, p.last, m)
+		} else {
+			pingLoop(ctx, api)
+		}
+	}()
+	for p.wait(ctx, cfg.Reload) {
+		p.push()
+	}
+	p.push()
+	return nil
+}
+
+// wait sleeps for the push interval, applying settings from reload meanwhile,
+// and reports whether ctx is still live afterwards.
+func (p *pusher) wait(ctx context.Context, reload <-chan Config) bool {
+	t := time.NewTimer(p.cfg.Interval)
+	defer t.Stop()
 	for {
-		text, err := clipboard.Read(localRead)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-t.C:
+			return true
+		case next := <-reload:
+			p.cfg.Interval, p.cfg.Sensitive, p.cfg.Tags = next.Interval, next.Sensitive, next.Tags
+			// Only the pusher sends entries, so it can change the tags they get.
+			p.api.Tags = next.Tags
+			log.Printf("reloaded settings: interval %s, sensitive %s, tags %q", next.Interval, next.Sensitive, next.Tags)
+		}
+	}
+}
+
+// pusher sends local clipboard changes to the server.
+type pusher struct {
+	api        *API
+	cfg        Config
+	read       clipboard.Cmd
+	last       *lastSent
+	m          clientMetrics
+	warnedAuth bool
+	retryAt    time.Time // Set when the server rate limits pushes; nothing is sent before it
+}
+
+// push reads the local clipboard once and sends it unless it was the last thing synced.
+func (p *pusher) push() {
+	if time.Now().Before(p.retryAt) {
+		return
+	}
+	if types, err := clipboard.Types(p.read); err == nil && !clipboard.HasText(types) && hasType(types, imageType) {
+		p.backoff(pushImage(p.api, p.cfg, p.read, p.last, p.m))
+		return
+	}
+	text, err := clipboard.Read(p.read)
+	if err != nil {
+		return
+	}
+	text = strings.TrimSpace(text)
+	if text == "" || text == p.last.get() {
+		return
+	}
+	verdict := p.cfg.Sensitive.Apply(text)
+	if verdict.Refuse {
+		log.Printf("not syncing copied text: it looks like a secret (%s)", strings.Join(sensitive.Names(verdict.Findings), ", "))
+		p.last.set(text)
+		return
+	}
+	start := time.Now()
+	err = p.api.PostClipboard(verdict.Text, p.cfg.Source, verdict.Sensitive)
+	p.m.pushed(err, errors.Is(err, ErrRefused), start)
+	if err == nil || errors.Is(err, ErrRefused) || errors.Is(err, ErrTooLarge) {
+		// Remember the original text: a masked copy must not be synced back over it.
+		p.last.set(text)
+	} else if (errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrChannelForbidden)) && !p.warnedAuth {
+		log.Printf("push rejected: %v", err)
+		p.warnedAuth = true
+	}
+	if errors.Is(err, ErrRefused) || errors.Is(err, ErrTooLarge) {
+		log.Printf("push rejected: %v", err)
+	}
+	p.backoff(err)
+}
+
+// backoff holds pushes back for as long as a rate limiting server asks.
+func (p *pusher) backoff(err error) {
+	var limited *RateLimitedError
+	if errors.As(err, &limited) {
+		log.Printf("push deferred: %v", err)
+		p.retryAt = time.Now().Add(limited.RetryAfter)
+	}
+}
+
+// sleep waits for d and reports whether ctx is still live afterwards.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// connect builds the API client: it pairs with cfg.PairCode if given (saving the
+// token to cfg.TokenFile), otherwise uses cfg.Token or the token saved for this server.
+// With ServerURL set to AutoServer it first finds the server over mDNS and keeps
+// following it if its address changes until ctx is done.
+func connect(ctx context.Context, cfg Config) (*API, error) {
+	serverURL, tokenKey, instance := cfg.ServerURL, cfg.ServerURL, ""
+	if cfg.ServerURL == AutoServer {
+		svc, err := discoverServer(ctx, cfg.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		serverURL, instance = svc.URL(), svc.Instance
+		// Tokens are saved per server instance so they survive address changes.
+		tokenKey = "mdns:" + svc.Instance
+		log.Printf("discovered %q at %s (version %s)", svc.Instance, serverURL, svc.TXT["version"])
+		if cfg.Fingerprint == "" && svc.TXT["fp"] != "" {
+			cfg.Fingerprint = svc.TXT["fp"]
+			log.Printf("warning: pinning the advertised certificate %s; pass -fingerprint to verify it", cfg.Fingerprint)
+		}
+	}
+	api := NewAPI(serverURL, cfg.Token)
+	api.Channel, api.ChannelToken = cfg.Channel, cfg.ChannelToken
+	api.Tags = cfg.Tags
+	if cfg.Fingerprint != "" {
+		hc, err := PinnedHTTPClient(cfg.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		api.HTTP = hc
+	}
+	if instance != "" {
+		go rediscover(ctx, api, instance, cfg.Fingerprint)
+	}
+	api.Passphrase = cfg.Passphrase
+	if cfg.PairCode != "" {
+		device, err := api.Pair(cfg.PairCode, cfg.Source)
 		if err != nil {
-			time.Sleep(cfg.Interval)
-			continue
+			return nil, err
 		}
-		text = strings.TrimSpace(text)
-		if text != "" && text != lastSent {
-			if err := PostClipboard(baseURL, text, cfg.Source); err == nil {
-				lastSent = text
+		log.Printf("paired as %q (device id %d)", device.Name, device.ID)
+		if cfg.TokenFile != "" {
+			if err := SaveToken(cfg.TokenFile, tokenKey, api.Token); err != nil {
+				return nil, fmt.Errorf("save token: %w", err)
 			}
+			log.Printf("token saved to %s", cfg.TokenFile)
 		}
+		return api, nil
+	}
+	if api.Token == "" {
+		token, err := LoadToken(cfg.TokenFile, tokenKey)
+		if err != nil {
+			return nil, fmt.Errorf("load token: %w", err)
+		}
+		api.Token = token
+	}
+	return api, nil
+}
 
-		if localWrite != nil {
-			remote, err := FetchClipboard(baseURL)
-			if err == nil && remote.Text != "" && remote.Source != cfg.Source && remote.Text != text {
-				if err := clipboard.Write(localWrite, remote.Text); err == nil {
-					lastSent = remote.Text
+// pushImage sends the clipboard image to the server unless it was the last thing synced.
+func pushImage(api *API, cfg Config, read clipboard.Cmd, last *lastSent, m clientMetrics) error {
+	data, err := clipboard.ReadType(read, imageType)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	key := blobKey(data)
+	if key == last.get() {
+		return nil
+	}
+	start := time.Now()
+	_, err = api.PostBlob(imageType, data, cfg.Source)
+	m.pushed(err, false, start)
+	if err == nil || errors.Is(err, ErrTooLarge) || errors.Is(err, ErrBlobRejected) {
+		last.set(key)
+	}
+	if errors.Is(err, ErrTooLarge) || errors.Is(err, ErrBlobRejected) {
+		log.Printf("image not synced: %v", err)
+	}
+	return err
+}
+
+func hasType(types []string, want string) bool {
+	for _, t := range types {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+func blobKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// pullRemote follows /api/events and writes clipboard changes from other sources
+// to the local clipboard. It reconnects with Last-Event-ID and exponential backoff,
+// and falls back to polling FetchClipboard if the server has no event stream.
+// It returns when ctx is done.
+func pullRemote(ctx context.Context, api *API, cfg Config, write *clipboard.Cmd, last *lastSent, m clientMetrics) {
+	apply := func(remote models.ClipboardUpdate) {
+		if remote.Source == cfg.Source {
+			return
+		}
+		if remote.IsBlob() {
+			data, err := api.FetchBlob(remote.ID)
+			if err != nil {
+				return
+			}
+			key := blobKey(data)
+			if key == last.get() {
+				return
+			}
+			if err := clipboard.WriteType(write, remote.MimeType, data); err == nil {
+				last.set(key)
+				m.pulls.Inc("blob")
+			}
+			return
+		}
+		if remote.Text == "" || remote.Text == last.get() {
+			return
+		}
+		if err := clipboard.Write(write, remote.Text); err == nil {
+			last.set(remote.Text)
+			m.pulls.Inc("text")
+		}
+	}
+
+	var lastID int64
+	delay := time.Second
+	for {
+		id, err := api.StreamEvents(ctx, lastID, func(ev models.Event) {
+			if ev.Type == models.EventNew {
+				apply(ev.Entry)
+			}
+		})
+		if errors.Is(err, ErrEventsUnsupported) {
+			log.Printf("server has no event stream; polling every %s", cfg.Interval)
+			for sleep(ctx, cfg.Interval) {
+				if remote, err := api.FetchClipboard(); err == nil {
+					apply(remote)
 				}
 			}
+			return
+		}
+		if id != lastID {
+			// Any new event, even one with a lower id from a restarted
+			// server, means the stream worked.
+			lastID = id
+			delay = time.Second
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("event stream: %v; reconnecting in %s", err, delay)
+		}
+		if !sleep(ctx, delay) {
+			return
+		}
+		m.reconnects.Inc()
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
 		}
-		time.Sleep(cfg.Interval)
 	}
 }
 
-// PostClipboard sends text to the server clipboard API.
-func PostClipboard(baseURL, text, source string) error {
-	payload := map[string]string{"text": text, "source": source}
-	b, _ := json.Marshal(payload)
-	resp, err := http.Post(baseURL+"/api/clipboard", "application/json", bytes.NewReader(b))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("unexpected status %s", resp.Status)
+// pingLoop keeps a push-only client (which holds no event stream) marked online until ctx is done.
+func pingLoop(ctx context.Context, api *API) {
+	for {
+		_ = api.Ping()
+		if !sleep(ctx, pingInterval) {
+			return
+		}
 	}
-	return nil
 }
 
-// FetchClipboard returns the current clipboard from the server.
-func FetchClipboard(baseURL string) (models.ClipboardUpdate, error) {
-	resp, err := http.Get(baseURL + "/api/clipboard")
+// ListDevices connects like Run (discovery, pinning, saved token) and returns
+// the server's device registry.
+func ListDevices(ctx context.Context, cfg Config) ([]models.DeviceStatus, error) {
+	api, err := connect(ctx, cfg)
 	if err != nil {
-		return models.ClipboardUpdate{}, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return models.ClipboardUpdate{}, fmt.Errorf("status %s", resp.Status)
-	}
-	var out models.ClipboardUpdate
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return models.ClipboardUpdate{}, err
+		return nil, err
 	}
-	return out, nil
+	return api.Devices()
 }
 
 // HostName returns the machine hostname for use as source, or "linux-client" if unavailable.
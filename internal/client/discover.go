@@ -0,0 +1,104 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"time"
+
+	"local-clipboard/internal/discovery"
+)
+
+// AutoServer as Config.ServerURL makes the client find the server over mDNS.
+const AutoServer = "auto"
+
+const (
+	browseWait        = 2 * time.Second
+	rediscoverEvery   = 10 * time.Second
+	rediscoverAfter   = 3 // consecutive transport failures before browsing again
+	discoverRetryWait = 5 * time.Second
+)
+
+// Discover browses the LAN for clipboard servers for up to wait.
+func Discover(ctx context.Context, wait time.Duration) ([]discovery.Service, error) {
+	return discovery.Browse(ctx, wait, discovery.Options{})
+}
+
+// pickService chooses the server to use: the one named instance if it is still
+// visible, else the one whose certificate matches fingerprint, else the first.
+// With neither constraint set, the first server found wins.
+func pickService(services []discovery.Service, instance, fingerprint string) (discovery.Service, bool) {
+	for _, s := range services {
+		if instance != "" && s.Instance == instance && s.URL() != "" {
+			return s, true
+		}
+	}
+	for _, s := range services {
+		if fingerprint != "" && sameFingerprint(s.TXT["fp"], fingerprint) && s.URL() != "" {
+			return s, true
+		}
+	}
+	if instance != "" || fingerprint != "" {
+		return discovery.Service{}, false
+	}
+	for _, s := range services {
+		if s.URL() != "" {
+			return s, true
+		}
+	}
+	return discovery.Service{}, false
+}
+
+// discoverServer blocks until a matching server answers or ctx is done,
+// logging while it waits.
+func discoverServer(ctx context.Context, fingerprint string) (discovery.Service, error) {
+	logged := false
+	for {
+		services, err := Discover(ctx, browseWait)
+		if err != nil {
+			log.Printf("mdns browse failed: %v", err)
+		}
+		if svc, ok := pickService(services, "", fingerprint); ok {
+			if len(services) > 1 {
+				log.Printf("found %d servers; using %q (pass -server <url> or -fingerprint to choose)", len(services), svc.Instance)
+			}
+			return svc, nil
+		}
+		if !logged {
+			log.Printf("looking for a clipboard server on the LAN (%s)...", discovery.ServiceType)
+			logged = true
+		}
+		if !sleep(ctx, discoverRetryWait) {
+			return discovery.Service{}, ctx.Err()
+		}
+	}
+}
+
+// rediscover watches api for repeated connection failures and, when they
+// happen, browses again and follows the server to its new address. It returns when ctx is done.
+func rediscover(ctx context.Context, api *API, instance, fingerprint string) {
+	for sleep(ctx, rediscoverEvery) {
+		if api.Failures() < rediscoverAfter {
+			continue
+		}
+		services, err := Discover(ctx, browseWait)
+		if err != nil {
+			continue
+		}
+		svc, ok := pickService(services, instance, fingerprint)
+		if !ok || svc.URL() == api.BaseURL() {
+			continue
+		}
+		log.Printf("server %q moved to %s", svc.Instance, svc.URL())
+		api.SetBaseURL(svc.URL())
+	}
+}
+
+func sameFingerprint(a, b string) bool {
+	x, err := parseFingerprint(a)
+	if err != nil {
+		return false
+	}
+	y, err := parseFingerprint(b)
+	return err == nil && bytes.Equal(x, y)
+}
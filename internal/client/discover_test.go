@@ -0,0 +1,28 @@
+package client
+
+import (
+	"net"
+	"testing"
+
+	"local-clipboard/internal/discovery"
+)
+
+func TestPickService(t *testing.T) {
+	fp := "AA:" + "BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99"
+	services := []discovery.Service{
+		{Instance: "a", Port: 8080, IPs: []net.IP{net.IPv4(10, 0, 0, 1)}, TXT: map[string]string{}},
+		{Instance: "b", Port: 8443, IPs: []net.IP{net.IPv4(10, 0, 0, 2)}, TXT: map[string]string{"tls": "1", "fp": fp}},
+	}
+	if s, ok := pickService(services, "", ""); !ok || s.Instance != "a" {
+		t.Fatalf("no constraints: got %q, %v", s.Instance, ok)
+	}
+	if s, ok := pickService(services, "", "aabbccddeeff00112233445566778899aabbccddeeff00112233445566778899"); !ok || s.Instance != "b" {
+		t.Fatalf("by fingerprint: got %q, %v", s.Instance, ok)
+	}
+	if s, ok := pickService(services, "b", ""); !ok || s.URL() != "https://10.0.0.2:8443" {
+		t.Fatalf("by instance: got %q, %v", s.URL(), ok)
+	}
+	if _, ok := pickService(services, "gone", ""); ok {
+		t.Fatal("picked a server for an instance that is not visible")
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"local-clipboard/internal/models"
+)
+
+// ErrEventsUnsupported is returned by API.StreamEvents when the server has no /api/events endpoint.
+var ErrEventsUnsupported = errors.New("server does not support event stream")
+
+// StreamEvents connects to the server's SSE endpoint and calls handle for every
+// event until the stream ends or ctx is cancelled. Encrypted entries are
+// decrypted first; events that cannot be decrypted are skipped with a log line. lastEventID is sent as
+// Last-Event-ID so the server can replay missed events; the id of the last
+// event received is returned so the caller can resume on reconnect. It may be
+// lower than lastEventID when the server restarted with new ids.
+func (a *API) StreamEvents(ctx context.Context, lastEventID int64, handle func(models.Event)) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.BaseURL()+"/api/events", nil)
+	if err != nil {
+		return lastEventID, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatInt(lastEventID, 10))
+	}
+	resp, err := a.do(req)
+	if err != nil {
+		return lastEventID, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return lastEventID, ErrEventsUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		return lastEventID, fmt.Errorf("status %s", resp.Status)
+	}
+
+	var (
+		id   int64
+		typ  string
+		data []string
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				var entry models.ClipboardUpdate
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &entry); err == nil {
+					if typ == "" {
+						typ = "message"
+					}
+					if err := a.Decrypt(&entry); err != nil {
+						log.Printf("event %d: %v", id, err)
+					} else {
+						handle(models.Event{ID: id, Type: typ, Entry: entry})
+					}
+				}
+				if id > 0 {
+					lastEventID = id
+				}
+			}
+			typ, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				id = v
+			}
+		case "event":
+			typ = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return lastEventID, err
+	}
+	return lastEventID, nil
+}
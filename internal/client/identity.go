@@ -0,0 +1,49 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultClientIDFile returns the file holding this machine's client id:
+// $XDG_CONFIG_HOME/local-clipboard/client-id.
+func DefaultClientIDFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "local-clipboard", "client-id")
+}
+
+// LoadClientID returns the client id stored at path, generating and saving a
+// random one on first use. The server's device registry is keyed by it, so it
+// stays the same when the hostname or IP changes. With an empty path a fresh
+// id is returned on every call.
+func LoadClientID(path string) (string, error) {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err == nil {
+			if id := strings.TrimSpace(string(b)); id != "" {
+				return id, nil
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+	if path == "" {
+		return id, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	return id, os.WriteFile(path, []byte(id+"\n"), 0o600)
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"time"
+
+	"local-clipboard/internal/metrics"
+)
+
+// clientMetrics records what the client does. Its fields are nil, and record
+// nothing, when Config.Metrics is nil.
+type clientMetrics struct {
+	pushes     *metrics.Counter   // result: ok, refused or error
+	pushTime   *metrics.Histogram // Round trip of successful pushes
+	pulls      *metrics.Counter   // Remote changes written to the local clipboard, by kind
+	reconnects *metrics.Counter   // Event stream reconnects
+}
+
+func newClientMetrics(reg *metrics.Registry) clientMetrics {
+	return clientMetrics{
+		pushes:     reg.Counter("local_clipboard_client_pushes_total", "Local clipboard changes sent to the server, by result.", "result"),
+		pushTime:   reg.Histogram("local_clipboard_client_push_duration_seconds", "Round trip of successful pushes to the server.", metrics.DefBuckets),
+		pulls:      reg.Counter("local_clipboard_client_pulls_total", "Remote clipboard changes written to the local clipboard, by kind (text or blob).", "kind"),
+		reconnects: reg.Counter("local_clipboard_client_stream_reconnects_total", "Times the client reconnected to the server's event stream."),
+	}
+}
+
+// pushed records the outcome of a push that started at start.
+func (m clientMetrics) pushed(err error, refused bool, start time.Time) {
+	switch {
+	case err == nil:
+		m.pushes.Inc("ok")
+		m.pushTime.Observe(time.Since(start).Seconds())
+	case refused:
+		m.pushes.Inc("refused")
+	default:
+		m.pushes.Inc("error")
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPinnedHTTPClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	fp := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	hc, err := PinnedHTTPClient(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hc.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("pinned request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	wrong := strings.Repeat("00", sha256.Size)
+	hc, _ = PinnedHTTPClient(wrong)
+	if _, err := hc.Get(srv.URL); err == nil || !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("expected fingerprint mismatch, got %v", err)
+	}
+
+	if _, err := PinnedHTTPClient("not-hex"); err == nil {
+		t.Fatal("expected invalid fingerprint error")
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTokenFile returns the file where device tokens are kept:
+// $XDG_CONFIG_HOME/local-clipboard/tokens.json (usually ~/.config/local-clipboard/tokens.json).
+func DefaultTokenFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "local-clipboard", "tokens.json")
+}
+
+// tokenFile maps server base URLs to the device token paired with that server.
+type tokenFile struct {
+	Tokens map[string]string `json:"tokens"`
+}
+
+// LoadToken returns the token saved for serverURL, or "" if there is none.
+func LoadToken(path, serverURL string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	tf, err := readTokenFile(path)
+	if err != nil {
+		return "", err
+	}
+	return tf.Tokens[strings.TrimRight(serverURL, "/")], nil
+}
+
+// SaveToken stores token for serverURL, keeping tokens for other servers.
+// The file is written with 0600 permissions since tokens grant clipboard access.
+func SaveToken(path, serverURL, token string) error {
+	if path == "" {
+		return errors.New("no token file configured")
+	}
+	tf, err := readTokenFile(path)
+	if err != nil {
+		return err
+	}
+	tf.Tokens[strings.TrimRight(serverURL, "/")] = token
+	b, err := json.MarshalIndent(tf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readTokenFile(path string) (tokenFile, error) {
+	tf := tokenFile{Tokens: map[string]string{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tf, nil
+	}
+	if err != nil {
+		return tf, err
+	}
+	if err := json.Unmarshal(b, &tf); err != nil {
+		return tf, err
+	}
+	if tf.Tokens == nil {
+		tf.Tokens = map[string]string{}
+	}
+	return tf, nil
+}
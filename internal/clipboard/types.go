@@ -0,0 +1,82 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrTypesUnsupported is returned when the clipboard tool cannot read or write
+// specific MIME types (only wl-clipboard and xclip can).
+var ErrTypesUnsupported = errors.New("clipboard tool does not support MIME types")
+
+// Types lists the MIME types (or X11 targets) the clipboard currently offers.
+func Types(cmd Cmd) ([]string, error) {
+	var args []string
+	switch cmd.Name {
+	case "wl-paste":
+		args = []string{"--list-types"}
+	case "xclip":
+		args = []string{"-selection", "clipboard", "-t", "TARGETS", "-o"}
+	default:
+		return nil, ErrTypesUnsupported
+	}
+	out, err := run(cmd.Name, args, nil)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// HasText reports whether types include a plain-text representation.
+func HasText(types []string) bool {
+	for _, t := range types {
+		if strings.HasPrefix(t, "text/plain") || t == "UTF8_STRING" || t == "STRING" || t == "TEXT" {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadType reads the clipboard content for the given MIME type.
+func ReadType(cmd Cmd, mimeType string) ([]byte, error) {
+	switch cmd.Name {
+	case "wl-paste":
+		return run(cmd.Name, []string{"--type", mimeType}, nil)
+	case "xclip":
+		return run(cmd.Name, []string{"-selection", "clipboard", "-t", mimeType, "-o"}, nil)
+	default:
+		return nil, ErrTypesUnsupported
+	}
+}
+
+// WriteType sets the clipboard to data, offered as the given MIME type.
+func WriteType(cmd *Cmd, mimeType string, data []byte) error {
+	if cmd == nil {
+		return errors.New("clipboard write command not configured")
+	}
+	var err error
+	switch cmd.Name {
+	case "wl-copy":
+		_, err = run(cmd.Name, []string{"--type", mimeType}, data)
+	case "xclip":
+		_, err = run(cmd.Name, []string{"-selection", "clipboard", "-t", mimeType}, data)
+	default:
+		err = ErrTypesUnsupported
+	}
+	return err
+}
+
+func run(name string, args []string, stdin []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	c := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		c.Stdin = bytes.NewReader(stdin)
+		return nil, c.Run()
+	}
+	return c.Output()
+}
@@ -0,0 +1,312 @@
+// Package config fills command-line flags from a TOML config file and from
+// LOCAL_CLIPBOARD_* environment variables. Every flag of a mode is a setting
+// under the same name, so new flags need no extra code; the precedence is
+// flag > environment > file > default.
+//
+// A file holds settings shared by all modes at the top, and settings for one
+// mode in a section named after it:
+//
+//	source = "laptop"
+//
+//	[server]
+//	addr = ":9000"
+//	allow = ["lan", "100.64.0.0/10"]
+//
+//	[client]
+//	server = "https://192.168.1.5:9000"
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FileFlag is the flag naming the config file; Parse adds it to flag sets
+	// that lack it.
+	FileFlag = "config"
+	// PathEnv names the config file when -config is not given.
+	PathEnv = "LOCAL_CLIPBOARD_CONFIG"
+	// EnvPrefix starts the environment variable of every setting, e.g.
+	// LOCAL_CLIPBOARD_MAX_ENTRIES for -max-entries.
+	EnvPrefix = "LOCAL_CLIPBOARD_"
+)
+
+// envAliases are older environment variables that still set a flag, below
+// its own variable: PORT=9000 means -addr :9000 unless LOCAL_CLIPBOARD_ADDR
+// or -addr is set. Each maps to the variable and how its value becomes the
+// flag's.
+var envAliases = map[string]struct {
+	env   string
+	value func(string) string
+}{
+	"addr": {"PORT", func(port string) string { return ":" + port }},
+}
+
+// Source is where the effective value of a setting came from.
+type Source string
+
+const (
+	FromDefault Source = "default"
+	FromFile    Source = "file"
+	FromEnv     Source = "env"
+	FromFlag    Source = "flag"
+)
+
+// DefaultPath is $XDG_CONFIG_HOME/local-clipboard/config.toml (usually
+// ~/.config/local-clipboard/config.toml), or "" when there is no config dir.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "local-clipboard", "config.toml")
+}
+
+// EnvName is the environment variable of the setting behind flag name.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// File is a parsed config file.
+type File struct {
+	Path     string
+	sections map[string]map[string]setting
+}
+
+// Load reads the config file at path.
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sections, err := parseTOML(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &File{Path: path, sections: sections}, nil
+}
+
+// Find loads the config file named by path, else by $LOCAL_CLIPBOARD_CONFIG,
+// else DefaultPath if it exists. Without any it returns an empty File.
+func Find(path string, lookupEnv func(string) (string, bool)) (*File, error) {
+	if path == "" {
+		path, _ = lookupEnv(PathEnv)
+	}
+	if path != "" {
+		return Load(path)
+	}
+	def := DefaultPath()
+	if def == "" {
+		return &File{}, nil
+	}
+	f, err := Load(def)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &File{}, nil
+	}
+	return f, err
+}
+
+// lookup returns the setting for a flag of mode: the mode's section wins over
+// the top level. Keys may use _ for -.
+func (f *File) lookup(mode, name string) (setting, bool) {
+	for _, section := range []string{mode, ""} {
+		for key, s := range f.sections[section] {
+			if strings.ReplaceAll(key, "_", "-") == name {
+				return s, true
+			}
+		}
+	}
+	return setting{}, false
+}
+
+// Check reports settings that no mode knows: top-level keys must be a flag of
+// some mode, and a section must be a mode whose flags include all its keys.
+// modes maps section names to the flag sets of those modes.
+func (f *File) Check(modes map[string]*flag.FlagSet) error {
+	names := make([]string, 0, len(f.sections))
+	for section := range f.sections {
+		names = append(names, section)
+	}
+	sort.Strings(names)
+	for _, section := range names {
+		sets := []*flag.FlagSet{modes[section]}
+		if section == "" {
+			sets = sets[:0]
+			for _, fs := range modes {
+				sets = append(sets, fs)
+			}
+		} else if sets[0] == nil {
+			return fmt.Errorf("%s: unknown section [%s]", f.Path, section)
+		}
+		for key, s := range f.sections[section] {
+			name := strings.ReplaceAll(key, "_", "-")
+			known := false
+			for _, fs := range sets {
+				known = known || (name != FileFlag && fs.Lookup(name) != nil)
+			}
+			if !known {
+				return fmt.Errorf("%s:%d: unknown setting %q", f.Path, s.line, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Result tells where the settings of one Parse came from.
+type Result struct {
+	File    *File
+	Sources map[string]Source // By flag name
+}
+
+// Parse parses args into fs like fs.Parse, after filling the flags args does
+// not set: from their environment variable if set, else from the config file
+// (section fs.Name(), then the top level). The file is the one -config in
+// args names, else the one Find locates. Parse adds -config to fs if needed.
+func Parse(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Result, error) {
+	if fs.Lookup(FileFlag) == nil {
+		fs.String(FileFlag, "", "config file (default "+displayPath(DefaultPath())+", or set "+PathEnv+")")
+	}
+	explicit, path := scan(fs, args)
+	f, err := Find(path, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{File: f, Sources: map[string]Source{}}
+	var setErr error
+	fs.VisitAll(func(fl *flag.Flag) {
+		name := fl.Name
+		switch {
+		case setErr != nil || name == FileFlag:
+			return
+		case explicit[name]:
+			res.Sources[name] = FromFlag
+			return
+		}
+		res.Sources[name] = FromDefault
+		env, v, ok := EnvName(name), "", false
+		if v, ok = lookupEnv(env); !ok || v == "" {
+			if alias, has := envAliases[name]; has {
+				env = alias.env
+				if v, ok = lookupEnv(env); ok && v != "" {
+					v = alias.value(v)
+				}
+			}
+		}
+		if ok && v != "" {
+			if err := fs.Set(name, v); err != nil {
+				setErr = fmt.Errorf("%s: %w", env, err)
+			}
+			res.Sources[name] = FromEnv
+			return
+		}
+		if s, ok := f.lookup(fs.Name(), name); ok {
+			for _, v := range s.values {
+				if err := fs.Set(name, v); err != nil {
+					setErr = fmt.Errorf("%s:%d: %s: %w", f.Path, s.line, name, err)
+					return
+				}
+			}
+			res.Sources[name] = FromFile
+		}
+	})
+	if setErr != nil {
+		return nil, setErr
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// scan finds the flags args sets, and the -config value, without touching the
+// flags of fs: it parses args into a copy of fs whose flags record nothing.
+func scan(fs *flag.FlagSet, args []string) (map[string]bool, string) {
+	probe := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	probe.SetOutput(io.Discard)
+	var path string
+	fs.VisitAll(func(fl *flag.Flag) {
+		if fl.Name == FileFlag {
+			probe.StringVar(&path, FileFlag, "", "")
+			return
+		}
+		probe.Var(ignored{boolFlag: isBool(fl.Value)}, fl.Name, "")
+	})
+	// Errors are reported by the real Parse.
+	_ = probe.Parse(args)
+	explicit := map[string]bool{}
+	probe.Visit(func(fl *flag.Flag) { explicit[fl.Name] = true })
+	return explicit, path
+}
+
+func isBool(v flag.Value) bool {
+	b, ok := v.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// ignored is a flag.Value that accepts anything.
+type ignored struct{ boolFlag bool }
+
+func (ignored) String() string     { return "" }
+func (ignored) Set(string) error   { return nil }
+func (i ignored) IsBoolFlag() bool { return i.boolFlag }
+
+// WriteTOML writes the effective settings of fs as a [fs.Name()] section of a
+// config file, each commented with where it came from. Values of the flags in
+// secret are replaced by "[redacted]".
+func (r *Result) WriteTOML(w io.Writer, fs *flag.FlagSet, secret map[string]bool) error {
+	if _, err := fmt.Fprintf(w, "[%s]\n", fs.Name()); err != nil {
+		return err
+	}
+	var err error
+	fs.VisitAll(func(fl *flag.Flag) {
+		if fl.Name == FileFlag || err != nil {
+			return
+		}
+		value := formatValue(fl.Value)
+		if secret[fl.Name] && fl.Value.String() != "" {
+			value = strconv.Quote("[redacted]")
+		}
+		_, err = fmt.Fprintf(w, "%s = %s  # %s\n", fl.Name, value, r.Sources[fl.Name])
+	})
+	return err
+}
+
+// formatValue renders a flag's value in TOML: booleans and numbers bare,
+// lists (values with a Get method returning []string) as arrays, and the rest
+// as strings, which Set accepts back.
+func formatValue(v flag.Value) string {
+	if g, ok := v.(flag.Getter); ok {
+		switch x := g.Get().(type) {
+		case bool, int, int64, uint, uint64, float64:
+			return fmt.Sprint(x)
+		case []string:
+			quoted := make([]string, len(x))
+			for i, s := range x {
+				quoted[i] = strconv.Quote(s)
+			}
+			return "[" + strings.Join(quoted, ", ") + "]"
+		}
+	}
+	return strconv.Quote(v.String())
+}
+
+// displayPath shortens the home directory in path to ~.
+func displayPath(path string) string {
+	if home, err := os.UserHomeDir(); err == nil && home != "" && strings.HasPrefix(path, home+string(filepath.Separator)) {
+		return "~" + path[len(home):]
+	}
+	if path == "" {
+		return "none"
+	}
+	return path
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type list []string
+
+func (l *list) String() string     { return strings.Join(*l, ",") }
+func (l *list) Set(s string) error { *l = append(*l, s); return nil }
+func (l *list) Get() any           { return []string(*l) }
+
+type testFlags struct {
+	addr     *string
+	interval *time.Duration
+	tls      *bool
+	max      *int
+	allow    list
+}
+
+func newTestFlags(mode string) (*flag.FlagSet, *testFlags) {
+	fs := flag.NewFlagSet(mode, flag.ContinueOnError)
+	f := &testFlags{
+		addr:     fs.String("addr", ":8080", ""),
+		interval: fs.Duration("interval", time.Second, ""),
+		tls:      fs.Bool("tls", false, ""),
+		max:      fs.Int("max-entries", 0, ""),
+	}
+	fs.Var(&f.allow, "allow", "")
+	return fs, f
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envOf(vars map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	path := writeConfig(t, `
+addr = ":7000"      # shared
+max_entries = 10
+
+[server]
+interval = "5s"
+tls = true
+allow = [
+  "lan",
+  "10.0.0.0/8", # vpn
+]
+max-entries = 20
+`)
+	fs, f := newTestFlags("server")
+	env := envOf(map[string]string{PathEnv: path, "LOCAL_CLIPBOARD_INTERVAL": "7s", "LOCAL_CLIPBOARD_ADDR": ""})
+	res, err := Parse(fs, []string{"-max-entries", "30"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *f.addr != ":7000" || *f.interval != 7*time.Second || !*f.tls || *f.max != 30 {
+		t.Fatalf("addr %q interval %s tls %v max %d", *f.addr, *f.interval, *f.tls, *f.max)
+	}
+	if strings.Join(f.allow, " ") != "lan 10.0.0.0/8" {
+		t.Fatalf("allow = %q", f.allow)
+	}
+	want := map[string]Source{"addr": FromFile, "interval": FromEnv, "tls": FromFile, "max-entries": FromFlag, "allow": FromFile}
+	for name, source := range want {
+		if res.Sources[name] != source {
+			t.Errorf("%s from %s, want %s", name, res.Sources[name], source)
+		}
+	}
+
+	// -config wins over the environment, and a flag replaces a list from the file.
+	other := writeConfig(t, "[server]\nallow = [\"any\"]\n")
+	fs, f = newTestFlags("server")
+	if _, err := Parse(fs, []string{"-config", path, "-allow", "loopback"}, envOf(map[string]string{PathEnv: other})); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(f.allow, " ") != "loopback" || *f.max != 20 {
+		t.Fatalf("allow %q, max %d", f.allow, *f.max)
+	}
+}
+
+func TestParsePortAlias(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := writeConfig(t, "addr = \":7000\"\n")
+	for _, tc := range []struct {
+		args []string
+		env  map[string]string
+		want string
+		src  Source
+	}{
+		{nil, nil, ":7000", FromFile},
+		{nil, map[string]string{"PORT": "9999"}, ":9999", FromEnv},
+		{nil, map[string]string{"PORT": "9999", "LOCAL_CLIPBOARD_ADDR": ":6000"}, ":6000", FromEnv},
+		{[]string{"-addr", ":5000"}, map[string]string{"PORT": "9999", "LOCAL_CLIPBOARD_ADDR": ":6000"}, ":5000", FromFlag},
+	} {
+		fs, f := newTestFlags("server")
+		res, err := Parse(fs, append([]string{"-config", path}, tc.args...), envOf(tc.env))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *f.addr != tc.want || res.Sources["addr"] != tc.src {
+			t.Errorf("args %v, env %v: addr = %q from %s, want %q from %s", tc.args, tc.env, *f.addr, res.Sources["addr"], tc.want, tc.src)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct{ name, content, want string }{
+		{"bad value", "[server]\ninterval = \"soon\"\n", ":2: interval:"},
+		{"unquoted string", "addr = localhost\n", "line 1: addr: invalid value"},
+		{"open array", "allow = [\"a\",\n", "array is not closed"},
+		{"duplicate", "tls = true\ntls = false\n", "line 2: tls is set twice"},
+		{"no value", "[server]\ntls\n", "line 2: expected key = value"},
+	} {
+		fs, _ := newTestFlags("server")
+		_, err := Parse(fs, nil, envOf(map[string]string{PathEnv: writeConfig(t, tc.content)}))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir()) // No default config file
+	fs, _ := newTestFlags("server")
+	if _, err := Parse(fs, nil, envOf(map[string]string{"LOCAL_CLIPBOARD_TLS": "maybe"})); err == nil || !strings.Contains(err.Error(), "LOCAL_CLIPBOARD_TLS") {
+		t.Errorf("bad env value: %v", err)
+	}
+	if _, err := Parse(fs, nil, envOf(map[string]string{PathEnv: filepath.Join(t.TempDir(), "missing.toml")})); err == nil {
+		t.Error("missing config file accepted")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server, _ := newTestFlags("server")
+	client := flag.NewFlagSet("client", flag.ContinueOnError)
+	client.String("source", "", "")
+	modes := map[string]*flag.FlagSet{"server": server, "client": client}
+	for content, want := range map[string]string{
+		"source = \"x\"\n[server]\ntls = true\n": "",
+		"[client]\ntls = true\n":                 `:2: unknown setting "tls"`,
+		"colour = \"red\"\n":                     `:1: unknown setting "colour"`,
+		"[desktop]\nsource = \"x\"\n":            "unknown section [desktop]",
+	} {
+		f, err := Load(writeConfig(t, content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = f.Check(modes)
+		if (want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), want)) {
+			t.Errorf("%q: err = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestWriteTOMLRoundTrips(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir()) // No default config file
+	fs, _ := newTestFlags("server")
+	res, err := Parse(fs, []string{"-tls", "-allow", "lan", "-allow", "10.0.0.0/8", "-interval", "90s"}, envOf(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := res.WriteTOML(&out, fs, map[string]bool{"addr": true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`addr = "[redacted]"  # default`,
+		`allow = ["lan", "10.0.0.0/8"]  # flag`,
+		`interval = "1m30s"  # flag`,
+		`tls = true  # flag`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("output lacks %q:\n%s", line, out.String())
+		}
+	}
+
+	// The output is itself a config file giving the same values.
+	fs2, f2 := newTestFlags("server")
+	if _, err := Parse(fs2, nil, envOf(map[string]string{PathEnv: writeConfig(t, strings.Replace(out.String(), `"[redacted]"`, `":9"`, 1))})); err != nil {
+		t.Fatal(err)
+	}
+	if *f2.interval != 90*time.Second || !*f2.tls || strings.Join(f2.allow, " ") != "lan 10.0.0.0/8" || *f2.addr != ":9" {
+		t.Fatalf("round trip: interval %s tls %v allow %q addr %q", *f2.interval, *f2.tls, f2.allow, *f2.addr)
+	}
+}
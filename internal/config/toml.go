@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// setting is one key of the file: its values (several for an array) and the
+// line it is on, for error messages.
+type setting struct {
+	values []string
+	line   int
+}
+
+// parseTOML reads the subset of TOML a config file needs: [section] headers,
+// key = value pairs with strings, numbers, booleans or arrays of those, and
+// comments. Keys outside a section go to section "". Values are kept as the
+// strings a flag would be given.
+func parseTOML(r io.Reader) (map[string]map[string]setting, error) {
+	sections := map[string]map[string]setting{"": {}}
+	section := ""
+	sc := bufio.NewScanner(r)
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid section header %s", n, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if !isBareKey(section) {
+				return nil, fmt.Errorf("line %d: invalid section name %q", n, section)
+			}
+			if _, ok := sections[section]; !ok {
+				sections[section] = map[string]setting{}
+			}
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if k, err := strconv.Unquote(key); err == nil && strings.HasPrefix(key, `"`) {
+			key = k
+		} else if !isBareKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", n, key)
+		}
+		start := n
+		// Arrays may span lines until the closing bracket.
+		for strings.HasPrefix(raw, "[") && !closed(raw) && sc.Scan() {
+			n++
+			raw += " " + strings.TrimSpace(stripComment(sc.Text()))
+		}
+		values, err := parseValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", start, key, err)
+		}
+		if _, dup := sections[section][key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", start, key)
+		}
+		sections[section][key] = setting{values: values, line: start}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// stripComment removes a # comment that is not inside a string.
+func stripComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// closed reports whether an array value has its closing bracket.
+func closed(raw string) bool {
+	_, rest, err := splitArray(raw)
+	return err == nil && rest == ""
+}
+
+func parseValue(raw string) ([]string, error) {
+	if !strings.HasPrefix(raw, "[") {
+		v, rest, err := scalar(raw)
+		if err != nil {
+			return nil, err
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("unexpected %q after the value", rest)
+		}
+		return []string{v}, nil
+	}
+	values, rest, err := splitArray(raw)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q after the array", rest)
+	}
+	return values, nil
+}
+
+// splitArray parses [a, b, ...] at the start of raw and returns the values and
+// what follows the closing bracket.
+func splitArray(raw string) ([]string, string, error) {
+	s := strings.TrimSpace(raw[1:])
+	values := []string{}
+	for {
+		if strings.HasPrefix(s, "]") {
+			return values, strings.TrimSpace(s[1:]), nil
+		}
+		if s == "" {
+			return nil, "", fmt.Errorf("array is not closed")
+		}
+		v, rest, err := scalar(s)
+		if err != nil {
+			return nil, "", err
+		}
+		values = append(values, v)
+		s = strings.TrimSpace(rest)
+		if strings.HasPrefix(s, ",") {
+			s = strings.TrimSpace(s[1:])
+		} else if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// scalar parses one string, number or boolean at the start of s and returns it
+// with the rest of s.
+func scalar(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := 1
+		for ; end < len(s); end++ {
+			if s[end] == '\\' {
+				end++
+			} else if s[end] == '"' {
+				break
+			}
+		}
+		if end >= len(s) {
+			return "", "", fmt.Errorf("string is not closed")
+		}
+		v, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", "", fmt.Errorf("invalid string %s", s[:end+1])
+		}
+		return v, strings.TrimSpace(s[end+1:]), nil
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("string is not closed")
+		}
+		return s[1 : end+1], strings.TrimSpace(s[end+2:]), nil
+	}
+	end := strings.IndexAny(s, ",] \t")
+	if end < 0 {
+		end = len(s)
+	}
+	v := s[:end]
+	if v != "true" && v != "false" {
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(v, "_", ""), 64); err != nil {
+			return "", "", fmt.Errorf("invalid value %q (quote strings, e.g. \"10m\")", v)
+		}
+		v = strings.ReplaceAll(v, "_", "")
+	}
+	return v, strings.TrimSpace(s[end:]), nil
+}
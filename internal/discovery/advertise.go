@@ -0,0 +1,246 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	servicesEnum   = "_services._dns-sd._udp." + domain
+	unicastBit     = 1 << 15 // QU bit in the question class
+	maxMessageSize = 9000
+)
+
+// Advertise answers mDNS queries for svc until ctx is cancelled. It announces
+// the service when it starts and sends a goodbye (TTL 0) when it stops.
+func Advertise(ctx context.Context, svc Service, opts Options) error {
+	group := opts.group()
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return err
+	}
+	pc := ipv4.NewPacketConn(conn)
+	for _, ifi := range opts.interfaces() {
+		ifi := ifi
+		_ = pc.JoinGroup(&ifi, &net.UDPAddr{IP: group.IP}) // already joined on the default interface
+	}
+	_ = pc.SetControlMessage(ipv4.FlagInterface, true)
+	_ = pc.SetMulticastLoopback(true)
+
+	r := &responder{svc: svc}
+	announce := func(ttl uint32) {
+		msg, err := r.message(0, nil, r.all(ttl))
+		if err != nil {
+			return
+		}
+		for _, ifi := range opts.interfaces() {
+			ifi := ifi
+			if pc.SetMulticastInterface(&ifi) == nil {
+				_, _ = pc.WriteTo(msg, nil, group)
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			announce(0)
+			conn.Close()
+		case <-done:
+		}
+	}()
+	announce(recordTTL)
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, cm, src, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		var p dnsmessage.Parser
+		hdr, err := p.Start(buf[:n])
+		if err != nil || hdr.Response {
+			continue
+		}
+		questions, err := p.AllQuestions()
+		if err != nil {
+			continue
+		}
+		answers, unicast := r.answer(questions)
+		if len(answers) == 0 {
+			continue
+		}
+		udpSrc, _ := src.(*net.UDPAddr)
+		legacy := udpSrc != nil && udpSrc.Port != group.Port
+		if legacy {
+			// Legacy unicast queriers (RFC 6762 §6.7) need the query id and questions echoed.
+			if msg, err := r.message(hdr.ID, questions, answers); err == nil {
+				_, _ = pc.WriteTo(msg, nil, udpSrc)
+			}
+			continue
+		}
+		msg, err := r.message(0, nil, answers)
+		if err != nil {
+			continue
+		}
+		if unicast && udpSrc != nil {
+			_, _ = pc.WriteTo(msg, nil, udpSrc)
+			continue
+		}
+		if cm != nil {
+			if ifi, err := net.InterfaceByIndex(cm.IfIndex); err == nil {
+				_ = pc.SetMulticastInterface(ifi)
+			}
+		}
+		_, _ = pc.WriteTo(msg, nil, group)
+	}
+}
+
+type responder struct {
+	svc Service
+}
+
+// answer returns the records answering questions, and whether any question
+// asked for a unicast response.
+func (r *responder) answer(questions []dnsmessage.Question) ([]dnsmessage.Resource, bool) {
+	var (
+		out     []dnsmessage.Resource
+		unicast bool
+		seen    = map[string]bool{}
+	)
+	add := func(rs ...dnsmessage.Resource) {
+		for _, rr := range rs {
+			key := rr.Header.Name.String() + "/" + rr.Header.Type.String()
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, rr)
+			}
+		}
+	}
+	for _, q := range questions {
+		matched := false
+		switch {
+		case sameName(q.Name, servicesEnum) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+			add(r.enumRecord(recordTTL))
+			matched = true
+		case sameName(q.Name, serviceName()) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+			add(r.all(recordTTL)...)
+			matched = true
+		case sameName(q.Name, instanceName(r.svc.Instance)):
+			if q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL {
+				add(r.srvRecord(recordTTL))
+				add(r.aRecords(recordTTL)...)
+				matched = true
+			}
+			if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+				add(r.txtRecord(recordTTL))
+				matched = true
+			}
+		case sameName(q.Name, hostName(r.svc.Host)) && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL):
+			add(r.aRecords(recordTTL)...)
+			matched = true
+		}
+		if matched && uint16(q.Class)&unicastBit != 0 {
+			unicast = true
+		}
+	}
+	return out, unicast
+}
+
+func (r *responder) all(ttl uint32) []dnsmessage.Resource {
+	return append([]dnsmessage.Resource{r.ptrRecord(ttl), r.srvRecord(ttl), r.txtRecord(ttl)}, r.aRecords(ttl)...)
+}
+
+func (r *responder) header(name string, typ dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: mustName(name), Type: typ, Class: dnsmessage.ClassINET, TTL: ttl}
+}
+
+func (r *responder) enumRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: r.header(servicesEnum, dnsmessage.TypePTR, ttl),
+		Body:   &dnsmessage.PTRResource{PTR: mustName(serviceName())},
+	}
+}
+
+func (r *responder) ptrRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: r.header(serviceName(), dnsmessage.TypePTR, ttl),
+		Body:   &dnsmessage.PTRResource{PTR: mustName(instanceName(r.svc.Instance))},
+	}
+}
+
+func (r *responder) srvRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: r.header(instanceName(r.svc.Instance), dnsmessage.TypeSRV, ttl),
+		Body:   &dnsmessage.SRVResource{Target: mustName(hostName(r.svc.Host)), Port: uint16(r.svc.Port)},
+	}
+}
+
+func (r *responder) txtRecord(ttl uint32) dnsmessage.Resource {
+	keys := make([]string, 0, len(r.svc.TXT))
+	for k := range r.svc.TXT {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	txt := make([]string, 0, len(keys))
+	for _, k := range keys {
+		txt = append(txt, k+"="+r.svc.TXT[k])
+	}
+	if len(txt) == 0 {
+		txt = []string{""}
+	}
+	return dnsmessage.Resource{
+		Header: r.header(instanceName(r.svc.Instance), dnsmessage.TypeTXT, ttl),
+		Body:   &dnsmessage.TXTResource{TXT: txt},
+	}
+}
+
+func (r *responder) aRecords(ttl uint32) []dnsmessage.Resource {
+	var out []dnsmessage.Resource
+	for _, ip := range r.svc.IPs {
+		v4 := ip.To4()
+		if v4 == nil {
+			continue
+		}
+		var a [4]byte
+		copy(a[:], v4)
+		out = append(out, dnsmessage.Resource{
+			Header: r.header(hostName(r.svc.Host), dnsmessage.TypeA, ttl),
+			Body:   &dnsmessage.AResource{A: a},
+		})
+	}
+	return out
+}
+
+func (r *responder) message(id uint16, questions []dnsmessage.Question, answers []dnsmessage.Resource) ([]byte, error) {
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, Response: true, Authoritative: true},
+		Questions: questions,
+		Answers:   answers,
+	}
+	for i := range msg.Questions {
+		msg.Questions[i].Class = dnsmessage.Class(uint16(msg.Questions[i].Class) &^ unicastBit)
+	}
+	return msg.Pack()
+}
+
+// TXTFields parses "key=value" TXT strings into a map.
+func TXTFields(txt []string) map[string]string {
+	out := make(map[string]string, len(txt))
+	for _, s := range txt {
+		if k, v, ok := strings.Cut(s, "="); ok && k != "" {
+			out[strings.ToLower(k)] = v
+		}
+	}
+	return out
+}
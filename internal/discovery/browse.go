@@ -0,0 +1,160 @@
+package discovery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// Browse queries the network for clipboard servers and returns those that
+// answered within wait (or before ctx is done), sorted by instance name.
+func Browse(ctx context.Context, wait time.Duration, opts Options) ([]Service, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	pc := ipv4.NewPacketConn(conn)
+	_ = pc.SetMulticastLoopback(true)
+
+	query, err := buildQuery()
+	if err != nil {
+		return nil, err
+	}
+	group := opts.group()
+	sent := 0
+	var lastErr error
+	for _, ifi := range opts.interfaces() {
+		ifi := ifi
+		if err := pc.SetMulticastInterface(&ifi); err != nil {
+			lastErr = err
+			continue
+		}
+		if _, err := pc.WriteTo(query, nil, group); err != nil {
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no multicast interface available")
+		}
+		return nil, lastErr
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+
+	rec := newRecords()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break // deadline reached
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		rec.parse(buf[:n])
+	}
+	return rec.services(), nil
+}
+
+func buildQuery() ([]byte, error) {
+	var id [2]byte
+	_, _ = rand.Read(id[:])
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:])},
+		Questions: []dnsmessage.Question{{
+			Name:  mustName(serviceName()),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+type srvTarget struct {
+	host string
+	port int
+}
+
+// records accumulates the resource records seen in responses.
+type records struct {
+	instances map[string]string // lower-cased name -> name as advertised
+	srv       map[string]srvTarget
+	txt       map[string][]string
+	a         map[string][]net.IP
+}
+
+func newRecords() *records {
+	return &records{
+		instances: map[string]string{},
+		srv:       map[string]srvTarget{},
+		txt:       map[string][]string{},
+		a:         map[string][]net.IP{},
+	}
+}
+
+func (r *records) parse(b []byte) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil || !msg.Header.Response {
+		return
+	}
+	for _, rr := range append(msg.Answers, msg.Additionals...) {
+		name := strings.ToLower(rr.Header.Name.String())
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == strings.ToLower(serviceName()) && rr.Header.TTL > 0 {
+				r.instances[strings.ToLower(body.PTR.String())] = body.PTR.String()
+			}
+		case *dnsmessage.SRVResource:
+			r.srv[name] = srvTarget{host: strings.ToLower(body.Target.String()), port: int(body.Port)}
+		case *dnsmessage.TXTResource:
+			r.txt[name] = body.TXT
+		case *dnsmessage.AResource:
+			ip := net.IP(body.A[:])
+			for _, have := range r.a[name] {
+				if have.Equal(ip) {
+					ip = nil
+					break
+				}
+			}
+			if ip != nil {
+				r.a[name] = append(r.a[name], ip)
+			}
+		}
+	}
+}
+
+func (r *records) services() []Service {
+	suffix := "." + strings.ToLower(serviceName())
+	var out []Service
+	for inst, name := range r.instances {
+		srv, ok := r.srv[inst]
+		if !ok || !strings.HasSuffix(inst, suffix) {
+			continue
+		}
+		out = append(out, Service{
+			Instance: name[:len(name)-len(suffix)],
+			Host:     strings.TrimSuffix(srv.host, "."+domain),
+			Port:     srv.port,
+			IPs:      r.a[srv.host],
+			TXT:      TXTFields(r.txt[inst]),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Instance < out[j].Instance })
+	return out
+}
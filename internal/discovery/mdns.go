@@ -0,0 +1,104 @@
+// Package discovery advertises the clipboard server over multicast DNS
+// (DNS-SD service _local-clipboard._tcp) and lets clients find it.
+//
+// Only the small subset of RFC 6762/6763 needed here is implemented: answering
+// PTR/SRV/TXT/A queries for our own service, unsolicited announcements and
+// goodbyes, and one-shot browsing via legacy unicast responses.
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// ServiceType is the DNS-SD service type advertised by the server.
+	ServiceType = "_local-clipboard._tcp"
+	domain      = "local."
+	recordTTL   = 120
+)
+
+// DefaultGroup is the standard IPv4 mDNS group address.
+var DefaultGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Options select the multicast group and interfaces. The zero value uses
+// DefaultGroup on every up, multicast-capable interface; tests override both
+// to run on loopback with a private port.
+type Options struct {
+	Group      *net.UDPAddr
+	Interfaces []net.Interface
+}
+
+func (o Options) group() *net.UDPAddr {
+	if o.Group != nil {
+		return o.Group
+	}
+	return DefaultGroup
+}
+
+func (o Options) interfaces() []net.Interface {
+	if o.Interfaces != nil {
+		return o.Interfaces
+	}
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []net.Interface
+	for _, ifi := range all {
+		if ifi.Flags&net.FlagUp != 0 && ifi.Flags&net.FlagMulticast != 0 {
+			out = append(out, ifi)
+		}
+	}
+	return out
+}
+
+// Service describes one advertised server instance.
+type Service struct {
+	Instance string            // Human-readable instance name, e.g. "local-clipboard on laptop"
+	Host     string            // Host name without domain, e.g. "laptop"
+	Port     int               // TCP port of the HTTP(S) server
+	IPs      []net.IP          // IPv4 addresses the server is reachable at
+	TXT      map[string]string // Key/value metadata (version, tls, fp)
+}
+
+// URL returns the base URL for the service using its first address.
+func (s Service) URL() string {
+	if len(s.IPs) == 0 {
+		return ""
+	}
+	scheme := "http"
+	if s.TXT["tls"] == "1" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(s.IPs[0].String(), strconv.Itoa(s.Port))
+}
+
+func serviceName() string {
+	return ServiceType + "." + domain
+}
+
+func instanceName(instance string) string {
+	// Dots inside the instance label would split it into several labels.
+	return strings.ReplaceAll(instance, ".", "-") + "." + serviceName()
+}
+
+func hostName(host string) string {
+	return strings.ReplaceAll(host, ".", "-") + "." + domain
+}
+
+func mustName(s string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(s)
+	if err != nil {
+		// Only reachable with names longer than 255 bytes.
+		return dnsmessage.MustNewName("invalid." + domain)
+	}
+	return n
+}
+
+func sameName(a dnsmessage.Name, b string) bool {
+	return strings.EqualFold(a.String(), b)
+}
@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// loopbackOptions runs discovery on the loopback interface with a private port
+// so the test neither depends on nor disturbs a real mDNS responder.
+func loopbackOptions(t *testing.T) Options {
+	t.Helper()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lo []net.Interface
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 && ifi.Flags&net.FlagUp != 0 {
+			lo = append(lo, ifi)
+		}
+	}
+	if len(lo) == 0 {
+		t.Skip("no loopback interface")
+	}
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	pc.Close()
+	return Options{Group: &net.UDPAddr{IP: DefaultGroup.IP, Port: port}, Interfaces: lo}
+}
+
+func TestAdvertiseBrowseLoopback(t *testing.T) {
+	opts := loopbackOptions(t)
+	svc := Service{
+		Instance: "Clipboard on Test.Host",
+		Host:     "testhost",
+		Port:     8443,
+		IPs:      []net.IP{net.IPv4(127, 0, 0, 1)},
+		TXT:      map[string]string{"version": "dev", "tls": "1", "fp": "AB:CD"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- Advertise(ctx, svc, opts) }()
+
+	var found []Service
+	for i := 0; i < 5 && len(found) == 0; i++ {
+		select {
+		case err := <-errc:
+			t.Skipf("multicast not available: %v", err)
+		default:
+		}
+		var err error
+		found, err = Browse(context.Background(), 300*time.Millisecond, opts)
+		if err != nil {
+			t.Skipf("multicast not available: %v", err)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("found %d services, want 1: %+v", len(found), found)
+	}
+	got := found[0]
+	if got.Instance != "Clipboard on Test-Host" || got.Host != "testhost" || got.Port != 8443 {
+		t.Fatalf("service = %+v", got)
+	}
+	if got.TXT["fp"] != "AB:CD" || got.TXT["version"] != "dev" {
+		t.Fatalf("txt = %v", got.TXT)
+	}
+	if want := "https://127.0.0.1:8443"; got.URL() != want {
+		t.Fatalf("URL() = %q, want %q", got.URL(), want)
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("Advertise: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Advertise did not stop after cancel")
+	}
+}
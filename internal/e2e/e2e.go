@@ -0,0 +1,174 @@
+// Package e2e implements end-to-end encryption of clipboard text with a key
+// derived from a passphrase shared by all clients. The server only ever sees
+// ciphertext, the nonce and a key id.
+package e2e
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Keys are derived with scrypt from the passphrase and a salt. Since format
+// version 2 the salt is random per deployment (see NewSalt): the server keeps it
+// and advertises it, and every key id names the salt it was derived with, as
+// "v2.<salt>.<id>". Version 1 used the fixed v1Salt and a bare id; its entries
+// can still be opened.
+const (
+	v1Salt   = "local-clipboard/e2e/v1"
+	v2Prefix = "v2."
+	saltSize = 16
+	kdfN     = 1 << 15
+	kdfR     = 8
+	kdfP     = 1
+)
+
+var (
+	// ErrKeyMismatch means the entry was encrypted with a different passphrase.
+	ErrKeyMismatch = errors.New("entry was encrypted with a different passphrase")
+	// ErrDecrypt means the ciphertext was corrupted or tampered with.
+	ErrDecrypt = errors.New("decryption failed")
+	// ErrFormat means the key id is of an unknown format version.
+	ErrFormat = errors.New("entry was encrypted in an unknown format")
+)
+
+// NewSalt returns a random salt for a deployment, for the server to store and
+// advertise. The salt is not secret; it makes the same passphrase derive
+// different keys on different servers.
+func NewSalt() (string, error) {
+	b := make([]byte, saltSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Box encrypts and decrypts clipboard payloads with XChaCha20-Poly1305.
+type Box struct {
+	passphrase string
+	seal       *key
+
+	mu   sync.Mutex
+	keys map[string]*key // By salt, "" for version 1; for opening entries of other deployments
+}
+
+// NewBox derives the key from passphrase and the deployment's salt with scrypt.
+// An empty salt, from a server that does not advertise one, falls back to
+// format version 1. Derivation is deliberately slow (tens of milliseconds);
+// create one Box and reuse it.
+func NewBox(passphrase, salt string) (*Box, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	b := &Box{passphrase: passphrase, keys: make(map[string]*key)}
+	k, err := b.key(salt)
+	if err != nil {
+		return nil, err
+	}
+	b.seal = k
+	return b, nil
+}
+
+// key returns the key derived with salt, deriving it on first use.
+func (b *Box) key(salt string) (*key, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if k, ok := b.keys[salt]; ok {
+		return k, nil
+	}
+	kdfSalt := []byte(v1Salt)
+	if salt != "" {
+		var err error
+		if kdfSalt, err = base64.RawURLEncoding.DecodeString(salt); err != nil || len(kdfSalt) < saltSize {
+			return nil, fmt.Errorf("invalid salt %q", salt)
+		}
+	}
+	raw, err := scrypt.Key([]byte(b.passphrase), kdfSalt, kdfN, kdfR, kdfP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(raw)
+	if err != nil {
+		return nil, err
+	}
+	// The key id lets clients tell "wrong passphrase" apart from corruption without revealing the key.
+	sum := sha256.Sum256(append([]byte("key-id:"), raw...))
+	k := &key{id: hex.EncodeToString(sum[:8]), aead: aead}
+	if salt != "" {
+		k.id = v2Prefix + salt + "." + k.id
+	}
+	b.keys[salt] = k
+	return k, nil
+}
+
+// saltOf returns the salt named by keyID: "" for version 1 ids.
+func saltOf(keyID string) (string, error) {
+	if rest, ok := strings.CutPrefix(keyID, v2Prefix); ok {
+		if salt, _, ok := strings.Cut(rest, "."); ok && salt != "" {
+			return salt, nil
+		}
+		return "", ErrFormat
+	}
+	if strings.Contains(keyID, ".") {
+		return "", ErrFormat
+	}
+	return "", nil
+}
+
+// KeyID identifies the derived key, including the format version and salt.
+func (b *Box) KeyID() string {
+	return b.seal.id
+}
+
+// Seal encrypts plaintext and returns base64 ciphertext and nonce.
+func (b *Box) Seal(plaintext []byte) (ciphertext, nonce string, err error) {
+	n := make([]byte, b.seal.aead.NonceSize())
+	if _, err := rand.Read(n); err != nil {
+		return "", "", err
+	}
+	ct := b.seal.aead.Seal(nil, n, plaintext, []byte(b.seal.id))
+	return base64.StdEncoding.EncodeToString(ct), base64.StdEncoding.EncodeToString(n), nil
+}
+
+// Open decrypts base64 ciphertext produced by Seal, also with the passphrase
+// but another salt or format version.
+func (b *Box) Open(ciphertext, nonce, keyID string) ([]byte, error) {
+	salt, err := saltOf(keyID)
+	if err != nil {
+		return nil, err
+	}
+	k, err := b.key(salt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if keyID != k.id {
+		return nil, ErrKeyMismatch
+	}
+	ct, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ciphertext: %v", ErrDecrypt, err)
+	}
+	n, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil || len(n) != k.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce", ErrDecrypt)
+	}
+	pt, err := k.aead.Open(nil, n, ct, []byte(k.id))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return pt, nil
+}
@@ -0,0 +1,78 @@
+package e2e
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBoxRoundTrip(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewBox("correct horse battery staple", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewBox("correct horse battery staple", salt)
+	if a.KeyID() != b.KeyID() {
+		t.Fatal("same passphrase must derive the same key id")
+	}
+
+	ct, nonce, err := a.Seal([]byte("s3cret\npassword"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, err := b.Open(ct, nonce, a.KeyID())
+	if err != nil || string(pt) != "s3cret\npassword" {
+		t.Fatalf("round trip failed: %q %v", pt, err)
+	}
+
+	other, _ := NewBox("another passphrase", salt)
+	if _, err := other.Open(ct, nonce, a.KeyID()); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected key mismatch, got %v", err)
+	}
+
+	tampered := []byte(ct)
+	tampered[0] ^= 'A' ^ 'B'
+	if _, err := b.Open(string(tampered), nonce, a.KeyID()); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected decrypt failure on tampered ciphertext, got %v", err)
+	}
+}
+
+func TestBoxSaltsAndVersions(t *testing.T) {
+	const pass = "correct horse battery staple"
+	saltA, _ := NewSalt()
+	saltB, _ := NewSalt()
+	a, err := NewBox(pass, saltA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewBox(pass, saltB)
+	v1, _ := NewBox(pass, "")
+	if !strings.HasPrefix(a.KeyID(), "v2."+saltA+".") || a.KeyID() == b.KeyID() {
+		t.Fatalf("key ids %q and %q must name their salt and differ", a.KeyID(), b.KeyID())
+	}
+	if strings.Contains(v1.KeyID(), ".") {
+		t.Fatalf("v1 key id = %q", v1.KeyID())
+	}
+
+	// The same passphrase opens entries of another deployment and of version 1.
+	for _, from := range []*Box{a, v1} {
+		ct, nonce, _ := from.Seal([]byte("hello"))
+		if pt, err := b.Open(ct, nonce, from.KeyID()); err != nil || string(pt) != "hello" {
+			t.Fatalf("open %s entry: %q %v", from.KeyID(), pt, err)
+		}
+	}
+
+	ct, nonce, _ := a.Seal([]byte("hello"))
+	for _, keyID := range []string{"v3.abc.0123456789abcdef", "v2..0123456789abcdef", "v2.not-base64!.0123456789abcdef"} {
+		if _, err := b.Open(ct, nonce, keyID); !errors.Is(err, ErrFormat) {
+			t.Fatalf("key id %q: expected format error, got %v", keyID, err)
+		}
+	}
+	if _, err := NewBox(pass, "short"); err == nil {
+		t.Fatal("expected error for an invalid salt")
+	}
+}
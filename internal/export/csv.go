@@ -0,0 +1,133 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// csvColumns is the header of CSV exports. Binary entries are listed with
+// their metadata only, so importing CSV skips them.
+var csvColumns = []string{"id", "channel", "updated_at", "source", "pinned", "copy_count", "tags", "mime_type", "size", "width", "height", "sensitive", "expires_at", "encrypted", "nonce", "key_id", "text"}
+
+type csvWriter struct {
+	cw     *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{cw: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.cw.Write(csvColumns)
+}
+
+func (w *csvWriter) Write(e models.ClipboardUpdate, _ []byte) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	var expires string
+	if e.ExpiresAt != nil {
+		expires = e.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	return w.cw.Write([]string{
+		strconv.FormatInt(e.ID, 10), e.ChannelName(), e.UpdatedAt.UTC().Format(time.RFC3339Nano), e.Source,
+		strconv.FormatBool(e.Pinned), strconv.Itoa(e.CopyCount), strings.Join(e.Tags, ","),
+		e.MimeType, strconv.FormatInt(e.Size, 10), strconv.Itoa(e.Width), strconv.Itoa(e.Height),
+		strconv.FormatBool(e.Sensitive), expires, strconv.FormatBool(e.Encrypted), e.Nonce, e.KeyID, e.Text,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+type csvReader struct {
+	cr  *csv.Reader
+	col map[string]int
+}
+
+// newCSVReader reads the header row; columns are matched by name, and only
+// "text" is required.
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	if _, ok := col["text"]; !ok {
+		return nil, errors.New("csv header has no text column")
+	}
+	return &csvReader{cr: cr, col: col}, nil
+}
+
+func (r *csvReader) Next() (models.ClipboardUpdate, []byte, error) {
+	row, err := r.cr.Read()
+	if err != nil {
+		return models.ClipboardUpdate{}, nil, err
+	}
+	line, _ := r.cr.FieldPos(0)
+	get := func(name string) string {
+		if i, ok := r.col[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	e := models.ClipboardUpdate{
+		Channel:  get("channel"),
+		Text:     get("text"),
+		Source:   get("source"),
+		MimeType: get("mime_type"),
+		Nonce:    get("nonce"),
+		KeyID:    get("key_id"),
+	}
+	if tags := get("tags"); tags != "" {
+		e.Tags = strings.Split(tags, ",")
+	}
+	var bad string
+	parse := func(name string, fn func(string) error) {
+		if v := get(name); v != "" && bad == "" {
+			if fn(v) != nil {
+				bad = name
+			}
+		}
+	}
+	parse("updated_at", func(v string) (err error) { e.UpdatedAt, err = time.Parse(time.RFC3339Nano, v); return })
+	parse("expires_at", func(v string) error {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		e.ExpiresAt = &t
+		return err
+	})
+	parse("pinned", func(v string) (err error) { e.Pinned, err = strconv.ParseBool(v); return })
+	parse("sensitive", func(v string) (err error) { e.Sensitive, err = strconv.ParseBool(v); return })
+	parse("encrypted", func(v string) (err error) { e.Encrypted, err = strconv.ParseBool(v); return })
+	parse("id", func(v string) (err error) { e.ID, err = strconv.ParseInt(v, 10, 64); return })
+	parse("size", func(v string) (err error) { e.Size, err = strconv.ParseInt(v, 10, 64); return })
+	parse("copy_count", func(v string) (err error) { e.CopyCount, err = strconv.Atoi(v); return })
+	parse("width", func(v string) (err error) { e.Width, err = strconv.Atoi(v); return })
+	parse("height", func(v string) (err error) { e.Height, err = strconv.Atoi(v); return })
+	if bad != "" {
+		return models.ClipboardUpdate{}, nil, fmt.Errorf("line %d: invalid %s", line, bad)
+	}
+	return e, nil, nil
+}
@@ -0,0 +1,108 @@
+// Package export reads and writes clipboard history in portable formats: JSONL
+// (lossless, including binary payloads), CSV (text and metadata) and a Markdown
+// report (write only).
+package export
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"local-clipboard/internal/models"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	JSONL    Format = "jsonl"
+	CSV      Format = "csv"
+	Markdown Format = "markdown"
+)
+
+// ParseFormat parses a -format flag or ?format= value; "" is JSONL.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "", "jsonl", "ndjson":
+		return JSONL, nil
+	case "csv":
+		return CSV, nil
+	case "md", "markdown":
+		return Markdown, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want jsonl, csv or markdown)", s)
+}
+
+// FormatFromPath guesses the format from a file extension.
+func FormatFromPath(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return JSONL, true
+	case ".csv":
+		return CSV, true
+	case ".md", ".markdown":
+		return Markdown, true
+	}
+	return "", false
+}
+
+// ContentType is the MIME type to serve the format with.
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case Markdown:
+		return "text/markdown; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Ext is the file extension for the format, with the dot.
+func (f Format) Ext() string {
+	if f == Markdown {
+		return ".md"
+	}
+	return "." + string(f)
+}
+
+// Lossless reports whether the format keeps binary payloads, so writers want
+// the data of binary entries.
+func (f Format) Lossless() bool {
+	return f == JSONL
+}
+
+// Writer encodes entries in one format.
+type Writer interface {
+	// Write adds an entry; data is the payload of a binary entry, or nil.
+	Write(e models.ClipboardUpdate, data []byte) error
+	// Close writes what the format needs after the last entry and flushes.
+	Close() error
+}
+
+// NewWriter returns a Writer for f that writes to w.
+func NewWriter(w io.Writer, f Format) Writer {
+	switch f {
+	case CSV:
+		return newCSVWriter(w)
+	case Markdown:
+		return newMarkdownWriter(w)
+	}
+	return newJSONLWriter(w)
+}
+
+// Reader decodes entries; Next returns io.EOF after the last one.
+type Reader interface {
+	Next() (models.ClipboardUpdate, []byte, error)
+}
+
+// NewReader returns a Reader for f that reads from r. Markdown reports cannot be read back.
+func NewReader(r io.Reader, f Format) (Reader, error) {
+	switch f {
+	case JSONL:
+		return newJSONLReader(r), nil
+	case CSV:
+		return newCSVReader(r)
+	}
+	return nil, fmt.Errorf("cannot import %s; use a jsonl or csv export", f)
+}
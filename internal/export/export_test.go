@@ -0,0 +1,113 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+func sampleEntries() []models.ClipboardUpdate {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	expires := at.Add(time.Hour)
+	return []models.ClipboardUpdate{
+		{ID: 1, Channel: "default", Text: "hello, \"world\"\nsecond line", Source: "laptop", UpdatedAt: at, Pinned: true, CopyCount: 3, MimeType: models.MimeText, Size: 26, Tags: []string{"a", "b"}},
+		{ID: 2, Channel: "work", Text: "c2VjcmV0", Source: "phone", UpdatedAt: at, CopyCount: 1, MimeType: models.MimeText, Size: 8, Encrypted: true, Nonce: "bm9uY2U", KeyID: "k1", Sensitive: true, ExpiresAt: &expires},
+	}
+}
+
+func roundTrip(t *testing.T, f Format, entries []models.ClipboardUpdate, data [][]byte) ([]models.ClipboardUpdate, [][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, f)
+	for i, e := range entries {
+		if err := w.Write(e, data[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(&buf, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		got     []models.ClipboardUpdate
+		gotData [][]byte
+	)
+	for {
+		e, d, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+		gotData = append(gotData, d)
+	}
+	return got, gotData
+}
+
+func TestJSONLRoundTrip(t *testing.T) {
+	entries := append(sampleEntries(), models.ClipboardUpdate{ID: 3, Channel: "default", Source: "laptop", UpdatedAt: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), CopyCount: 1, MimeType: "image/png", Size: 4, Width: 1, Height: 1})
+	data := [][]byte{nil, nil, {0x89, 'P', 'N', 'G'}}
+	got, gotData := roundTrip(t, JSONL, entries, data)
+	if !reflect.DeepEqual(got, entries) || !reflect.DeepEqual(gotData, data) {
+		t.Fatalf("JSONL round trip:\n got %+v %v\nwant %+v %v", got, gotData, entries, data)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	entries := sampleEntries()
+	got, _ := roundTrip(t, CSV, entries, make([][]byte, len(entries)))
+	if !reflect.DeepEqual(got, entries) {
+		t.Fatalf("CSV round trip:\n got %+v\nwant %+v", got, entries)
+	}
+}
+
+func TestCSVReaderErrors(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("id,source\n1,a\n"), CSV); err == nil {
+		t.Fatal("expected an error for a header without text")
+	}
+	r, err := NewReader(strings.NewReader("text,pinned\nok,true\nbad,maybe\n"), CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, _, err := r.Next(); err != nil || e.Text != "ok" || !e.Pinned {
+		t.Fatalf("first row = %+v (%v)", e, err)
+	}
+	if _, _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "line 3: invalid pinned") {
+		t.Fatalf("second row: err = %v", err)
+	}
+}
+
+func TestMarkdownReport(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Markdown)
+	entries := sampleEntries()
+	entries[0].Text = "run ```make```"
+	for _, e := range entries {
+		if err := w.Write(e, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"## Channel default", "## Channel work", "pinned · copied 3 times · `#a` · `#b`", "````\nrun ```make```\n````", "_End-to-end encrypted_", "2 entries, exported"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report lacks %q:\n%s", want, out)
+		}
+	}
+	if _, err := NewReader(&buf, Markdown); err == nil {
+		t.Fatal("markdown reports must not be importable")
+	}
+}
@@ -0,0 +1,71 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"local-clipboard/internal/models"
+)
+
+// record is one JSONL line: the entry as the API returns it, plus the base64
+// payload of binary entries.
+type record struct {
+	models.ClipboardUpdate
+	Data []byte `json:"data,omitempty"`
+}
+
+type jsonlWriter struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{bw: bw, enc: enc}
+}
+
+func (w *jsonlWriter) Write(e models.ClipboardUpdate, data []byte) error {
+	return w.enc.Encode(record{ClipboardUpdate: e, Data: data})
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.bw.Flush()
+}
+
+type jsonlReader struct {
+	br   *bufio.Reader
+	line int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	return &jsonlReader{br: bufio.NewReader(r)}
+}
+
+// Next decodes the next non-empty line. Lines are read whole since a binary
+// entry's payload can make them megabytes long.
+func (r *jsonlReader) Next() (models.ClipboardUpdate, []byte, error) {
+	for {
+		line, err := r.br.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if errors.Is(err, io.EOF) {
+				return models.ClipboardUpdate{}, nil, io.EOF
+			}
+			return models.ClipboardUpdate{}, nil, err
+		}
+		r.line++
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return models.ClipboardUpdate{}, nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return rec.ClipboardUpdate, rec.Data, nil
+	}
+}
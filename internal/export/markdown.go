@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// markdownWriter writes a human-readable report: a section per channel and a
+// fenced block per text entry.
+type markdownWriter struct {
+	bw      *bufio.Writer
+	channel string
+	count   int
+}
+
+func newMarkdownWriter(w io.Writer) *markdownWriter {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Clipboard history\n")
+	return &markdownWriter{bw: bw}
+}
+
+func (w *markdownWriter) Write(e models.ClipboardUpdate, _ []byte) error {
+	if ch := e.ChannelName(); ch != w.channel || w.count == 0 {
+		w.channel = ch
+		fmt.Fprintf(w.bw, "\n## Channel %s\n", ch)
+	}
+	w.count++
+	fmt.Fprintf(w.bw, "\n### %s · %s\n\n", e.UpdatedAt.UTC().Format("2006-01-02 15:04 UTC"), e.Source)
+	var meta []string
+	if e.Pinned {
+		meta = append(meta, "pinned")
+	}
+	if e.CopyCount > 1 {
+		meta = append(meta, fmt.Sprintf("copied %d times", e.CopyCount))
+	}
+	if e.Sensitive {
+		meta = append(meta, "sensitive")
+	}
+	for _, t := range e.Tags {
+		meta = append(meta, "`#"+t+"`")
+	}
+	if len(meta) > 0 {
+		fmt.Fprintf(w.bw, "%s\n\n", strings.Join(meta, " · "))
+	}
+	switch {
+	case e.Encrypted:
+		w.bw.WriteString("_End-to-end encrypted_\n")
+	case e.IsBlob():
+		desc := fmt.Sprintf("%s, %d bytes", e.MimeType, e.Size)
+		if e.Width > 0 && e.Height > 0 {
+			desc += fmt.Sprintf(", %d×%d", e.Width, e.Height)
+		}
+		fmt.Fprintf(w.bw, "_%s_\n", desc)
+	default:
+		fence := codeFence(e.Text)
+		fmt.Fprintf(w.bw, "%s\n%s\n%s\n", fence, e.Text, fence)
+	}
+	return nil
+}
+
+func (w *markdownWriter) Close() error {
+	fmt.Fprintf(w.bw, "\n---\n\n%d entries, exported %s.\n", w.count, time.Now().UTC().Format("2006-01-02 15:04 UTC"))
+	return w.bw.Flush()
+}
+
+// codeFence returns a backtick fence longer than any backtick run in text.
+func codeFence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
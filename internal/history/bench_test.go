@@ -0,0 +1,110 @@
+package history
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"local-clipboard/internal/models"
+)
+
+// Benchmarks compare the in-process DBHistory with the sqlite3 CLI-backed SqliteHistory.
+// Run with: go test ./internal/history -bench . -benchmem
+
+// benchHistory is the subset of History both backends implement.
+type benchHistory interface {
+	Insert(e models.ClipboardUpdate) (models.ClipboardUpdate, error)
+	Latest(channel string) (models.ClipboardUpdate, error)
+	List(q Query) (Page, error)
+}
+
+func benchBackends(b *testing.B, run func(b *testing.B, h benchHistory)) {
+	b.Run("db", func(b *testing.B) {
+		run(b, newTestDB(b))
+	})
+	b.Run("cli", func(b *testing.B) {
+		if _, err := exec.LookPath("sqlite3"); err != nil {
+			b.Skip("sqlite3 not installed")
+		}
+		h := NewSqlite(b.TempDir() + "/bench.db")
+		if err := h.Init(); err != nil {
+			b.Fatal(err)
+		}
+		run(b, cliBench{h})
+	})
+}
+
+// cliBench adapts SqliteHistory, which has no channels and a text-only Insert, to benchHistory.
+type cliBench struct{ *SqliteHistory }
+
+func (c cliBench) Insert(e models.ClipboardUpdate) (models.ClipboardUpdate, error) {
+	return c.SqliteHistory.Insert(e.Text, e.Source)
+}
+
+func (c cliBench) Latest(string) (models.ClipboardUpdate, error) {
+	return c.SqliteHistory.Latest()
+}
+
+func (c cliBench) List(q Query) (Page, error) {
+	items, err := c.SqliteHistory.List(q.Limit, q.Search)
+	return Page{Items: items, Total: len(items)}, err
+}
+
+func seed(b *testing.B, h benchHistory, n int) {
+	b.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := h.Insert(models.ClipboardUpdate{Text: fmt.Sprintf("seed entry %d with some text", i), Source: "bench"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	benchBackends(b, func(b *testing.B, h benchHistory) {
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Unique text, so every iteration inserts a row rather than updating one.
+			if _, err := h.Insert(models.ClipboardUpdate{Text: fmt.Sprintf("benchmark clipboard text %d", i), Source: "bench"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkList(b *testing.B) {
+	benchBackends(b, func(b *testing.B, h benchHistory) {
+		seed(b, h, 200)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := h.List(Query{Channel: models.DefaultChannel, Limit: 50}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSearch(b *testing.B) {
+	benchBackends(b, func(b *testing.B, h benchHistory) {
+		seed(b, h, 200)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := h.List(Query{Channel: models.DefaultChannel, Limit: 50, Search: "entry 1"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkParallelReads(b *testing.B) {
+	benchBackends(b, func(b *testing.B, h benchHistory) {
+		seed(b, h, 200)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := h.Latest(models.DefaultChannel); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,652 @@
+package history
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"local-clipboard/internal/models"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go driver, keeps CGO_ENABLED=0 builds working
+)
+
+const maxOpenConns = 4
+
+// DBHistory implements History with an in-process, pooled SQLite connection
+// and prepared statements.
+type DBHistory struct {
+	path string
+	db   *sql.DB
+
+	insertStmt    *sql.Stmt
+	setPinnedStmt *sql.Stmt
+	deleteStmt    *sql.Stmt
+	latestStmt    *sql.Stmt
+	recentStmt    *sql.Stmt
+	byIDStmt      *sql.Stmt
+	consumeStmt   *sql.Stmt
+	blobStmt      *sql.Stmt
+	channelsStmt  *sql.Stmt
+}
+
+// liveCond selects entries that have neither expired nor used up their reads;
+// everything else is invisible until DeleteExpired removes it.
+const liveCond = "(expires_at IS NULL OR julianday(expires_at) > julianday('now')) AND (max_reads=0 OR reads < max_reads)"
+
+// NewDB returns a new DBHistory for the given database path. Call Init before use.
+func NewDB(path string) *DBHistory {
+	return &DBHistory{path: path}
+}
+
+// Init opens the database, applies pending schema migrations (see Migrate) and
+// prepares statements. It fails with ErrSchemaTooNew for a database written by a
+// newer version.
+func (s *DBHistory) Init() error {
+	db, err := openDB(s.path)
+	if err != nil {
+		return err
+	}
+	if _, err := migrate(db); err != nil {
+		db.Close()
+		return err
+	}
+	s.db = db
+	if err := s.prepare(); err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+// openDB opens the connection pool for the database at path.
+func openDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxOpenConns)
+	return db, nil
+}
+
+// backfillHashes sets content_hash on existing rows. Only the newest copy of
+// duplicated content gets the hash; older duplicates keep NULL, which the unique
+// index allows, so existing history is left as it was.
+func backfillHashes(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT h.id, h.channel, h.mime_type, h.text, b.data FROM clipboard_history h
+		LEFT JOIN clipboard_blobs b ON b.entry_id = h.id WHERE h.encrypted=0 ORDER BY h.id DESC`)
+	if err != nil {
+		return err
+	}
+	hashes := map[int64]string{}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var (
+			id                  int64
+			channel, mime, text string
+			data                []byte
+		)
+		if err := rows.Scan(&id, &channel, &mime, &text, &data); err != nil {
+			rows.Close()
+			return err
+		}
+		if data == nil {
+			data = []byte(text)
+		}
+		hash := contentHash(mime, data)
+		if !seen[channel+"\x00"+hash] {
+			seen[channel+"\x00"+hash] = true
+			hashes[id] = hash
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, hash := range hashes {
+		if _, err := tx.Exec("UPDATE clipboard_history SET content_hash=? WHERE id=?", hash, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentHash identifies an entry's content for deduplication: the SHA-256 of
+// its MIME type and payload.
+func contentHash(mimeType string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(mimeType))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ftsTriggers keep clipboard_fts (an external-content FTS5 index over
+// clipboard_history.text) in sync. Encrypted rows are never indexed; the
+// "delete" commands must mirror that or the index is corrupted.
+const ftsTriggers = `
+CREATE TRIGGER IF NOT EXISTS clipboard_fts_ai AFTER INSERT ON clipboard_history BEGIN
+	INSERT INTO clipboard_fts(rowid, text) SELECT new.id, new.text WHERE new.encrypted=0;
+END;
+CREATE TRIGGER IF NOT EXISTS clipboard_fts_ad AFTER DELETE ON clipboard_history BEGIN
+	INSERT INTO clipboard_fts(clipboard_fts, rowid, text) SELECT 'delete', old.id, old.text WHERE old.encrypted=0;
+END;
+CREATE TRIGGER IF NOT EXISTS clipboard_fts_au AFTER UPDATE OF text, encrypted ON clipboard_history BEGIN
+	INSERT INTO clipboard_fts(clipboard_fts, rowid, text) SELECT 'delete', old.id, old.text WHERE old.encrypted=0;
+	INSERT INTO clipboard_fts(rowid, text) SELECT new.id, new.text WHERE new.encrypted=0;
+END;`
+
+// initFTS creates the full-text index and its triggers, backfilling the index
+// from existing rows when it is created for an older database.
+func initFTS(tx *sql.Tx) error {
+	var exists int
+	if err := tx.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name='clipboard_fts'").Scan(&exists); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS clipboard_fts USING fts5(
+		text, content='clipboard_history', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+	)`); err != nil {
+		return err
+	}
+	if exists == 0 {
+		if _, err := tx.Exec("INSERT INTO clipboard_fts(rowid, text) SELECT id, text FROM clipboard_history WHERE encrypted=0"); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(ftsTriggers)
+	return err
+}
+
+// dsn builds the driver DSN: WAL so readers don't block the writer, and a busy
+// timeout so concurrent writers on the pool wait instead of failing. The path
+// is escaped, so names with ?, # or % open the file they name.
+func dsn(path string) string {
+	q := url.Values{}
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "synchronous(NORMAL)")
+	q.Add("_txlock", "immediate")
+	return (&url.URL{Scheme: "file", Path: path, OmitHost: true, RawQuery: q.Encode()}).String()
+}
+
+func (s *DBHistory) prepare() error {
+	const cols = "SELECT " + entryColumns + " FROM clipboard_history"
+	stmts := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		// Content already in the channel is moved to the top (seq) and counted
+		// again instead of being added twice. The new copy's lifetime replaces
+		// the old one, so an expired row not yet swept comes back to life; a
+		// pinned entry keeps its own lifetime, so copying it again cannot give it
+		// a TTL. Burn-after-read entries have no content_hash and are never
+		// merged, so max_reads is 0 on both sides here.
+		{&s.insertStmt, `INSERT INTO clipboard_history(channel,text,source,updated_at,pinned,mime_type,size,width,height,encrypted,nonce,key_id,sensitive,expires_at,max_reads,content_hash,copy_count,seq)
+			VALUES(?,?,?,?,0,?,?,?,?,?,?,?,?,?,?,?,1,(SELECT coalesce(max(seq),0)+1 FROM clipboard_history))
+			ON CONFLICT(channel, content_hash) DO UPDATE SET updated_at=excluded.updated_at, source=excluded.source, copy_count=copy_count+1, seq=excluded.seq,
+				sensitive=max(sensitive, excluded.sensitive),
+				expires_at=CASE WHEN pinned THEN expires_at ELSE excluded.expires_at END,
+				max_reads=excluded.max_reads, reads=0
+			RETURNING ` + entryColumns},
+		{&s.setPinnedStmt, "UPDATE clipboard_history SET pinned=? WHERE id=?"},
+		{&s.deleteStmt, "DELETE FROM clipboard_history WHERE id=?"},
+		{&s.latestStmt, cols + " WHERE channel=? AND " + liveCond + " ORDER BY pinned DESC, seq DESC LIMIT 1"},
+		{&s.recentStmt, cols + " WHERE channel=? AND " + liveCond + " ORDER BY seq DESC LIMIT 1"},
+		{&s.byIDStmt, cols + " WHERE id=? AND " + liveCond + " LIMIT 1"},
+		{&s.consumeStmt, "UPDATE clipboard_history SET reads=reads+1 WHERE id=? AND " + liveCond + " RETURNING " + entryColumns},
+		{&s.blobStmt, "SELECT data FROM clipboard_blobs WHERE entry_id=?"},
+		{&s.channelsStmt, "SELECT DISTINCT channel FROM clipboard_history ORDER BY channel"},
+	}
+	for _, st := range stmts {
+		p, err := s.db.Prepare(st.query)
+		if err != nil {
+			return fmt.Errorf("prepare %q: %w", st.query, err)
+		}
+		*st.dst = p
+	}
+	return nil
+}
+
+// DB returns the underlying connection pool so other components can keep their
+// tables in the same database file.
+func (s *DBHistory) DB() *sql.DB {
+	return s.db
+}
+
+// Stats is the size of the history database.
+type Stats struct {
+	Entries int64 // Rows in the history, including expired ones not yet swept
+	Bytes   int64 // Size of the database file and its write-ahead log
+}
+
+// Stats counts the history entries and measures the database files.
+func (s *DBHistory) Stats() (Stats, error) {
+	var st Stats
+	if err := s.db.QueryRow("SELECT count(*) FROM clipboard_history").Scan(&st.Entries); err != nil {
+		return Stats{}, err
+	}
+	for _, path := range []string{s.path, s.path + "-wal"} {
+		if fi, err := os.Stat(path); err == nil {
+			st.Bytes += fi.Size()
+		}
+	}
+	return st, nil
+}
+
+// Close releases prepared statements and the connection pool.
+func (s *DBHistory) Close() error {
+	for _, st := range []*sql.Stmt{s.insertStmt, s.setPinnedStmt, s.deleteStmt, s.latestStmt, s.recentStmt, s.byIDStmt, s.consumeStmt, s.blobStmt, s.channelsStmt} {
+		if st != nil {
+			st.Close()
+		}
+	}
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Insert adds a text entry and returns it with ID and timestamps. Text already
+// in the channel is not stored again: the existing entry is returned with its
+// updated_at, source and CopyCount updated. Encrypted and burn-after-read
+// entries are never merged; the same text encrypts differently every time, and
+// a burn-after-read entry must not take over one that is kept. e.Tags are added
+// to the entry's tags.
+func (s *DBHistory) Insert(e models.ClipboardUpdate) (models.ClipboardUpdate, error) {
+	var hash any
+	if !e.Encrypted && e.MaxReads == 0 {
+		hash = contentHash(models.MimeText, []byte(e.Text))
+	}
+	return s.insertTagged(e.Tags, nil, e.ChannelName(), e.Text, e.Source, time.Now().UTC().Format(time.RFC3339Nano), models.MimeText, len(e.Text), 0, 0, e.Encrypted, e.Nonce, e.KeyID, e.Sensitive, formatExpiry(e.ExpiresAt), e.MaxReads, hash)
+}
+
+// insertTagged runs insertStmt with args in a transaction, stores data as the
+// blob of a new entry (when not nil) and adds tags.
+func (s *DBHistory) insertTagged(tags []string, data []byte, args ...any) (models.ClipboardUpdate, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	defer tx.Rollback()
+	e, err := scanEntry(tx.Stmt(s.insertStmt).QueryRow(args...))
+	if err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	if data != nil && e.CopyCount == 1 {
+		if _, err := tx.Exec("INSERT INTO clipboard_blobs(entry_id,data) VALUES(?,?)", e.ID, data); err != nil {
+			return models.ClipboardUpdate{}, err
+		}
+	}
+	if err := addTags(tx, e.ID, tags); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	one := []models.ClipboardUpdate{e}
+	if err := attachTags(tx, one); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	return one[0], nil
+}
+
+// formatExpiry returns the expires_at column value for t (NULL when unset).
+func formatExpiry(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// InsertBlob adds a binary entry: metadata goes to clipboard_history and the
+// payload to clipboard_blobs, in one transaction. Like Insert, a payload already
+// in the channel returns the existing entry.
+func (s *DBHistory) InsertBlob(meta models.ClipboardUpdate, data []byte) (models.ClipboardUpdate, error) {
+	if data == nil {
+		data = []byte{}
+	}
+	return s.insertTagged(meta.Tags, data, meta.ChannelName(), "", meta.Source, time.Now().UTC().Format(time.RFC3339Nano), meta.MimeType, len(data), meta.Width, meta.Height, false, "", "", meta.Sensitive, formatExpiry(meta.ExpiresAt), 0, contentHash(meta.MimeType, data))
+}
+
+// Blob returns the binary payload of the entry with the given id.
+func (s *DBHistory) Blob(id int64) ([]byte, error) {
+	var data []byte
+	err := s.blobStmt.QueryRow(id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNotFound
+	}
+	return data, err
+}
+
+// SetPinned sets the pinned flag for the given entry.
+func (s *DBHistory) SetPinned(id int64, pinned bool) error {
+	_, err := s.setPinnedStmt.Exec(pinned, id)
+	return err
+}
+
+// Delete removes the entry with the given id and its binary payload, if any.
+func (s *DBHistory) Delete(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Stmt(s.deleteStmt).Exec(id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM clipboard_blobs WHERE entry_id=?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Latest returns the most recent entry of channel (pinned first, then by id).
+func (s *DBHistory) Latest(channel string) (models.ClipboardUpdate, error) {
+	e, err := scanEntry(s.latestStmt.QueryRow(channel))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNoRows
+	}
+	return s.withTags(e, err)
+}
+
+// MostRecent returns the most recently copied live entry of channel, pinned or
+// not. It is what the clipboard falls back to when its entry expires or is
+// deleted.
+func (s *DBHistory) MostRecent(channel string) (models.ClipboardUpdate, error) {
+	e, err := scanEntry(s.recentStmt.QueryRow(channel))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNoRows
+	}
+	return s.withTags(e, err)
+}
+
+// ByID returns the entry with the given id.
+func (s *DBHistory) ByID(id int64) (models.ClipboardUpdate, error) {
+	e, err := scanEntry(s.byIDStmt.QueryRow(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNotFound
+	}
+	return s.withTags(e, err)
+}
+
+// Consume counts one read of the entry with the given id and returns it, with
+// Reads including this one. It fails once the entry has expired or its reads are used up.
+func (s *DBHistory) Consume(id int64) (models.ClipboardUpdate, error) {
+	e, err := scanEntry(s.consumeStmt.QueryRow(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNotFound
+	}
+	return s.withTags(e, err)
+}
+
+// List returns a page of entries matching q. A non-empty q.Search is an FTS5
+// query (words, "phrases", prefix*, AND/OR/NOT); results are ranked by bm25 with
+// pinned entries first and carry a highlighted Snippet. Encrypted entries never match.
+func (s *DBHistory) List(q Query) (Page, error) {
+	if q.Search != "" {
+		page, err := s.list(q)
+		if err != nil && !errors.Is(err, ErrInvalidCursor) {
+			// Most likely not valid FTS5 syntax (e.g. an unbalanced quote):
+			// search for the words literally instead.
+			q.Search = literalQuery(q.Search)
+			page, err = s.list(q)
+		}
+		return page, err
+	}
+	return s.list(q)
+}
+
+// list builds the query for q. Plain listings page with a keyset cursor on
+// (pinned, seq); ranked searches and SortFrequent cannot, so their cursor is an offset.
+func (s *DBHistory) list(q Query) (Page, error) {
+	var (
+		where []string
+		args  []any
+	)
+	cond := func(c string, a ...any) {
+		where = append(where, c)
+		args = append(args, a...)
+	}
+	from := "clipboard_history h"
+	cols := qualify("h", entryColumns) + ", h.seq"
+	order := []string{"h.pinned DESC", "h.seq DESC"}
+	if q.Search != "" {
+		// CROSS JOIN keeps SQLite from scanning the channel and running the
+		// MATCH once per row: the FTS index is searched once, then joined.
+		from = "clipboard_fts CROSS JOIN clipboard_history h ON h.id = clipboard_fts.rowid"
+		cols += ", snippet(clipboard_fts, 0, char(2), char(3), '…', 16)"
+		order = []string{"h.pinned DESC", "bm25(clipboard_fts)", "h.seq DESC"}
+		cond("clipboard_fts MATCH ?", q.Search)
+		if !q.IncludeSensitive {
+			cond("h.sensitive=0")
+		}
+	}
+	offsetCursor := q.Search != ""
+	if q.Sort == SortFrequent {
+		order = append([]string{order[0], "h.copy_count DESC"}, order[1:]...)
+		offsetCursor = true
+	}
+	cond("h.channel=?", q.Channel)
+	// Burn-after-read entries are only handed out (and counted) by Consume.
+	cond("h.max_reads=0 AND " + liveCond)
+	if q.BeforeID > 0 {
+		// The same (pinned, seq) keyset as the cursor, anchored on that entry.
+		cond("EXISTS (SELECT 1 FROM clipboard_history b WHERE b.id=? AND (h.pinned < b.pinned OR (h.pinned = b.pinned AND h.seq < b.seq)))", q.BeforeID)
+	}
+	if q.Source != "" {
+		cond("h.source=?", q.Source)
+	}
+	if q.Tag != "" {
+		cond("h.id IN (SELECT et.entry_id FROM clipboard_entry_tags et JOIN clipboard_tags t ON t.id = et.tag_id WHERE t.name=?)", q.Tag)
+	}
+	if q.Pinned != nil {
+		cond("h.pinned=?", *q.Pinned)
+	}
+	if !q.Since.IsZero() {
+		cond("julianday(h.updated_at) >= julianday(?)", q.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		cond("julianday(h.updated_at) < julianday(?)", q.Until.UTC().Format(time.RFC3339Nano))
+	}
+	if q.MinSize > 0 {
+		cond("h.size >= ?", q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		cond("h.size <= ?", q.MaxSize)
+	}
+
+	page := Page{Items: []models.ClipboardUpdate{}}
+	filter := " WHERE " + strings.Join(where, " AND ")
+	if err := s.db.QueryRow("SELECT count(*) FROM "+from+filter, args...).Scan(&page.Total); err != nil {
+		return Page{}, err
+	}
+
+	c, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+	offset := 0
+	switch {
+	case c.offset > 0:
+		offset = c.offset
+	case c.seq > 0:
+		filter += " AND (h.pinned < ? OR (h.pinned = ? AND h.seq < ?))"
+		args = append(args, c.pinned, c.pinned, c.seq)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	// One extra row tells whether there is a next page.
+	rows, err := s.db.Query("SELECT "+cols+" FROM "+from+filter+" ORDER BY "+strings.Join(order, ", ")+" LIMIT ? OFFSET ?", append(args, limit+1, offset)...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+	var seqs []int64
+	for rows.Next() {
+		var (
+			e       models.ClipboardUpdate
+			seq     int64
+			snippet string
+			err     error
+		)
+		if q.Search != "" {
+			e, err = scanEntry(rows, &seq, &snippet)
+		} else {
+			e, err = scanEntry(rows, &seq)
+		}
+		if err != nil {
+			return Page{}, err
+		}
+		e.Snippet = snippet
+		page.Items = append(page.Items, e)
+		seqs = append(seqs, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+	rows.Close()
+	if err := attachTags(s.db, page.Items); err != nil {
+		return Page{}, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		if offsetCursor {
+			page.NextCursor = encodeCursor(cursor{offset: offset + limit})
+		} else {
+			page.NextCursor = encodeCursor(cursor{pinned: page.Items[limit-1].Pinned, seq: seqs[limit-1]})
+		}
+	}
+	return page, nil
+}
+
+// cursor is the position after the last entry of a page: its (pinned, seq) key
+// for plain listings, or the number of rows already returned otherwise.
+type cursor struct {
+	pinned bool
+	seq    int64
+	offset int
+}
+
+func encodeCursor(c cursor) string {
+	var raw string
+	if c.offset > 0 {
+		raw = "o:" + strconv.Itoa(c.offset)
+	} else {
+		p := "0"
+		if c.pinned {
+			p = "1"
+		}
+		raw = "k:" + p + ":" + strconv.FormatInt(c.seq, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	if s == "" {
+		return cursor{}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(b), ":")
+	switch {
+	case len(parts) == 2 && parts[0] == "o":
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n <= 0 {
+			return cursor{}, ErrInvalidCursor
+		}
+		return cursor{offset: n}, nil
+	case len(parts) == 3 && parts[0] == "k" && (parts[1] == "0" || parts[1] == "1"):
+		seq, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || seq <= 0 {
+			return cursor{}, ErrInvalidCursor
+		}
+		return cursor{pinned: parts[1] == "1", seq: seq}, nil
+	}
+	return cursor{}, ErrInvalidCursor
+}
+
+// literalQuery turns free text into an FTS5 query that matches all of its words,
+// with any operators or quotes taken literally.
+func literalQuery(q string) string {
+	fields := strings.Fields(q)
+	for i, f := range fields {
+		fields[i] = `"` + strings.ReplaceAll(f, `"`, `""`) + `"`
+	}
+	return strings.Join(fields, " ")
+}
+
+// Channels returns the names of channels that have at least one entry.
+func (s *DBHistory) Channels() ([]string, error) {
+	rows, err := s.channelsStmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// E2ESalt returns the random salt of this database that clients derive their
+// end-to-end encryption key with (see e2e.NewBox). It is not secret.
+func (s *DBHistory) E2ESalt() (string, error) {
+	var salt string
+	err := s.db.QueryRow("SELECT value FROM settings WHERE name='e2e_salt'").Scan(&salt)
+	return salt, err
+}
+
+const entryColumns = "id,channel,text,source,updated_at,pinned,copy_count,mime_type,size,width,height,encrypted,nonce,key_id,sensitive,expires_at,max_reads,reads"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// qualify prefixes each column in the comma-separated list cols with table.
+func qualify(table, cols string) string {
+	parts := strings.Split(cols, ",")
+	for i, c := range parts {
+		parts[i] = table + "." + c
+	}
+	return strings.Join(parts, ",")
+}
+
+// scanEntry scans entryColumns, followed by any extra columns into extra.
+func scanEntry(r rowScanner, extra ...any) (models.ClipboardUpdate, error) {
+	var (
+		e         models.ClipboardUpdate
+		updatedAt string
+		expiresAt sql.NullString
+	)
+	dest := append([]any{&e.ID, &e.Channel, &e.Text, &e.Source, &updatedAt, &e.Pinned, &e.CopyCount, &e.MimeType, &e.Size, &e.Width, &e.Height, &e.Encrypted, &e.Nonce, &e.KeyID, &e.Sensitive, &expiresAt, &e.MaxReads, &e.Reads}, extra...)
+	if err := r.Scan(dest...); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	e.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updatedAt)
+	if expiresAt.Valid {
+		if t, err := time.Parse(time.RFC3339Nano, expiresAt.String); err == nil {
+			e.ExpiresAt = &t
+		}
+	}
+	return e, nil
+}
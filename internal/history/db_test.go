@@ -0,0 +1,854 @@
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+func newTestDB(tb testing.TB) *DBHistory {
+	tb.Helper()
+	h := NewDB(tb.TempDir() + "/test.db")
+	if err := h.Init(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestDBHistoryPathWithURICharacters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip?board#1 100%.db")
+	h := NewDB(path)
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if _, err := h.Insert(models.ClipboardUpdate{Text: "hello", Source: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("database not created at its path: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "clip")); err == nil {
+		t.Fatal("path was cut at the ?")
+	}
+}
+
+func TestDBHistoryRoundTrip(t *testing.T) {
+	h := newTestDB(t)
+	text := "line one\nit's 100% \"quoted\"\ttab"
+	e, err := h.Insert(models.ClipboardUpdate{Text: text, Source: "src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := h.ByID(e.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != text || got.Source != "src" || got.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected entry: %+v", got)
+	}
+	if err := h.SetPinned(e.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Insert(models.ClipboardUpdate{Text: "newer", Source: "src"}); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := h.Latest(models.DefaultChannel)
+	if err != nil || latest.ID != e.ID || !latest.Pinned {
+		t.Fatalf("expected pinned entry first, got %+v (%v)", latest, err)
+	}
+	if err := h.Delete(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.ByID(e.ID); err == nil {
+		t.Fatal("expected not found after delete")
+	}
+}
+
+func TestDBHistoryFullTextSearch(t *testing.T) {
+	h := newTestDB(t)
+	insert := func(text string) models.ClipboardUpdate {
+		t.Helper()
+		e, err := h.Insert(models.ClipboardUpdate{Text: text, Source: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	deploy := insert("kubectl rollout restart deployment/web")
+	insert("restart the router tomorrow")
+	insert("quarterly report draft")
+	gone := insert("delete me restart")
+	_, _ = h.Insert(models.ClipboardUpdate{Text: "c2VjcmV0IHJlc3RhcnQ=", Source: "a", Encrypted: true, Nonce: "n", KeyID: "k"})
+	if err := h.Delete(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+	router := insert("Router password is café")
+	if err := h.SetPinned(router.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for q, want := range map[string][]string{
+		"restart":              {"restart the router tomorrow", "kubectl rollout restart deployment/web"},
+		`"rollout restart"`:    {"kubectl rollout restart deployment/web"},
+		"quart*":               {"quarterly report draft"},
+		"restart NOT router":   {"kubectl rollout restart deployment/web"},
+		"router OR report":     {"Router password is café", "restart the router tomorrow", "quarterly report draft"},
+		"cafe":                 {"Router password is café"},
+		`"restart`:             {"restart the router tomorrow", "kubectl rollout restart deployment/web"},
+		"c2VjcmV0IHJlc3RhcnQ=": nil,
+	} {
+		page, err := h.List(Query{Channel: models.DefaultChannel, Limit: 10, Search: q})
+		if err != nil {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		var texts []string
+		for _, e := range page.Items {
+			texts = append(texts, e.Text)
+		}
+		if strings.Join(texts, "|") != strings.Join(want, "|") && !sameSet(texts, want) {
+			t.Fatalf("search %q: got %q, want %q", q, texts, want)
+		}
+	}
+
+	page, err := h.List(Query{Channel: models.DefaultChannel, Limit: 10, Search: "router OR report"})
+	if err != nil || len(page.Items) == 0 || page.Items[0].ID != router.ID {
+		t.Fatalf("pinned entry should rank first: %+v (%v)", page, err)
+	}
+	page, _ = h.List(Query{Channel: models.DefaultChannel, Limit: 10, Search: "deployment"})
+	got := page.Items
+	if len(got) != 1 || got[0].ID != deploy.ID || !strings.Contains(got[0].Snippet, models.SnippetMatchStart+"deployment"+models.SnippetMatchEnd) {
+		t.Fatalf("unexpected snippet: %+v", got)
+	}
+}
+
+// sameSet reports whether a and b hold the same strings, ignoring order (for
+// results whose bm25 scores tie).
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[string]int{}
+	for _, s := range a {
+		seen[s]++
+	}
+	for _, s := range b {
+		seen[s]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDBHistoryBackfillsSearchIndex(t *testing.T) {
+	path := t.TempDir() + "/old.db"
+	// A database from before the full-text index existed.
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Exec(`CREATE TABLE clipboard_history (id INTEGER PRIMARY KEY AUTOINCREMENT, text TEXT NOT NULL, source TEXT NOT NULL, updated_at TEXT NOT NULL, pinned INTEGER NOT NULL DEFAULT 0);
+		INSERT INTO clipboard_history(text,source,updated_at) VALUES('legacy entry about invoices','a','2024-01-01T00:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	h := NewDB(path)
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	page, err := h.List(Query{Channel: models.DefaultChannel, Limit: 10, Search: "invoice*"})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Text != "legacy entry about invoices" {
+		t.Fatalf("existing rows not indexed: %+v (%v)", page, err)
+	}
+}
+
+func TestDBHistoryChannelsAreIndependent(t *testing.T) {
+	h := newTestDB(t)
+	_, _ = h.Insert(models.ClipboardUpdate{Text: "home", Source: "a"})
+	work, err := h.Insert(models.ClipboardUpdate{Channel: "work", Text: "work", Source: "a"})
+	if err != nil || work.Channel != "work" {
+		t.Fatalf("insert into channel: %+v (%v)", work, err)
+	}
+	if latest, err := h.Latest(models.DefaultChannel); err != nil || latest.Text != "home" {
+		t.Fatalf("default latest = %+v (%v)", latest, err)
+	}
+	page, err := h.List(Query{Channel: "work", Limit: 10})
+	if err != nil || len(page.Items) != 1 || page.Items[0].ID != work.ID {
+		t.Fatalf("work list = %+v (%v)", page, err)
+	}
+	channels, err := h.Channels()
+	if err != nil || strings.Join(channels, ",") != "default,work" {
+		t.Fatalf("channels = %v (%v)", channels, err)
+	}
+}
+
+func TestDBHistoryConcurrentInserts(t *testing.T) {
+	h := newTestDB(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, err := h.Insert(models.ClipboardUpdate{Text: fmt.Sprintf("worker %d entry %d", i, j), Source: "worker"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	page, err := h.List(Query{Channel: models.DefaultChannel, Limit: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 200 || page.Total != 200 {
+		t.Fatalf("expected 200 rows, got %d (total %d)", len(page.Items), page.Total)
+	}
+}
+
+func TestDBHistoryPaginationAndFilters(t *testing.T) {
+	h := newTestDB(t)
+	var ids []int64
+	for i := 0; i < 7; i++ {
+		source := "laptop"
+		if i%2 == 1 {
+			source = "phone"
+		}
+		e, err := h.Insert(models.ClipboardUpdate{Text: strings.Repeat("x", i+1), Source: source})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if err := h.SetPinned(ids[1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Walk all pages: pinned entry first, then newest to oldest, no duplicates.
+	var seen []int64
+	q := Query{Channel: models.DefaultChannel, Limit: 3}
+	for {
+		page, err := h.List(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 7 {
+			t.Fatalf("total = %d, want 7", page.Total)
+		}
+		for _, e := range page.Items {
+			seen = append(seen, e.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	want := []int64{ids[1], ids[6], ids[5], ids[4], ids[3], ids[2], ids[0]}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Fatalf("pages = %v, want %v", seen, want)
+	}
+
+	unpinned := false
+	page, err := h.List(Query{Channel: models.DefaultChannel, Limit: 10, Source: "phone", Pinned: &unpinned, MinSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Items) != 2 || page.Items[0].ID != ids[5] || page.Items[1].ID != ids[3] {
+		t.Fatalf("filtered page = %+v", page)
+	}
+	page, err = h.List(Query{Channel: models.DefaultChannel, Limit: 10, BeforeID: ids[4], Until: time.Now().Add(time.Minute), Since: time.Now().Add(-time.Hour)})
+	if err != nil || page.Total != 3 || page.Items[0].ID != ids[3] {
+		t.Fatalf("before_id/date filter = %+v (%v)", page, err)
+	}
+	// before_id follows the listing order: entries after a pinned one are all
+	// the unpinned ones, and a re-copied entry moves ahead of newer ids.
+	if page, err = h.List(Query{Channel: models.DefaultChannel, Limit: 10, BeforeID: ids[1]}); err != nil || page.Total != 6 {
+		t.Fatalf("before_id of a pinned entry = %+v (%v)", page, err)
+	}
+	if _, err := h.Insert(models.ClipboardUpdate{Text: "x", Source: "laptop"}); err != nil {
+		t.Fatal(err)
+	}
+	page, err = h.List(Query{Channel: models.DefaultChannel, Limit: 10, BeforeID: ids[6]})
+	if err != nil || page.Total != 4 || page.Items[0].ID != ids[5] || page.Items[3].ID != ids[2] {
+		t.Fatalf("before_id after a re-copy = %+v (%v)", page, err)
+	}
+	if page, err = h.List(Query{Channel: models.DefaultChannel, Limit: 10, BeforeID: 9999}); err != nil || page.Total != 0 {
+		t.Fatalf("before_id of a missing entry = %+v (%v)", page, err)
+	}
+	page, err = h.List(Query{Channel: models.DefaultChannel, Limit: 4, Search: "xxxxxxx OR x OR xx"})
+	if err != nil || len(page.Items) != 3 || page.NextCursor != "" {
+		t.Fatalf("search page = %+v (%v)", page, err)
+	}
+	first, _ := h.List(Query{Channel: models.DefaultChannel, Limit: 2, Search: "xxxxxxx OR x OR xx"})
+	second, err := h.List(Query{Channel: models.DefaultChannel, Limit: 2, Search: "xxxxxxx OR x OR xx", Cursor: first.NextCursor})
+	if err != nil || len(first.Items) != 2 || len(second.Items) != 1 || second.Items[0].ID == first.Items[0].ID || second.Items[0].ID == first.Items[1].ID {
+		t.Fatalf("search pages = %+v, %+v (%v)", first, second, err)
+	}
+	if _, err := h.List(Query{Channel: models.DefaultChannel, Cursor: "bogus"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestDBHistoryPrune(t *testing.T) {
+	h := newTestDB(t)
+	var ids []int64
+	for i := 0; i < 6; i++ {
+		e, err := h.Insert(models.ClipboardUpdate{Text: fmt.Sprintf("entry-%04d", i), Source: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+	blob, err := h.InsertBlob(models.ClipboardUpdate{Source: "a", MimeType: "image/png"}, make([]byte, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The two oldest entries are a week old; the oldest one is pinned.
+	if _, err := h.DB().Exec("UPDATE clipboard_history SET updated_at=? WHERE id IN (?,?)", time.Now().Add(-7*24*time.Hour).UTC().Format(time.RFC3339Nano), ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetPinned(ids[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := Retention{MaxAge: 24 * time.Hour, MaxEntries: 5, MaxBytes: 135}
+	dry, err := h.Prune(policy, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry.ByAge != 1 || dry.ByCount != 1 || dry.BySize != 1 || dry.Bytes != 30 {
+		t.Fatalf("dry run = %+v", dry)
+	}
+	if page, _ := h.List(Query{Channel: models.DefaultChannel, Limit: 10}); page.Total != 7 {
+		t.Fatalf("dry run removed entries: total %d", page.Total)
+	}
+
+	res, err := h.Prune(policy, false)
+	if err != nil || fmt.Sprint(res) != fmt.Sprint(dry) {
+		t.Fatalf("prune = %+v (%v), want %+v", res, err, dry)
+	}
+	var removed []int64
+	for _, e := range res.Removed {
+		removed = append(removed, e.ID)
+	}
+	if want := []int64{ids[1], ids[2], ids[3]}; fmt.Sprint(removed) != fmt.Sprint(want) {
+		t.Fatalf("removed = %v, want %v", removed, want)
+	}
+	page, _ := h.List(Query{Channel: models.DefaultChannel, Limit: 10})
+	var got []int64
+	for _, e := range page.Items {
+		got = append(got, e.ID)
+	}
+	want := []int64{ids[0], blob.ID, ids[5], ids[4]}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("remaining = %v, want %v", got, want)
+	}
+	if data, err := h.Blob(blob.ID); err != nil || len(data) != 100 {
+		t.Fatalf("blob of kept entry: %d bytes (%v)", len(data), err)
+	}
+	if res, err := h.Prune(Retention{MaxEntries: 1}, false); err != nil || res.ByCount != 3 {
+		t.Fatalf("pinned entries must survive: %+v (%v)", res, err)
+	}
+}
+
+func TestDBHistoryDeduplicates(t *testing.T) {
+	h := newTestDB(t)
+	first, err := h.Insert(models.ClipboardUpdate{Text: "ssh deploy@prod", Source: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := h.Insert(models.ClipboardUpdate{Text: "something else", Source: "laptop"})
+	again, err := h.Insert(models.ClipboardUpdate{Text: "ssh deploy@prod", Source: "phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID || again.CopyCount != 2 || again.Source != "phone" || !again.UpdatedAt.After(first.UpdatedAt) {
+		t.Fatalf("re-insert = %+v, want entry %d bumped", again, first.ID)
+	}
+	if latest, err := h.Latest(models.DefaultChannel); err != nil || latest.ID != first.ID {
+		t.Fatalf("latest = %+v (%v), want the re-copied entry", latest, err)
+	}
+	// Same text in another channel, and encrypted text, are separate entries.
+	if work, _ := h.Insert(models.ClipboardUpdate{Channel: "work", Text: "ssh deploy@prod", Source: "a"}); work.ID == first.ID || work.CopyCount != 1 {
+		t.Fatalf("other channel = %+v", work)
+	}
+	enc := models.ClipboardUpdate{Text: "c2VjcmV0", Source: "a", Encrypted: true, Nonce: "n", KeyID: "k"}
+	e1, _ := h.Insert(enc)
+	e2, _ := h.Insert(enc)
+	if e1.ID == e2.ID {
+		t.Fatal("encrypted entries must not be merged")
+	}
+	b1, err := h.InsertBlob(models.ClipboardUpdate{Source: "a", MimeType: "image/png"}, []byte("png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := h.InsertBlob(models.ClipboardUpdate{Source: "b", MimeType: "image/png"}, []byte("png"))
+	if err != nil || b2.ID != b1.ID || b2.CopyCount != 2 {
+		t.Fatalf("blob re-insert = %+v (%v)", b2, err)
+	}
+	if data, err := h.Blob(b1.ID); err != nil || string(data) != "png" {
+		t.Fatalf("blob = %q (%v)", data, err)
+	}
+
+	page, err := h.List(Query{Channel: models.DefaultChannel, Limit: 2, Sort: SortFrequent, Search: "ssh OR something"})
+	if err != nil || page.Total != 2 || page.Items[0].ID != first.ID || page.Items[1].ID != other.ID {
+		t.Fatalf("frequent search = %+v (%v)", page, err)
+	}
+	page, err = h.List(Query{Channel: models.DefaultChannel, Limit: 2, Sort: SortFrequent})
+	if err != nil || page.Total != 5 || page.Items[0].ID != b1.ID || page.Items[1].ID != first.ID || page.NextCursor == "" {
+		t.Fatalf("frequent page = %+v (%v)", page, err)
+	}
+	next, err := h.List(Query{Channel: models.DefaultChannel, Limit: 10, Sort: SortFrequent, Cursor: page.NextCursor})
+	if err != nil || len(next.Items) != 3 {
+		t.Fatalf("frequent next page = %+v (%v)", next, err)
+	}
+}
+
+func TestDBHistoryHashesExistingRows(t *testing.T) {
+	path := t.TempDir() + "/old.db"
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Exec(`CREATE TABLE clipboard_history (id INTEGER PRIMARY KEY AUTOINCREMENT, text TEXT NOT NULL, source TEXT NOT NULL, updated_at TEXT NOT NULL, pinned INTEGER NOT NULL DEFAULT 0);
+		INSERT INTO clipboard_history(text,source,updated_at) VALUES('dup','a','2024-01-01T00:00:00Z'),('dup','a','2024-01-02T00:00:00Z'),('other','a','2024-01-03T00:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	h := NewDB(path)
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	e, err := h.Insert(models.ClipboardUpdate{Text: "dup", Source: "b"})
+	if err != nil || e.ID != 2 || e.CopyCount != 2 {
+		t.Fatalf("insert = %+v (%v), want the newest existing copy (id 2)", e, err)
+	}
+	page, _ := h.List(Query{Channel: models.DefaultChannel, Limit: 10})
+	if page.Total != 3 || page.Items[0].ID != 2 || page.Items[1].ID != 3 {
+		t.Fatalf("existing rows changed: %+v", page)
+	}
+}
+
+func TestDBHistoryExpiryAndBurnAfterRead(t *testing.T) {
+	h := newTestDB(t)
+	kept, _ := h.Insert(models.ClipboardUpdate{Text: "kept", Source: "a"})
+	past := time.Now().Add(-time.Minute)
+	expired, err := h.Insert(models.ClipboardUpdate{Text: "expired", Source: "a", ExpiresAt: &past})
+	if err != nil {
+		t.Fatal(err)
+	}
+	burn, err := h.Insert(models.ClipboardUpdate{Text: "kept", Source: "a", MaxReads: 2})
+	if err != nil || burn.ID == kept.ID || burn.MaxReads != 2 {
+		t.Fatalf("burn-after-read entry must not merge with a kept one: %+v (%v)", burn, err)
+	}
+
+	if _, err := h.ByID(expired.ID); err == nil {
+		t.Fatal("expired entry returned by ByID")
+	}
+	page, _ := h.List(Query{Channel: models.DefaultChannel, Limit: 10})
+	if page.Total != 1 || page.Items[0].ID != kept.ID {
+		t.Fatalf("list = %+v, want only the kept entry", page)
+	}
+	if latest, err := h.Latest(models.DefaultChannel); err != nil || latest.ID != burn.ID {
+		t.Fatalf("latest = %+v (%v)", latest, err)
+	}
+	for i := 1; i <= 2; i++ {
+		e, err := h.Consume(burn.ID)
+		if err != nil || e.Reads != i || e.Text != "kept" {
+			t.Fatalf("read %d = %+v (%v)", i, e, err)
+		}
+	}
+	if _, err := h.Consume(burn.ID); err == nil {
+		t.Fatal("third read of a two-read entry succeeded")
+	}
+	if latest, err := h.Latest(models.DefaultChannel); err != nil || latest.ID != kept.ID {
+		t.Fatalf("latest after burn = %+v (%v)", latest, err)
+	}
+
+	removed, err := h.DeleteExpired()
+	if err != nil || len(removed) != 2 {
+		t.Fatalf("DeleteExpired = %+v (%v)", removed, err)
+	}
+	var n int
+	if err := h.DB().QueryRow("SELECT count(*) FROM clipboard_history").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("rows left = %d (%v)", n, err)
+	}
+}
+
+func TestDBHistoryRecopyReplacesLifetime(t *testing.T) {
+	h := newTestDB(t)
+	past := time.Now().Add(-time.Minute)
+	old, err := h.Insert(models.ClipboardUpdate{Text: "again", Source: "a", ExpiresAt: &past})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The expired row is not swept yet; copying the text again revives it.
+	again, err := h.Insert(models.ClipboardUpdate{Text: "again", Source: "b"})
+	if err != nil || again.ID != old.ID || again.ExpiresAt != nil || again.CopyCount != 2 {
+		t.Fatalf("re-copy of expired text = %+v (%v)", again, err)
+	}
+	if latest, err := h.Latest(models.DefaultChannel); err != nil || latest.ID != old.ID || latest.Source != "b" {
+		t.Fatalf("latest after re-copy = %+v (%v)", latest, err)
+	}
+
+	// A plain copy does not inherit the TTL of an earlier one.
+	future := time.Now().Add(time.Hour)
+	if _, err := h.Insert(models.ClipboardUpdate{Text: "ttl", Source: "a", ExpiresAt: &future}); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := h.Insert(models.ClipboardUpdate{Text: "ttl", Source: "a"})
+	if err != nil || plain.ExpiresAt != nil {
+		t.Fatalf("plain re-copy = %+v (%v)", plain, err)
+	}
+
+	// A pinned entry keeps its lifetime whatever the new copy asks for.
+	pinned, _ := h.Insert(models.ClipboardUpdate{Text: "keep", Source: "a"})
+	if err := h.SetPinned(pinned.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	recopy, err := h.Insert(models.ClipboardUpdate{Text: "keep", Source: "b", ExpiresAt: &future})
+	if err != nil || recopy.ID != pinned.ID || recopy.ExpiresAt != nil || !recopy.Pinned || recopy.CopyCount != 2 {
+		t.Fatalf("re-copy of pinned entry = %+v (%v)", recopy, err)
+	}
+}
+
+func TestDBHistoryMostRecentIgnoresPins(t *testing.T) {
+	h := newTestDB(t)
+	pinned, _ := h.Insert(models.ClipboardUpdate{Text: "pinned", Source: "a"})
+	if err := h.SetPinned(pinned.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	previous, _ := h.Insert(models.ClipboardUpdate{Text: "previous", Source: "a"})
+	current, _ := h.Insert(models.ClipboardUpdate{Text: "current", Source: "a"})
+	if e, err := h.MostRecent(models.DefaultChannel); err != nil || e.ID != current.ID {
+		t.Fatalf("most recent = %+v (%v)", e, err)
+	}
+	if err := h.Delete(current.ID); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := h.MostRecent(models.DefaultChannel); err != nil || e.ID != previous.ID {
+		t.Fatalf("most recent after delete = %+v, want the previous entry (%v)", e, err)
+	}
+}
+
+func TestDBHistoryTags(t *testing.T) {
+	h := newTestDB(t)
+	a, err := h.Insert(models.ClipboardUpdate{Text: "alpha", Source: "a", Tags: []string{"Work", "snippets", "work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(a.Tags, ",") != "snippets,work" {
+		t.Fatalf("tags on insert = %v", a.Tags)
+	}
+	b, _ := h.Insert(models.ClipboardUpdate{Text: "beta", Source: "a"})
+	if err := h.UpdateTags(b.ID, []string{"work", "todo"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.UpdateTags(b.ID, []string{"no spaces"}, nil); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("invalid tag: err = %v", err)
+	}
+	// Copying alpha again keeps its tags and adds new ones.
+	again, _ := h.Insert(models.ClipboardUpdate{Text: "alpha", Source: "b", Tags: []string{"urgent"}})
+	if again.ID != a.ID || strings.Join(again.Tags, ",") != "snippets,urgent,work" {
+		t.Fatalf("re-copied entry = %+v", again)
+	}
+
+	page, err := h.List(Query{Channel: models.DefaultChannel, Tag: "work", Limit: 10})
+	if err != nil || page.Total != 2 {
+		t.Fatalf("tag=work: %+v (%v)", page, err)
+	}
+	page, _ = h.List(Query{Channel: models.DefaultChannel, Tag: "todo", Limit: 10})
+	if page.Total != 1 || page.Items[0].ID != b.ID || strings.Join(page.Items[0].Tags, ",") != "todo,work" {
+		t.Fatalf("tag=todo: %+v", page)
+	}
+
+	if err := h.UpdateTags(b.ID, nil, []string{"work", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := h.Tags(models.DefaultChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.TagCount{{Name: "snippets", Count: 1}, {Name: "todo", Count: 1}, {Name: "urgent", Count: 1}, {Name: "work", Count: 1}}
+	if fmt.Sprint(tags) != fmt.Sprint(want) {
+		t.Fatalf("Tags = %v, want %v", tags, want)
+	}
+
+	if err := h.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	var links int
+	if err := h.DB().QueryRow("SELECT count(*) FROM clipboard_entry_tags").Scan(&links); err != nil || links != 1 {
+		t.Fatalf("tag links after delete = %d (%v)", links, err)
+	}
+}
+
+func TestDBHistoryUpdateTagsIsAtomic(t *testing.T) {
+	h := newTestDB(t)
+	e, err := h.Insert(models.ClipboardUpdate{Text: "alpha", Source: "a", Tags: []string{"keep", "old"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	many := make([]string, maxTagsPerEntry)
+	for i := range many {
+		many[i] = fmt.Sprintf("t%d", i)
+	}
+	for _, tc := range []struct {
+		name        string
+		add, remove []string
+	}{
+		{"too many tags", many, []string{"old"}},
+		{"invalid add", []string{"new", "no spaces"}, []string{"old"}},
+		{"invalid remove", []string{"new"}, []string{"no spaces"}},
+	} {
+		if err := h.UpdateTags(e.ID, tc.add, tc.remove); !errors.Is(err, ErrInvalidTag) {
+			t.Fatalf("%s: err = %v", tc.name, err)
+		}
+		got, _ := h.ByID(e.ID)
+		if strings.Join(got.Tags, ",") != "keep,old" {
+			t.Fatalf("%s: tags changed to %v", tc.name, got.Tags)
+		}
+	}
+
+	if err := h.UpdateTags(e.ID, []string{"new"}, []string{"old"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := h.ByID(e.ID); strings.Join(got.Tags, ",") != "keep,new" {
+		t.Fatalf("tags after update = %v", got.Tags)
+	}
+}
+
+func TestDBHistoryExportImport(t *testing.T) {
+	src := newTestDB(t)
+	old := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := src.Insert(models.ClipboardUpdate{Text: "first", Source: "laptop", Tags: []string{"work"}}); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := src.Insert(models.ClipboardUpdate{Text: "second", Source: "phone"})
+	_ = src.SetPinned(second.ID, true)
+	_, _ = src.InsertBlob(models.ClipboardUpdate{Source: "laptop", MimeType: "image/png"}, []byte("png"))
+	_, _ = src.Insert(models.ClipboardUpdate{Text: "secret", Source: "laptop", Sensitive: true})
+	_, _ = src.Insert(models.ClipboardUpdate{Text: "burn", Source: "laptop", MaxReads: 1})
+
+	type item struct {
+		e    models.ClipboardUpdate
+		data []byte
+	}
+	var items []item
+	err := src.Export(ExportQuery{WithData: true}, func(e models.ClipboardUpdate, data []byte) error {
+		items = append(items, item{e, data})
+		return nil
+	})
+	if err != nil || len(items) != 3 || items[0].e.Text != "second" {
+		t.Fatalf("export = %+v (%v), want 3 entries with the pinned one first", items, err)
+	}
+
+	dst := newTestDB(t)
+	_, _ = dst.Insert(models.ClipboardUpdate{Text: "already here", Source: "desk"})
+	items = append(items, item{models.ClipboardUpdate{Text: "old", Source: "laptop", UpdatedAt: old, CopyCount: 4}, nil})
+	importAll := func() ImportResult {
+		i := 0
+		res, err := dst.Import(func() (models.ClipboardUpdate, []byte, error) {
+			if i == len(items) {
+				return models.ClipboardUpdate{}, nil, io.EOF
+			}
+			i++
+			return items[i-1].e, items[i-1].data, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	if res := importAll(); res.Imported != 4 || res.Skipped != 0 {
+		t.Fatalf("first import = %+v", res)
+	}
+	if res := importAll(); res.Imported != 0 || res.Skipped != 4 {
+		t.Fatalf("second import = %+v, want everything skipped", res)
+	}
+
+	page, _ := dst.List(Query{Channel: models.DefaultChannel, Limit: 10})
+	var order []string
+	for _, e := range page.Items {
+		order = append(order, e.Text+"/"+e.MimeType)
+	}
+	// Pinned first, then by timestamp: the entry written to dst before the import is the newest.
+	if want := "second/text/plain already here/text/plain /image/png first/text/plain old/text/plain"; strings.Join(order, " ") != want {
+		t.Fatalf("order after import = %v", order)
+	}
+	imported := page.Items[4]
+	if !imported.UpdatedAt.Equal(old) || imported.CopyCount != 4 || imported.Source != "laptop" {
+		t.Fatalf("imported entry lost its metadata: %+v", imported)
+	}
+	if first := page.Items[3]; strings.Join(first.Tags, ",") != "work" {
+		t.Fatalf("imported entry lost its tags: %+v", first)
+	}
+	if data, err := dst.Blob(page.Items[2].ID); err != nil || string(data) != "png" {
+		t.Fatalf("blob = %q (%v)", data, err)
+	}
+	_, _ = dst.Insert(models.ClipboardUpdate{Text: "after import", Source: "desk"})
+	unpinned := false
+	page, _ = dst.List(Query{Channel: models.DefaultChannel, Pinned: &unpinned, Limit: 1})
+	if page.Items[0].Text != "after import" {
+		t.Fatalf("entry copied after the import is not the most recent: %+v", page.Items[0])
+	}
+}
+
+func TestDBHistoryImportOnlyMovesNewerEntries(t *testing.T) {
+	h := newTestDB(t)
+	a, _ := h.Insert(models.ClipboardUpdate{Text: "a", Source: "desk"})
+	b, _ := h.Insert(models.ClipboardUpdate{Text: "b", Source: "desk"})
+	time.Sleep(time.Millisecond)
+	c, _ := h.Insert(models.ClipboardUpdate{Text: "c", Source: "desk"})
+	seqs := func() map[int64]int64 {
+		rows, err := h.DB().Query("SELECT id, seq FROM clipboard_history")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		m := map[int64]int64{}
+		for rows.Next() {
+			var id, seq int64
+			_ = rows.Scan(&id, &seq)
+			m[id] = seq
+		}
+		return m
+	}
+	before := seqs()
+
+	pending := []models.ClipboardUpdate{{Text: "x", Source: "laptop", UpdatedAt: b.UpdatedAt.Add(time.Microsecond)}}
+	res, err := h.Import(func() (models.ClipboardUpdate, []byte, error) {
+		if len(pending) == 0 {
+			return models.ClipboardUpdate{}, nil, io.EOF
+		}
+		e := pending[0]
+		pending = pending[1:]
+		return e, nil, nil
+	})
+	if err != nil || res.Imported != 1 {
+		t.Fatalf("import = %+v (%v)", res, err)
+	}
+	after := seqs()
+	if after[a.ID] != before[a.ID] || after[b.ID] != before[b.ID] {
+		t.Fatalf("entries older than the import moved: %v -> %v", before, after)
+	}
+	page, _ := h.List(Query{Channel: models.DefaultChannel, Limit: 10})
+	var order []string
+	for _, e := range page.Items {
+		order = append(order, e.Text)
+	}
+	if strings.Join(order, " ") != "c x b a" || after[c.ID] == before[c.ID] {
+		t.Fatalf("order after import = %v, seqs %v -> %v", order, before, after)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	if _, err := MigrationStatus(path); err == nil {
+		t.Fatal("status of a missing database should fail, not create it")
+	}
+	done, err := Migrate(path)
+	if err != nil || len(done) != LatestVersion() {
+		t.Fatalf("migrate = %d applied (%v), want %d", len(done), err, LatestVersion())
+	}
+	if done, err := Migrate(path); err != nil || len(done) != 0 {
+		t.Fatalf("second migrate = %+v (%v), want nothing to do", done, err)
+	}
+	status, err := MigrationStatus(path)
+	if err != nil || len(status) != LatestVersion() {
+		t.Fatalf("status = %+v (%v)", status, err)
+	}
+	for _, m := range status {
+		if m.AppliedAt.IsZero() || m.Unknown {
+			t.Fatalf("migration %d not applied: %+v", m.Version, m)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO schema_migrations VALUES(?, 'from the future', ?)", LatestVersion()+1, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := NewDB(path).Init(); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("init of a newer schema = %v, want ErrSchemaTooNew", err)
+	}
+	status, _ = MigrationStatus(path)
+	if last := status[len(status)-1]; !last.Unknown || last.Version != LatestVersion()+1 {
+		t.Fatalf("newer migration not reported as unknown: %+v", last)
+	}
+}
+
+func TestMigrationsUpgradeRequestLogs(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// request_logs as the first release with persisted logs created it.
+	if _, err := db.Exec(`CREATE TABLE request_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, method TEXT NOT NULL, path TEXT NOT NULL, status INTEGER NOT NULL,
+		remote_addr TEXT NOT NULL, timestamp INTEGER NOT NULL, request_body TEXT NOT NULL DEFAULT '',
+		response_body TEXT NOT NULL DEFAULT '', request_size INTEGER NOT NULL DEFAULT 0, response_size INTEGER NOT NULL DEFAULT 0);
+		INSERT INTO request_logs(method,path,status,remote_addr,timestamp) VALUES('GET','/',200,'127.0.0.1',1)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := Migrate(path); err != nil {
+		t.Fatal(err)
+	}
+	h := NewDB(path)
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	var proto string
+	var replayable bool
+	if err := h.DB().QueryRow("SELECT proto, replayable FROM request_logs").Scan(&proto, &replayable); err != nil || proto != "" || replayable {
+		t.Fatalf("upgraded row = %q, %v (%v)", proto, replayable, err)
+	}
+}
+
+func TestE2ESaltIsKeptPerDatabase(t *testing.T) {
+	dir := t.TempDir()
+	salt := func(path string) string {
+		h := NewDB(path)
+		if err := h.Init(); err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		s, err := h.E2ESalt()
+		if err != nil || s == "" {
+			t.Fatalf("salt = %q (%v)", s, err)
+		}
+		return s
+	}
+	first := salt(dir + "/a.db")
+	if again := salt(dir + "/a.db"); again != first {
+		t.Fatalf("salt changed on reopen: %q, then %q", first, again)
+	}
+	if other := salt(dir + "/b.db"); other == first {
+		t.Fatal("two databases share a salt")
+	}
+}
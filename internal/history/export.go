@@ -0,0 +1,259 @@
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// ExportQuery selects the entries Export visits.
+type ExportQuery struct {
+	Channel          string // Empty exports every channel
+	IncludeSensitive bool   // Also export entries flagged as sensitive
+	WithData         bool   // Load the payload of binary entries
+}
+
+// ImportResult counts what Import did with the entries it was given.
+type ImportResult struct {
+	Imported int
+	Skipped  int // Already in history, expired, burn-after-read, or a binary entry without payload
+}
+
+// Export calls fn for each live entry matching q, grouped by channel and in
+// List order (pinned first, then most recent). data is the payload of binary
+// entries when q.WithData is set, nil otherwise. Burn-after-read entries are
+// never exported.
+func (s *DBHistory) Export(q ExportQuery, fn func(e models.ClipboardUpdate, data []byte) error) error {
+	var (
+		where = []string{"h.max_reads=0", liveCond}
+		args  []any
+	)
+	if q.Channel != "" {
+		where = append(where, "h.channel=?")
+		args = append(args, q.Channel)
+	}
+	if !q.IncludeSensitive {
+		where = append(where, "h.sensitive=0")
+	}
+	filter := " WHERE " + strings.Join(where, " AND ")
+
+	// Tags are loaded up front so the entries can be streamed in one query.
+	tags := map[int64][]string{}
+	rows, err := s.db.Query(`SELECT et.entry_id, t.name FROM clipboard_entry_tags et
+		JOIN clipboard_tags t ON t.id = et.tag_id
+		JOIN clipboard_history h ON h.id = et.entry_id`+filter+` ORDER BY t.name`, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		tags[id] = append(tags[id], name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	data := "NULL"
+	if q.WithData {
+		data = "(SELECT b.data FROM clipboard_blobs b WHERE b.entry_id = h.id)"
+	}
+	rows, err = s.db.Query("SELECT "+qualify("h", entryColumns)+", "+data+" FROM clipboard_history h"+filter+
+		" ORDER BY h.channel, h.pinned DESC, h.seq DESC", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var payload []byte
+		e, err := scanEntry(rows, &payload)
+		if err != nil {
+			return err
+		}
+		e.Tags = tags[e.ID]
+		if err := fn(e, payload); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Import adds the entries returned by next until it returns io.EOF, in one
+// transaction. Each entry keeps its channel, text, source, timestamp, pinned
+// state, copy count, tags and expiry; IDs are assigned anew. Content already in
+// the channel is skipped, so importing the same file twice changes nothing.
+// Imported entries are placed in the recency order by their timestamps.
+func (s *DBHistory) Import(next func() (models.ClipboardUpdate, []byte, error)) (ImportResult, error) {
+	var res ImportResult
+	tx, err := s.db.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	for n := 1; ; n++ {
+		e, data, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ImportResult{}, err
+		}
+		imported, err := importEntry(tx, e, data, now)
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("entry %d: %w", n, err)
+		}
+		if imported {
+			res.Imported++
+		} else {
+			res.Skipped++
+		}
+	}
+	if res.Imported > 0 {
+		if err := placeImported(tx); err != nil {
+			return ImportResult{}, err
+		}
+	}
+	return res, tx.Commit()
+}
+
+// placeImported gives the entries Import added (seq 0) a place in the recency
+// order that follows their timestamps, ties broken by id. Existing entries keep
+// their order; only those newer than the oldest imported entry move up to make
+// room. Timestamps are compared in Go: SQLite's date functions only resolve
+// milliseconds, which reorders entries copied in quick succession.
+func placeImported(tx *sql.Tx) error {
+	type row struct {
+		id  int64
+		seq int64
+		at  time.Time
+	}
+	rows, err := tx.Query("SELECT id, seq, updated_at FROM clipboard_history ORDER BY seq, id")
+	if err != nil {
+		return err
+	}
+	var imported, existing []row
+	for rows.Next() {
+		var (
+			r  row
+			at string
+		)
+		if err := rows.Scan(&r.id, &r.seq, &at); err != nil {
+			rows.Close()
+			return err
+		}
+		r.at, _ = time.Parse(time.RFC3339Nano, at)
+		if r.seq == 0 {
+			imported = append(imported, r)
+		} else {
+			existing = append(existing, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(imported) == 0 {
+		return err
+	}
+	sort.Slice(imported, func(i, j int) bool {
+		if !imported[i].at.Equal(imported[j].at) {
+			return imported[i].at.Before(imported[j].at)
+		}
+		return imported[i].id < imported[j].id
+	})
+	// Existing entries up to the oldest imported one stay where they are.
+	next := int64(1)
+	for len(existing) > 0 && !existing[0].at.After(imported[0].at) {
+		next = existing[0].seq + 1
+		existing = existing[1:]
+	}
+	stmt, err := tx.Prepare("UPDATE clipboard_history SET seq=? WHERE id=?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for len(imported) > 0 || len(existing) > 0 {
+		var r row
+		if len(existing) == 0 || len(imported) > 0 && imported[0].at.Before(existing[0].at) {
+			r, imported = imported[0], imported[1:]
+		} else {
+			r, existing = existing[0], existing[1:]
+		}
+		if r.seq != next {
+			if _, err := stmt.Exec(next, r.id); err != nil {
+				return err
+			}
+		}
+		next++
+	}
+	return nil
+}
+
+// importEntry inserts one entry for Import; it reports false for entries it skips.
+func importEntry(tx *sql.Tx, e models.ClipboardUpdate, data []byte, now time.Time) (bool, error) {
+	if e.MaxReads > 0 || e.Expired(now) {
+		return false, nil
+	}
+	tags, err := NormalizeTags(e.Tags)
+	if err != nil {
+		return false, err
+	}
+	if e.MimeType == "" {
+		e.MimeType = models.MimeText
+	}
+	if !e.IsBlob() {
+		data = nil
+	} else if data == nil {
+		return false, nil
+	}
+	if e.UpdatedAt.IsZero() {
+		e.UpdatedAt = now
+	}
+	if e.CopyCount < 1 {
+		e.CopyCount = 1
+	}
+	size := int64(len(e.Text))
+	var hash any
+	var exists int
+	switch {
+	case e.Encrypted:
+		// Ciphertext never repeats, so it identifies the entry.
+		err = tx.QueryRow("SELECT count(*) FROM clipboard_history WHERE channel=? AND encrypted=1 AND text=? AND nonce=?", e.ChannelName(), e.Text, e.Nonce).Scan(&exists)
+	case data != nil:
+		size = int64(len(data))
+		hash = contentHash(e.MimeType, data)
+	default:
+		hash = contentHash(e.MimeType, []byte(e.Text))
+	}
+	if hash != nil {
+		err = tx.QueryRow("SELECT count(*) FROM clipboard_history WHERE channel=? AND content_hash=?", e.ChannelName(), hash).Scan(&exists)
+	}
+	if err != nil || exists > 0 {
+		return false, err
+	}
+	var id int64
+	err = tx.QueryRow(`INSERT INTO clipboard_history(channel,text,source,updated_at,pinned,mime_type,size,width,height,encrypted,nonce,key_id,sensitive,expires_at,max_reads,content_hash,copy_count,seq)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,0,?,?,0) RETURNING id`,
+		e.ChannelName(), e.Text, e.Source, e.UpdatedAt.UTC().Format(time.RFC3339Nano), e.Pinned, e.MimeType, size, e.Width, e.Height,
+		e.Encrypted, e.Nonce, e.KeyID, e.Sensitive, formatExpiry(e.ExpiresAt), hash, e.CopyCount).Scan(&id)
+	if err != nil {
+		return false, err
+	}
+	if data != nil {
+		if _, err := tx.Exec("INSERT INTO clipboard_blobs(entry_id,data) VALUES(?,?)", id, data); err != nil {
+			return false, err
+		}
+	}
+	return true, addTags(tx, id, tags)
+}
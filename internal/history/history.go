@@ -1,14 +1,93 @@
 package history
 
-import "local-clipboard/internal/models"
+import (
+	"errors"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// ErrInvalidCursor is returned by List for a cursor it did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Orders for Query.Sort.
+const (
+	SortRecent   = ""         // Most recently copied first
+	SortFrequent = "frequent" // Most often copied first
+)
+
+// Query selects a page of history entries for List. Zero values mean "no filter".
+type Query struct {
+	Channel string
+	Limit   int    // Page size
+	Search  string // Full-text query (see List)
+	Sort    string // SortRecent or SortFrequent; pinned entries always come first
+	Cursor  string // Opaque cursor from a previous Page.NextCursor
+
+	IncludeSensitive bool // Let Search match entries flagged as sensitive
+
+	BeforeID int64     // Only entries after this one in recency order (pinned first); none if it is gone
+	Source   string    // Only entries from this source
+	Tag      string    // Only entries with this tag (see NormalizeTag)
+	Pinned   *bool     // Only pinned (true) or unpinned (false) entries
+	Since    time.Time // Only entries updated at or after this time
+	Until    time.Time // Only entries updated before this time
+	MinSize  int64     // Only entries of at least this many bytes
+	MaxSize  int64     // Only entries of at most this many bytes
+}
+
+// Page is one page of List results.
+type Page struct {
+	Items      []models.ClipboardUpdate `json:"items"`
+	NextCursor string                   `json:"next_cursor,omitempty"` // Empty on the last page
+	Total      int                      `json:"total"`                 // Entries matching the query across all pages
+}
 
 // History provides persistence for clipboard entries.
 type History interface {
 	Init() error
-	Insert(text, source string) (models.ClipboardUpdate, error)
-	Latest() (models.ClipboardUpdate, error)
+	// Insert stores a text entry from e (Channel, Text, Source, Tags and, for end-to-end
+	// encrypted entries, Encrypted/Nonce/KeyID); ID and timestamps are assigned.
+	// If the channel already holds the same content, that entry is bumped to the
+	// top with a new source and CopyCount+1 and returned instead.
+	Insert(e models.ClipboardUpdate) (models.ClipboardUpdate, error)
+	// InsertBlob stores a binary entry. meta supplies Channel, MimeType, Source
+	// and optional Width/Height and Tags; Size is taken from data. Duplicates are handled
+	// like in Insert.
+	InsertBlob(meta models.ClipboardUpdate, data []byte) (models.ClipboardUpdate, error)
+	// Blob returns the binary payload of the entry with the given id.
+	Blob(id int64) ([]byte, error)
+	// Latest returns the most recently copied entry of channel. Like ByID and
+	// List it never returns expired entries or ones whose reads are used up.
+	Latest(channel string) (models.ClipboardUpdate, error)
 	ByID(id int64) (models.ClipboardUpdate, error)
-	List(limit int, search string) ([]models.ClipboardUpdate, error)
+	// Consume counts a read of a burn-after-read entry and returns it; it fails
+	// once the entry is expired or used up.
+	Consume(id int64) (models.ClipboardUpdate, error)
+	// List returns a page of entries matching q, pinned first. A non-empty Search
+	// is a full-text query whose results are ranked and carry a Snippet; it only
+	// matches plaintext entries, so encrypted entries must be searched client-side,
+	// and skips sensitive entries unless q.IncludeSensitive is set. Burn-after-read
+	// entries are never listed.
+	List(q Query) (Page, error)
+	// Channels returns the names of channels that have entries.
+	Channels() ([]string, error)
 	SetPinned(id int64, pinned bool) error
+	// UpdateTags removes and then adds tags of an entry in one step; names are
+	// normalized with NormalizeTag and invalid ones, or too many tags, fail with
+	// ErrInvalidTag without changing anything.
+	UpdateTags(id int64, add, remove []string) error
+	// Tags returns the tags used in channel with their entry counts.
+	Tags(channel string) ([]models.TagCount, error)
 	Delete(id int64) error
+	// DeleteExpired removes entries whose ExpiresAt has passed or whose reads are
+	// used up, and returns them.
+	DeleteExpired() ([]models.ClipboardUpdate, error)
+	// Prune removes unpinned entries outside the retention policy r; with
+	// dryRun it only reports what would be removed.
+	Prune(r Retention, dryRun bool) (PruneResult, error)
+	// Export calls fn for each entry matching q (see ExportQuery); Import adds
+	// entries read by next, skipping content that is already there.
+	Export(q ExportQuery, fn func(e models.ClipboardUpdate, data []byte) error) error
+	Import(next func() (models.ClipboardUpdate, []byte, error)) (ImportResult, error)
 }
@@ -0,0 +1,341 @@
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"local-clipboard/internal/e2e"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer version
+// of local-clipboard than this one.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of local-clipboard")
+
+// Migration is a numbered schema change and, once applied, when it was applied.
+type Migration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time // Zero while pending
+	Unknown   bool      // Recorded in the database but not known to this binary
+}
+
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations run in order, each in one transaction together with its row in
+// schema_migrations. Never change or renumber a released migration; add a new
+// one. Databases created before schema_migrations existed already have some of
+// these columns and tables, so steps check before adding them. The tables of
+// other packages sharing the database (auth, channels, presence) are created
+// here too, so the whole schema has one version.
+var migrations = []migration{
+	{1, "create history and blob tables", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS clipboard_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			text TEXT NOT NULL,
+			source TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			pinned INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS clipboard_blobs (
+			entry_id INTEGER PRIMARY KEY,
+			data BLOB NOT NULL
+		)`); err != nil {
+			return err
+		}
+		_, err := addColumn(tx, "pinned INTEGER NOT NULL DEFAULT 0")
+		return err
+	}},
+	{2, "binary entry metadata", func(tx *sql.Tx) error {
+		if err := addColumns(tx, "mime_type TEXT NOT NULL DEFAULT 'text/plain'", "width INTEGER NOT NULL DEFAULT 0", "height INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		added, err := addColumn(tx, "size INTEGER NOT NULL DEFAULT 0")
+		if err == nil && added {
+			// Sizes of text rows written before the column existed.
+			_, err = tx.Exec(`UPDATE clipboard_history SET size=length(CAST(text AS BLOB))`)
+		}
+		return err
+	}},
+	{3, "end-to-end encryption", func(tx *sql.Tx) error {
+		return addColumns(tx, "encrypted INTEGER NOT NULL DEFAULT 0", "nonce TEXT NOT NULL DEFAULT ''", "key_id TEXT NOT NULL DEFAULT ''")
+	}},
+	{4, "channels", func(tx *sql.Tx) error {
+		if err := addColumns(tx, "channel TEXT NOT NULL DEFAULT 'default'"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_history_channel ON clipboard_history(channel, pinned, id)")
+		return err
+	}},
+	{5, "full-text search index", initFTS},
+	{6, "deduplication and recency order", func(tx *sql.Tx) error {
+		if added, err := addColumn(tx, "content_hash TEXT"); err != nil {
+			return err
+		} else if added {
+			if err := backfillHashes(tx); err != nil {
+				return err
+			}
+		}
+		if err := addColumns(tx, "copy_count INTEGER NOT NULL DEFAULT 1"); err != nil {
+			return err
+		}
+		if added, err := addColumn(tx, "seq INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		} else if added {
+			if _, err := tx.Exec("UPDATE clipboard_history SET seq=id"); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`DROP INDEX IF EXISTS idx_history_channel;
+		CREATE INDEX IF NOT EXISTS idx_history_recent ON clipboard_history(channel, pinned, seq);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_history_hash ON clipboard_history(channel, content_hash)`)
+		return err
+	}},
+	{7, "sensitive, expiring and burn-after-read entries", func(tx *sql.Tx) error {
+		if err := addColumns(tx, "sensitive INTEGER NOT NULL DEFAULT 0", "expires_at TEXT", "max_reads INTEGER NOT NULL DEFAULT 0", "reads INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_history_expires ON clipboard_history(expires_at) WHERE expires_at IS NOT NULL")
+		return err
+	}},
+	{8, "tags", initTags},
+	{9, "paired devices, channels and client presence", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS devices (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS channels (
+			name TEXT PRIMARY KEY,
+			token_hash TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS client_devices (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			paired_id INTEGER NOT NULL DEFAULT 0,
+			ip TEXT NOT NULL,
+			version TEXT NOT NULL,
+			backend TEXT NOT NULL,
+			channel TEXT NOT NULL,
+			first_seen TEXT NOT NULL,
+			last_seen TEXT NOT NULL
+		)`)
+		return err
+	}},
+	// request_logs is written by the requestlog package; timestamp holds Unix
+	// nanoseconds so time windows and retention compare as integers.
+	{10, "request log", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS request_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			remote_addr TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			request_body TEXT NOT NULL DEFAULT '',
+			response_body TEXT NOT NULL DEFAULT '',
+			request_size INTEGER NOT NULL DEFAULT 0,
+			response_size INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX IF NOT EXISTS idx_request_logs_timestamp ON request_logs(timestamp)`)
+		return err
+	}},
+	{11, "request log details for HAR export and replay", func(tx *sql.Tx) error {
+		for _, def := range []string{
+			"query TEXT NOT NULL DEFAULT ''",
+			"proto TEXT NOT NULL DEFAULT ''",
+			"duration_ms REAL NOT NULL DEFAULT 0",
+			"request_headers TEXT NOT NULL DEFAULT ''",
+			"response_headers TEXT NOT NULL DEFAULT ''",
+			"replayable INTEGER NOT NULL DEFAULT 0",
+		} {
+			if _, err := addTableColumn(tx, "request_logs", def); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	// settings holds values fixed for the life of the database, such as the
+	// random salt end-to-end encryption keys are derived with.
+	{12, "settings and end-to-end encryption salt", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS settings (
+			name TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		)`); err != nil {
+			return err
+		}
+		salt, err := e2e.NewSalt()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO settings(name, value) VALUES('e2e_salt', ?) ON CONFLICT(name) DO NOTHING", salt)
+		return err
+	}},
+}
+
+// LatestVersion is the schema version this binary migrates databases to.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// addColumn adds a column to clipboard_history unless it is already there, and
+// reports whether it did.
+func addColumn(tx *sql.Tx, def string) (bool, error) {
+	return addTableColumn(tx, "clipboard_history", def)
+}
+
+// addTableColumn is addColumn for any table.
+func addTableColumn(tx *sql.Tx, table, def string) (bool, error) {
+	var name string
+	fmt.Sscan(def, &name)
+	var n int
+	if err := tx.QueryRow("SELECT count(*) FROM pragma_table_info(?) WHERE name=?", table, name).Scan(&n); err != nil || n > 0 {
+		return false, err
+	}
+	_, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + def)
+	return err == nil, err
+}
+
+func addColumns(tx *sql.Tx, defs ...string) error {
+	for _, def := range defs {
+		if _, err := addColumn(tx, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate opens the database at path, applies pending migrations and returns them.
+func Migrate(path string) ([]Migration, error) {
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrate(db)
+}
+
+// MigrationStatus returns every migration known to this binary, and any newer
+// ones recorded in the database at path, without changing the database.
+func MigrationStatus(path string) ([]Migration, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, m := range migrations {
+		st := Migration{Version: m.version, Name: m.name}
+		if a, ok := applied[m.version]; ok {
+			st.AppliedAt = a.AppliedAt
+			delete(applied, m.version)
+		}
+		out = append(out, st)
+	}
+	var unknown []Migration
+	for _, a := range applied {
+		a.Unknown = true
+		unknown = append(unknown, a)
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return append(out, unknown...), nil
+}
+
+// appliedMigrations reads schema_migrations; a database without the table has
+// no migrations applied.
+func appliedMigrations(q queryer) (map[int]Migration, error) {
+	var exists int
+	if err := q.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'").Scan(&exists); err != nil || exists == 0 {
+		return map[int]Migration{}, err
+	}
+	rows, err := q.Query("SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]Migration{}
+	for rows.Next() {
+		var (
+			m         Migration
+			appliedAt string
+		)
+		if err := rows.Scan(&m.Version, &m.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		m.AppliedAt, _ = time.Parse(time.RFC3339Nano, appliedAt)
+		out[m.Version] = m
+	}
+	return out, rows.Err()
+}
+
+// migrate applies the pending migrations to db, refusing a database whose
+// schema is newer than LatestVersion.
+func migrate(db *sql.DB) ([]Migration, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return nil, err
+	}
+	var current int
+	if err := db.QueryRow("SELECT coalesce(max(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return nil, err
+	}
+	if current > LatestVersion() {
+		return nil, fmt.Errorf("%w: database is at version %d, this binary supports up to %d", ErrSchemaTooNew, current, LatestVersion())
+	}
+	var done []Migration
+	for _, m := range migrations {
+		applied, err := applyMigration(db, m)
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if !applied.AppliedAt.IsZero() {
+			done = append(done, applied)
+		}
+	}
+	return done, nil
+}
+
+// applyMigration runs m unless it is already recorded. The schema_migrations
+// row is written first, so the transaction holds the write lock from the start
+// and a second process opening the database at once waits, then skips m.
+func applyMigration(db *sql.DB, m migration) (Migration, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Migration{}, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC()
+	res, err := tx.Exec("INSERT INTO schema_migrations(version, name, applied_at) VALUES(?,?,?) ON CONFLICT(version) DO NOTHING", m.version, m.name, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return Migration{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return Migration{}, err
+	}
+	if err := m.up(tx); err != nil {
+		return Migration{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Migration{}, err
+	}
+	return Migration{Version: m.version, Name: m.name, AppliedAt: now}, nil
+}
@@ -0,0 +1,164 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// Retention limits how much history is kept. Zero fields are not enforced.
+// Pinned entries are never removed, but they count towards MaxEntries and MaxBytes.
+type Retention struct {
+	MaxEntries int           // Keep at most this many entries
+	MaxAge     time.Duration // Remove entries last updated longer ago than this
+	MaxBytes   int64         // Keep the total size of entries (text and blobs) under this
+}
+
+// Enabled reports whether any limit is set.
+func (r Retention) Enabled() bool {
+	return r.MaxEntries > 0 || r.MaxAge > 0 || r.MaxBytes > 0
+}
+
+// PruneResult reports what Prune removed (or would remove, in a dry run).
+type PruneResult struct {
+	ByAge   int   // Entries older than MaxAge
+	ByCount int   // Entries beyond MaxEntries
+	BySize  int   // Entries removed to get under MaxBytes
+	Bytes   int64 // Total size of all removed entries
+
+	Removed []models.ClipboardUpdate // ID and channel of every removed entry
+}
+
+// Entries returns the total number of removed entries.
+func (p PruneResult) Entries() int {
+	return p.ByAge + p.ByCount + p.BySize
+}
+
+func (p PruneResult) String() string {
+	return fmt.Sprintf("%d entries, %d bytes (age %d, count %d, size %d)", p.Entries(), p.Bytes, p.ByAge, p.ByCount, p.BySize)
+}
+
+// Prune removes unpinned entries that fall outside r, least recently copied first: first by
+// age, then by count, then by size. With dryRun the deletions are rolled back,
+// so the result shows what would be removed.
+func (s *DBHistory) Prune(r Retention, dryRun bool) (PruneResult, error) {
+	var res PruneResult
+	if !r.Enabled() {
+		return res, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	if r.MaxAge > 0 {
+		cutoff := time.Now().Add(-r.MaxAge).UTC().Format(time.RFC3339Nano)
+		if res.ByAge, err = pruneIDs(tx, &res, "SELECT id FROM clipboard_history WHERE pinned=0 AND julianday(updated_at) < julianday(?)", cutoff); err != nil {
+			return res, err
+		}
+	}
+	if r.MaxEntries > 0 {
+		var pinned int
+		if err := tx.QueryRow("SELECT count(*) FROM clipboard_history WHERE pinned=1").Scan(&pinned); err != nil {
+			return res, err
+		}
+		keep := r.MaxEntries - pinned
+		if keep < 0 {
+			keep = 0
+		}
+		if res.ByCount, err = pruneIDs(tx, &res, "SELECT id FROM clipboard_history WHERE pinned=0 ORDER BY seq DESC LIMIT -1 OFFSET ?", keep); err != nil {
+			return res, err
+		}
+	}
+	if r.MaxBytes > 0 {
+		var pinnedBytes int64
+		if err := tx.QueryRow("SELECT coalesce(sum(size),0) FROM clipboard_history WHERE pinned=1").Scan(&pinnedBytes); err != nil {
+			return res, err
+		}
+		// Keep the newest unpinned entries whose running total still fits.
+		if res.BySize, err = pruneIDs(tx, &res, `SELECT id FROM (
+			SELECT id, sum(size) OVER (ORDER BY seq DESC) AS running FROM clipboard_history WHERE pinned=0
+		) WHERE running > ?`, r.MaxBytes-pinnedBytes); err != nil {
+			return res, err
+		}
+	}
+	if res.Entries() == 0 || dryRun {
+		return res, nil
+	}
+	if _, err := tx.Exec("DELETE FROM clipboard_blobs WHERE entry_id NOT IN (SELECT id FROM clipboard_history)"); err != nil {
+		return res, err
+	}
+	return res, tx.Commit()
+}
+
+// DeleteExpired removes every entry whose expiry time has passed or whose reads
+// are used up, pinned or not, and returns the removed entries.
+func (s *DBHistory) DeleteExpired() ([]models.ClipboardUpdate, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	rows, err := tx.Query("SELECT "+entryColumns+" FROM clipboard_history WHERE (expires_at IS NOT NULL AND julianday(expires_at) <= julianday(?)) OR (max_reads > 0 AND reads >= max_reads)", now)
+	if err != nil {
+		return nil, err
+	}
+	var removed []models.ClipboardUpdate
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		removed = append(removed, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(removed) == 0 {
+		return nil, err
+	}
+	for _, e := range removed {
+		if _, err := tx.Stmt(s.deleteStmt).Exec(e.ID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM clipboard_blobs WHERE entry_id=?", e.ID); err != nil {
+			return nil, err
+		}
+	}
+	return removed, tx.Commit()
+}
+
+// pruneIDs deletes the entries selected by idQuery, adding their size to res.Bytes.
+func pruneIDs(tx *sql.Tx, res *PruneResult, idQuery string, args ...any) (int, error) {
+	idQuery = strings.TrimSpace(idQuery)
+	rows, err := tx.Query("SELECT id, channel, size FROM clipboard_history WHERE id IN ("+idQuery+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for rows.Next() {
+		var (
+			e    models.ClipboardUpdate
+			size int64
+		)
+		if err := rows.Scan(&e.ID, &e.Channel, &size); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		res.Removed = append(res.Removed, e)
+		res.Bytes += size
+		n++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || n == 0 {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM clipboard_history WHERE id IN ("+idQuery+")", args...); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
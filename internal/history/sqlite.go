@@ -11,7 +11,8 @@ import (
 	"time"
 )
 
-// SqliteHistory implements History using the sqlite3 CLI.
+// SqliteHistory implements History using the sqlite3 CLI (one subprocess per query).
+// It predates DBHistory, covers only the original text operations and is kept as a benchmark baseline.
 type SqliteHistory struct {
 	path string
 	mu   sync.Mutex
@@ -22,22 +23,10 @@ func NewSqlite(path string) *SqliteHistory {
 	return &SqliteHistory{path: path}
 }
 
-// Init creates the clipboard_history table if needed and runs the pinned column migration.
+// Init brings the database schema up to date with the same migrations as
+// DBHistory (see Migrate).
 func (s *SqliteHistory) Init() error {
-	_, err := s.runSQL(`CREATE TABLE IF NOT EXISTS clipboard_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		text TEXT NOT NULL,
-		source TEXT NOT NULL,
-		updated_at TEXT NOT NULL,
-		pinned INTEGER NOT NULL DEFAULT 0
-	);
-	ALTER TABLE clipboard_history ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;`)
-	if err == nil {
-		return nil
-	}
-	if strings.Contains(err.Error(), "duplicate column name") {
-		return nil
-	}
+	_, err := Migrate(s.path)
 	return err
 }
 
@@ -0,0 +1,198 @@
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode"
+
+	"local-clipboard/internal/models"
+)
+
+// ErrInvalidTag is returned for a tag name NormalizeTag rejects.
+var ErrInvalidTag = errors.New("invalid tag")
+
+const (
+	maxTagLen       = 32
+	maxTagsPerEntry = 20
+)
+
+// NormalizeTag returns the canonical form of a tag name: trimmed and lower-cased,
+// 1–32 letters, digits, '-', '_' or '.'.
+func NormalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || len([]rune(name)) > maxTagLen {
+		return "", ErrInvalidTag
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return "", ErrInvalidTag
+		}
+	}
+	return name, nil
+}
+
+// NormalizeTags normalizes each name and drops duplicates.
+func NormalizeTags(names []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, n := range names {
+		tag, err := NormalizeTag(n)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	if len(out) > maxTagsPerEntry {
+		return nil, ErrInvalidTag
+	}
+	return out, nil
+}
+
+// initTags creates the tag tables: clipboard_tags holds each name once and
+// clipboard_entry_tags links names to entries. The trigger drops an entry's links
+// when the entry is deleted, however that happens (Delete, Prune, DeleteExpired).
+func initTags(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS clipboard_tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS clipboard_entry_tags (
+		entry_id INTEGER NOT NULL,
+		tag_id INTEGER NOT NULL,
+		PRIMARY KEY (entry_id, tag_id)
+	) WITHOUT ROWID;
+	CREATE INDEX IF NOT EXISTS idx_entry_tags_tag ON clipboard_entry_tags(tag_id, entry_id);
+	CREATE TRIGGER IF NOT EXISTS clipboard_tags_ad AFTER DELETE ON clipboard_history BEGIN
+		DELETE FROM clipboard_entry_tags WHERE entry_id=old.id;
+	END`)
+	return err
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// addTags links the (normalized) tags to entry id, creating names as needed.
+func addTags(q queryer, id int64, tags []string) error {
+	for _, tag := range tags {
+		if _, err := q.Exec("INSERT INTO clipboard_tags(name) VALUES(?) ON CONFLICT(name) DO NOTHING", tag); err != nil {
+			return err
+		}
+		if _, err := q.Exec(`INSERT OR IGNORE INTO clipboard_entry_tags(entry_id, tag_id)
+			SELECT h.id, t.id FROM clipboard_history h, clipboard_tags t WHERE h.id=? AND t.name=?`, id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachTags fills in the Tags of entries, sorted by name.
+func attachTags(q queryer, entries []models.ClipboardUpdate) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	idx := make(map[int64]int, len(entries))
+	args := make([]any, len(entries))
+	for i, e := range entries {
+		idx[e.ID] = i
+		args[i] = e.ID
+	}
+	rows, err := q.Query(`SELECT et.entry_id, t.name FROM clipboard_entry_tags et JOIN clipboard_tags t ON t.id = et.tag_id
+		WHERE et.entry_id IN (?`+strings.Repeat(",?", len(entries)-1)+`) ORDER BY t.name`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		if i, ok := idx[id]; ok {
+			entries[i].Tags = append(entries[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// withTags attaches tags to a single entry returned by a lookup.
+func (s *DBHistory) withTags(e models.ClipboardUpdate, err error) (models.ClipboardUpdate, error) {
+	if err != nil {
+		return e, err
+	}
+	one := []models.ClipboardUpdate{e}
+	if err := attachTags(s.db, one); err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	return one[0], nil
+}
+
+// UpdateTags removes the remove tags from the entry with the given id, then
+// adds the add tags, in one transaction. Names are normalized with NormalizeTag;
+// tags the entry does not have are ignored. An invalid name, or more than
+// maxTagsPerEntry tags afterwards, fails with ErrInvalidTag and leaves the entry
+// unchanged.
+func (s *DBHistory) UpdateTags(id int64, add, remove []string) error {
+	add, err := NormalizeTags(add)
+	if err != nil {
+		return err
+	}
+	remove, err = NormalizeTags(remove)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, tag := range remove {
+		if _, err := tx.Exec("DELETE FROM clipboard_entry_tags WHERE entry_id=? AND tag_id=(SELECT id FROM clipboard_tags WHERE name=?)", id, tag); err != nil {
+			return err
+		}
+	}
+	if err := addTags(tx, id, add); err != nil {
+		return err
+	}
+	var n int
+	if err := tx.QueryRow("SELECT count(*) FROM clipboard_entry_tags WHERE entry_id=?", id).Scan(&n); err != nil {
+		return err
+	}
+	if n > maxTagsPerEntry {
+		return ErrInvalidTag
+	}
+	return tx.Commit()
+}
+
+// Tags returns the tags used in channel with the number of entries carrying
+// each, most used first. Like List it only counts live entries.
+func (s *DBHistory) Tags(channel string) ([]models.TagCount, error) {
+	rows, err := s.db.Query(`SELECT t.name, count(*) AS n FROM clipboard_tags t
+		JOIN clipboard_entry_tags et ON et.tag_id = t.id
+		JOIN clipboard_history h ON h.id = et.entry_id
+		WHERE h.channel=? AND h.max_reads=0 AND `+liveCond+`
+		GROUP BY t.id ORDER BY n DESC, t.name`, channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.TagCount{}
+	for rows.Next() {
+		var tc models.TagCount
+		if err := rows.Scan(&tc.Name, &tc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, tc)
+	}
+	return out, rows.Err()
+}
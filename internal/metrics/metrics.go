@@ -0,0 +1,341 @@
+// Package metrics implements the small part of the Prometheus client needed
+// here: counters and histograms with labels, gauges read at scrape time, and
+// the text exposition format (version 0.0.4) served on /metrics.
+//
+// All methods are safe for concurrent use, and methods on a nil *Registry,
+// *Counter or *Histogram do nothing, so callers need not check whether
+// metrics are enabled.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// maxSeries caps the label combinations of one metric. Labels such as a
+// client's source name come from requests; past the cap new combinations are
+// counted under OtherLabel so a misbehaving client cannot grow memory without bound.
+const maxSeries = 200
+
+// OtherLabel replaces every label value of series beyond maxSeries.
+const OtherLabel = "other"
+
+// DefBuckets are upper bounds in seconds suited to HTTP request latency.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is one metric family in a Registry.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics and writes them in the text exposition format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []collector
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.metrics {
+		if m.name() == c.name() {
+			panic("metrics: duplicate metric " + c.name())
+		}
+	}
+	r.metrics = append(r.metrics, c)
+}
+
+// Counter registers a counter with the given label names and returns it.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	c := &Counter{family: newFamily(name, help, labels)}
+	r.register(c)
+	return c
+}
+
+// Histogram registers a histogram with the given bucket upper bounds (in
+// increasing order; +Inf is implied) and label names, and returns it.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	h := &Histogram{family: newFamily(name, help, labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// GaugeFunc registers a gauge whose value is read from fn at every scrape.
+// When fn fails the sample is left out of that scrape.
+func (r *Registry) GaugeFunc(name, help string, fn func() (float64, error)) {
+	if r == nil {
+		return
+	}
+	r.register(&gaugeFunc{family: newFamily(name, help, nil), fn: fn})
+}
+
+// WriteTo writes every metric in the text exposition format, in the order
+// they were registered.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if r == nil {
+		return 0, nil
+	}
+	r.mu.Lock()
+	metrics := append([]collector(nil), r.metrics...)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		if req.Method == http.MethodGet {
+			_, _ = r.WriteTo(w)
+		}
+	})
+}
+
+// family holds what every metric type shares: name, help and the label
+// values of each series, keyed by their joined form.
+type family struct {
+	fname  string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string][]string // key -> label values
+}
+
+func newFamily(name, help string, labels []string) family {
+	return family{fname: name, help: help, labels: labels, series: map[string][]string{}}
+}
+
+func (f *family) name() string { return f.fname }
+
+// key returns the series key for values, registering the series if there is
+// room; it must be called with f.mu held.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.fname, len(f.labels), len(values)))
+	}
+	k := strings.Join(values, "\xff")
+	if _, ok := f.series[k]; ok {
+		return k
+	}
+	if len(f.series) >= maxSeries {
+		other := make([]string, len(values))
+		for i := range other {
+			other[i] = OtherLabel
+		}
+		values = other
+		k = strings.Join(values, "\xff")
+	}
+	f.series[k] = append([]string(nil), values...)
+	return k
+}
+
+// sortedKeys returns the series keys in a stable order; f.mu must be held.
+func (f *family) sortedKeys() []string {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *family) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.fname, escapeHelp(f.help), f.fname, typ)
+}
+
+// labelPairs formats names and values as {a="x",b="y"}, with extra appended
+// (used for the "le" label of histogram buckets).
+func labelPairs(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n + `="` + escapeLabel(values[i]) + `"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i] + `="` + escapeLabel(extra[i+1]) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Counter is a monotonically increasing value per label combination.
+type Counter struct {
+	family
+	values map[string]float64
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v (which must not be negative) to the series with the given label values.
+func (c *Counter) Add(v float64, labels ...string) {
+	if c == nil || v < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = map[string]float64{}
+	}
+	c.values[c.key(labels)] += v
+}
+
+// Value returns the current value of the series with the given label values.
+func (c *Counter) Value(labels ...string) float64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labels, "\xff")]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.fname, labelPairs(c.labels, c.series[k]), formatFloat(c.values[k]))
+	}
+}
+
+// Histogram counts observations in cumulative buckets per label combination.
+type Histogram struct {
+	family
+	buckets []float64
+	values  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, labels ...string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.values == nil {
+		h.values = map[string]*histogramSeries{}
+	}
+	k := h.key(labels)
+	s := h.values[k]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.values[k] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, v) // First bound >= v
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, k := range h.sortedKeys() {
+		s, values := h.values[k], h.series[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, labelPairs(h.labels, values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, labelPairs(h.labels, values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fname, labelPairs(h.labels, values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fname, labelPairs(h.labels, values), s.count)
+	}
+}
+
+type gaugeFunc struct {
+	family
+	fn func() (float64, error)
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	v, err := g.fn()
+	g.header(w, "gauge")
+	if err == nil {
+		fmt.Fprintf(w, "%s %s\n", g.fname, formatFloat(v))
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.Counter("requests_total", "Requests.\nBy route.", "route", "status")
+	h := reg.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	reg.GaugeFunc("rows", "Rows.", func() (float64, error) { return 42, nil })
+
+	c.Inc("/api/clipboard", "200")
+	c.Add(2, "/api/clipboard", "200")
+	c.Inc(`say "hi"`, "404")
+	h.Observe(0.05, "/a")
+	h.Observe(0.1, "/a")
+	h.Observe(3, "/a")
+
+	var b strings.Builder
+	if _, err := reg.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests.\nBy route.
+# TYPE requests_total counter
+requests_total{route="/api/clipboard",status="200"} 3
+requests_total{route="say \"hi\"",status="404"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 2
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 3.15
+latency_seconds_count{route="/a"} 3
+# HELP rows Rows.
+# TYPE rows gauge
+rows 42
+`
+	if got := b.String(); got != want {
+		t.Fatalf("exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSeriesCap(t *testing.T) {
+	c := NewRegistry().Counter("by_source_total", "", "source")
+	for i := 0; i < maxSeries+10; i++ {
+		c.Inc("source-" + strconv.Itoa(i))
+	}
+	if got := c.Value(OtherLabel); got != 10 {
+		t.Fatalf("overflow series = %v, want 10", got)
+	}
+	if got := c.Value("source-0"); got != 1 {
+		t.Fatalf("first series = %v, want 1", got)
+	}
+}
+
+func TestNilIsNoop(t *testing.T) {
+	var reg *Registry
+	c := reg.Counter("x_total", "")
+	c.Inc()
+	reg.Histogram("y", "", DefBuckets).Observe(1)
+	reg.GaugeFunc("z", "", func() (float64, error) { return 1, nil })
+	if n, err := reg.WriteTo(&strings.Builder{}); n != 0 || err != nil {
+		t.Fatalf("nil registry wrote %d bytes (%v)", n, err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("up_total", "Up.").Inc()
+	rr := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != ContentType || !strings.Contains(rr.Body.String(), "up_total 1\n") {
+		t.Fatalf("GET /metrics = %d %q %q", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+}
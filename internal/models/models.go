@@ -1,12 +1,131 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// MimeText is the MIME type of plain text entries.
+const MimeText = "text/plain"
+
+// Markers around matched terms in ClipboardUpdate.Snippet. Control characters
+// are used so clients can escape the text and then highlight safely.
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// DefaultChannel is used when a request or entry names no channel.
+const DefaultChannel = "default"
 
 // ClipboardUpdate is a single clipboard entry (in-memory or from history).
+// Binary entries (e.g. images) carry only metadata here; the payload is served
+// separately from /api/clipboard/blob.
 type ClipboardUpdate struct {
 	ID        int64     `json:"id"`
+	Channel   string    `json:"channel"`
 	Text      string    `json:"text"`
 	Source    string    `json:"source"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Pinned    bool      `json:"pinned"`
+	CopyCount int       `json:"copy_count"` // How often this content was copied; repeats bump it instead of adding entries
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	Tags      []string  `json:"tags,omitempty"` // Sorted by name
+
+	// Snippet is set on search results: an excerpt around the matches, each
+	// match wrapped in SnippetMatchStart/SnippetMatchEnd.
+	Snippet string `json:"snippet,omitempty"`
+
+	// End-to-end encrypted entries carry base64 ciphertext in Text; only clients
+	// holding the passphrase for KeyID can decrypt it.
+	Encrypted bool   `json:"encrypted,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+
+	// Sensitive entries looked like a secret (see package sensitive) and are left
+	// out of search results. Entries with ExpiresAt are deleted once it passes.
+	Sensitive bool       `json:"sensitive,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Burn-after-read entries (MaxReads > 0) can be fetched MaxReads times; Reads
+	// counts the fetches so far.
+	MaxReads int `json:"max_reads,omitempty"`
+	Reads    int `json:"reads,omitempty"`
+}
+
+// ChannelName returns the entry's channel, or DefaultChannel when unset.
+func (c ClipboardUpdate) ChannelName() string {
+	if c.Channel == "" {
+		return DefaultChannel
+	}
+	return c.Channel
+}
+
+// IsBlob reports whether the entry holds a binary payload rather than text.
+func (c ClipboardUpdate) IsBlob() bool {
+	return c.MimeType != "" && !strings.HasPrefix(c.MimeType, "text/")
+}
+
+// IsEmpty reports whether the entry has neither text nor a binary payload.
+func (c ClipboardUpdate) IsEmpty() bool {
+	return strings.TrimSpace(c.Text) == "" && !c.IsBlob()
+}
+
+// Expired reports whether the entry has passed its expiry time or used up its reads.
+func (c ClipboardUpdate) Expired(now time.Time) bool {
+	return (c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)) || (c.MaxReads > 0 && c.Reads >= c.MaxReads)
+}
+
+// Event types pushed on the /api/events stream.
+const (
+	EventNew     = "new"
+	EventPinned  = "pinned"
+	EventDeleted = "deleted"
+	EventTagged  = "tagged"
+)
+
+// Event is a clipboard change published to stream subscribers.
+type Event struct {
+	ID    int64           `json:"id"`
+	Type  string          `json:"type"`
+	Entry ClipboardUpdate `json:"entry"`
+}
+
+// TagCount is a tag and the number of entries carrying it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Device is a paired client allowed to call the API with its bearer token.
+type Device struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeviceStatus is a client known to the server's presence registry, keyed by the
+// stable id the client generates on first run.
+type DeviceStatus struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`                // Source label the client syncs as
+	PairedID  int64     `json:"paired_id,omitempty"` // Paired device (see Device) the client authenticated as
+	IP        string    `json:"ip"`
+	Version   string    `json:"version"`
+	Backend   string    `json:"backend"` // Clipboard tool the client uses, e.g. "wl-paste"
+	Channel   string    `json:"channel"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Online    bool      `json:"online"`
+}
+
+// Channel is a named clipboard with its own latest value and history.
+// Protected channels require their channel token in addition to the device token.
+type Channel struct {
+	Name      string    `json:"name"`
+	Protected bool      `json:"protected"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
 }
@@ -0,0 +1,155 @@
+// Package presence tracks which clients are connected to the server and when
+// each was last seen.
+package presence
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+// persistEvery bounds how often an unchanged device's last-seen time is written
+// to the database; clients poll every second and that would be a write each time.
+const persistEvery = time.Minute
+
+type entry struct {
+	status      models.DeviceStatus
+	streams     int // open event streams; a device with a stream is online
+	persistedAt time.Time
+}
+
+// Registry is the server's device registry. Devices are kept in memory and
+// persisted to SQLite so the list survives restarts.
+type Registry struct {
+	db           *sql.DB
+	offlineAfter time.Duration
+	now          func() time.Time
+
+	mu   sync.Mutex
+	byID map[string]*entry
+}
+
+// NewRegistry returns a Registry backed by db that reports devices as offline
+// once nothing has been heard from them for offlineAfter. Call Init before use.
+func NewRegistry(db *sql.DB, offlineAfter time.Duration) *Registry {
+	return &Registry{db: db, offlineAfter: offlineAfter, now: time.Now, byID: make(map[string]*entry)}
+}
+
+// Init loads known devices. The client_devices table is created by the
+// history database migrations.
+func (r *Registry) Init() error {
+	rows, err := r.db.Query("SELECT id,name,paired_id,ip,version,backend,channel,first_seen,last_seen FROM client_devices")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for rows.Next() {
+		var (
+			d                   models.DeviceStatus
+			firstSeen, lastSeen string
+		)
+		if err := rows.Scan(&d.ID, &d.Name, &d.PairedID, &d.IP, &d.Version, &d.Backend, &d.Channel, &firstSeen, &lastSeen); err != nil {
+			return err
+		}
+		d.FirstSeen, _ = time.Parse(time.RFC3339Nano, firstSeen)
+		d.LastSeen, _ = time.Parse(time.RFC3339Nano, lastSeen)
+		r.byID[d.ID] = &entry{status: d, persistedAt: d.LastSeen}
+	}
+	return rows.Err()
+}
+
+// Seen records a request from the device d.ID. Empty fields of d keep their
+// previous values; LastSeen (and FirstSeen for new devices) are set here.
+func (r *Registry) Seen(d models.DeviceStatus) {
+	if d.ID == "" {
+		return
+	}
+	now := r.now().UTC()
+	r.mu.Lock()
+	e, ok := r.byID[d.ID]
+	if !ok {
+		e = &entry{status: models.DeviceStatus{ID: d.ID, FirstSeen: now}}
+		r.byID[d.ID] = e
+	}
+	changed := !ok
+	for _, f := range []struct {
+		dst *string
+		v   string
+	}{
+		{&e.status.Name, d.Name},
+		{&e.status.IP, d.IP},
+		{&e.status.Version, d.Version},
+		{&e.status.Backend, d.Backend},
+		{&e.status.Channel, d.Channel},
+	} {
+		if f.v != "" && *f.dst != f.v {
+			*f.dst, changed = f.v, true
+		}
+	}
+	if d.PairedID != 0 && e.status.PairedID != d.PairedID {
+		e.status.PairedID, changed = d.PairedID, true
+	}
+	e.status.LastSeen = now
+	persist := changed || now.Sub(e.persistedAt) >= persistEvery
+	if persist {
+		e.persistedAt = now
+	}
+	snapshot := e.status
+	r.mu.Unlock()
+
+	if persist {
+		if err := r.save(snapshot); err != nil {
+			log.Printf("presence: save device %s: %v", snapshot.ID, err)
+		}
+	}
+}
+
+// Connected marks the device as holding an open event stream until the
+// returned function is called.
+func (r *Registry) Connected(id string) (done func()) {
+	if id == "" {
+		return func() {}
+	}
+	r.mu.Lock()
+	if e, ok := r.byID[id]; ok {
+		e.streams++
+	}
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		if e, ok := r.byID[id]; ok && e.streams > 0 {
+			e.streams--
+		}
+		r.mu.Unlock()
+		r.Seen(models.DeviceStatus{ID: id})
+	}
+}
+
+// List returns all known devices, most recently seen first, with Online set.
+func (r *Registry) List() []models.DeviceStatus {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]models.DeviceStatus, 0, len(r.byID))
+	for _, e := range r.byID {
+		d := e.status
+		d.Online = e.streams > 0 || now.Sub(d.LastSeen) < r.offlineAfter
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+func (r *Registry) save(d models.DeviceStatus) error {
+	_, err := r.db.Exec(`INSERT INTO client_devices(id,name,paired_id,ip,version,backend,channel,first_seen,last_seen) VALUES(?,?,?,?,?,?,?,?,?)
+		ON CONFLICT(id) DO UPDATE SET name=excluded.name, paired_id=excluded.paired_id, ip=excluded.ip, version=excluded.version,
+		backend=excluded.backend, channel=excluded.channel, last_seen=excluded.last_seen`,
+		d.ID, d.Name, d.PairedID, d.IP, d.Version, d.Backend, d.Channel, d.FirstSeen.Format(time.RFC3339Nano), d.LastSeen.Format(time.RFC3339Nano))
+	return err
+}
@@ -0,0 +1,52 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/models"
+)
+
+func newTestRegistry(t *testing.T, path string) *Registry {
+	t.Helper()
+	h := history.NewDB(path)
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	r := NewRegistry(h.DB(), time.Minute)
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRegistryPresence(t *testing.T) {
+	path := t.TempDir() + "/presence.db"
+	r := newTestRegistry(t, path)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	r.Seen(models.DeviceStatus{ID: "abc", Name: "laptop", IP: "10.0.0.2", Version: "1.0", Backend: "wl-paste"})
+	r.Seen(models.DeviceStatus{ID: "abc", IP: "10.0.0.3"})
+	list := r.List()
+	if len(list) != 1 || list[0].Name != "laptop" || list[0].IP != "10.0.0.3" || !list[0].Online {
+		t.Fatalf("unexpected devices: %+v", list)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if r.List()[0].Online {
+		t.Fatal("device should be offline after the silence threshold")
+	}
+	done := r.Connected("abc")
+	if !r.List()[0].Online {
+		t.Fatal("device with an open stream should be online")
+	}
+	done()
+
+	reloaded := newTestRegistry(t, path)
+	if got := reloaded.List(); len(got) != 1 || got[0].IP != "10.0.0.3" || got[0].Backend != "wl-paste" {
+		t.Fatalf("registry not persisted: %+v", got)
+	}
+}
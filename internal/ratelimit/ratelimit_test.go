@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l := New(2, 3)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a", now); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, wait := l.Allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("past the burst: ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Fatal("keys share a bucket")
+	}
+	if ok, _ := l.Allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("bucket did not refill")
+	}
+	if ok, _ := l.Allow("a", now.Add(500*time.Millisecond)); ok {
+		t.Fatal("refilled more than the rate")
+	}
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	l := New(1, 2)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l.Allow("a", now)
+	l.Allow("b", now.Add(time.Hour))
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 1 {
+		t.Fatalf("buckets after sweep: %v", l.buckets)
+	}
+}
+
+func TestNilLimiterAllows(t *testing.T) {
+	l := New(0, 10)
+	if l != nil {
+		t.Fatal("zero rate should disable the limiter")
+	}
+	if ok, _ := l.Allow("a", time.Now()); !ok {
+		t.Fatal("nil limiter refused")
+	}
+}
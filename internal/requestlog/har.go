@@ -0,0 +1,172 @@
+package requestlog
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/) as far as the log
+// can fill it. Fields the log does not keep (cookies, header sizes) are empty
+// or -1 as the spec allows.
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harPair   `json:"cookies"`
+	Headers     []harPair   `json:"headers"`
+	QueryString []harPair   `json:"queryString"`
+	PostData    *harPayload `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harPair  `json:"cookies"`
+	Headers     []harPair  `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int64      `json:"bodySize"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPayload struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// WriteHAR writes entries, in the order given, as a HAR 1.2 file. baseURL
+// (e.g. "https://192.168.1.5:8080") makes the logged paths absolute; creator is
+// the version reported as the creating application's.
+func WriteHAR(w io.Writer, entries []Entry, baseURL, creator string) error {
+	f := harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "local-clipboard", Version: creator},
+		Entries: make([]harEntry, 0, len(entries)),
+	}}
+	for _, e := range entries {
+		f.Log.Entries = append(f.Log.Entries, harFromEntry(e, baseURL))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+func harFromEntry(e Entry, baseURL string) harEntry {
+	proto := e.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	u := baseURL + e.Path
+	if e.Query != "" {
+		u += "?" + e.Query
+	}
+	req := harRequest{
+		Method:      e.Method,
+		URL:         u,
+		HTTPVersion: proto,
+		Cookies:     []harPair{},
+		Headers:     harPairs(e.RequestHeaders),
+		QueryString: harQuery(e.Query),
+		HeadersSize: -1,
+		BodySize:    e.RequestSize,
+	}
+	if e.RequestBody != "" {
+		req.PostData = &harPayload{MimeType: e.RequestHeaders.Get("Content-Type"), Text: e.RequestBody}
+	}
+	he := harEntry{
+		StartedDateTime: e.Timestamp.UTC().Format(time.RFC3339Nano),
+		Time:            e.DurationMS,
+		Request:         req,
+		Response: harResponse{
+			Status:      e.Status,
+			StatusText:  http.StatusText(e.Status),
+			HTTPVersion: proto,
+			Cookies:     []harPair{},
+			Headers:     harPairs(e.ResponseHeaders),
+			Content: harContent{
+				Size:     e.ResponseSize,
+				MimeType: e.ResponseHeaders.Get("Content-Type"),
+				Text:     e.ResponseBody,
+			},
+			RedirectURL: e.ResponseHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    e.ResponseSize,
+		},
+		Timings: harTimings{Wait: e.DurationMS},
+	}
+	if e.RemoteAddr != "" {
+		he.Comment = "client " + e.RemoteAddr
+	}
+	return he
+}
+
+// harPairs lists headers or query values sorted by name, one pair per value.
+func harPairs(h map[string][]string) []harPair {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []harPair{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			pairs = append(pairs, harPair{Name: name, Value: v})
+		}
+	}
+	return pairs
+}
+
+func harQuery(raw string) []harPair {
+	values, _ := url.ParseQuery(raw)
+	return harPairs(values)
+}
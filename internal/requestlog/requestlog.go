@@ -0,0 +1,313 @@
+// Package requestlog keeps the server's HTTP request log: the last requests in
+// memory, or every request in a SQLite table with time-based retention.
+package requestlog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxMemoryEntries is how many entries a memory-only Store keeps.
+const maxMemoryEntries = 500
+
+// ErrInvalidCursor is returned by List for a cursor it did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrNotFound is returned by ByID for an entry that is not (or no longer) in the log.
+var ErrNotFound = errors.New("request log entry not found")
+
+// Entry is a single HTTP request log entry. Bodies are stored as the server
+// chose to log them (truncated, secrets and possibly clipboard text masked);
+// the sizes are those of the full bodies.
+type Entry struct {
+	ID              int64       `json:"id"`
+	Method          string      `json:"method"`
+	Path            string      `json:"path"`
+	Query           string      `json:"query,omitempty"` // Raw query string, without "?"
+	Proto           string      `json:"proto,omitempty"` // e.g. "HTTP/1.1"
+	Status          int         `json:"status"`
+	RemoteAddr      string      `json:"remote_addr"`
+	Timestamp       time.Time   `json:"timestamp"`
+	DurationMS      float64     `json:"duration_ms"`
+	RequestHeaders  http.Header `json:"request_headers,omitempty"` // Credentials masked
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	RequestBody     string      `json:"request_body,omitempty"`
+	ResponseBody    string      `json:"response_body,omitempty"`
+	RequestSize     int64       `json:"request_size"`
+	ResponseSize    int64       `json:"response_size"`
+	Replayable      bool        `json:"replayable"` // RequestBody is the complete, unmasked request body
+}
+
+// Query selects a page of entries for List. Zero values mean "no filter".
+type Query struct {
+	Limit  int    // Page size
+	Cursor string // Opaque cursor from a previous Page.NextCursor
+
+	Method     string    // Only this method
+	PathPrefix string    // Only paths starting with this
+	StatusMin  int       // Only statuses at or above this
+	StatusMax  int       // Only statuses at or below this
+	RemoteAddr string    // Only requests from this address
+	Since      time.Time // Only requests at or after this time
+	Until      time.Time // Only requests before this time
+	Search     string    // Only entries whose path or bodies contain this (case-insensitive)
+}
+
+// Page is one page of List results, newest first.
+type Page struct {
+	Items      []Entry `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"` // Empty on the last page
+	Total      int     `json:"total"`                 // Entries matching the query across all pages
+}
+
+// Store is the request log. Entries get increasing IDs, so the newest entry
+// has the highest ID.
+type Store struct {
+	db        *sql.DB       // nil keeps entries in memory only
+	retention time.Duration // Age after which Prune removes persisted entries; 0 keeps them
+
+	mu      sync.Mutex
+	entries []Entry // Memory-only store, oldest first
+	nextID  int64
+}
+
+// NewMemory returns a Store that keeps the last maxMemoryEntries entries in memory.
+func NewMemory() *Store {
+	return &Store{entries: make([]Entry, 0, maxMemoryEntries)}
+}
+
+// NewDB returns a Store that persists entries to db and, when retention is
+// positive, lets Prune remove those older than it. The request_logs table is
+// created by the history database migrations.
+func NewDB(db *sql.DB, retention time.Duration) *Store {
+	return &Store{db: db, retention: retention}
+}
+
+// Persistent reports whether entries are kept in the database.
+func (s *Store) Persistent() bool {
+	return s.db != nil
+}
+
+// Add records e, assigning its ID. Failures to persist are logged, not returned:
+// a full disk must not fail the request being logged.
+func (s *Store) Add(e Entry) {
+	if s.db != nil {
+		if _, err := s.db.Exec(`INSERT INTO request_logs(method,path,query,proto,status,remote_addr,timestamp,duration_ms,request_headers,response_headers,request_body,response_body,request_size,response_size,replayable)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`, e.Method, e.Path, e.Query, e.Proto, e.Status, e.RemoteAddr, e.Timestamp.UnixNano(), e.DurationMS,
+			encodeHeader(e.RequestHeaders), encodeHeader(e.ResponseHeaders), e.RequestBody, e.ResponseBody, e.RequestSize, e.ResponseSize, e.Replayable); err != nil {
+			log.Printf("request log: %v", err)
+		}
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	e.ID = s.nextID
+	s.entries = append(s.entries, e)
+	if len(s.entries) > maxMemoryEntries {
+		s.entries = s.entries[len(s.entries)-maxMemoryEntries:]
+	}
+}
+
+// List returns a page of entries matching q, newest first.
+func (s *Store) List(q Query) (Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	var beforeID int64
+	if q.Cursor != "" {
+		id, err := strconv.ParseInt(q.Cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return Page{}, ErrInvalidCursor
+		}
+		beforeID = id
+	}
+	if s.db != nil {
+		return s.listDB(q, beforeID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := Page{Items: []Entry{}}
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		e := s.entries[i]
+		if !q.matches(e) {
+			continue
+		}
+		page.Total++
+		if beforeID > 0 && e.ID >= beforeID {
+			continue
+		}
+		if len(page.Items) == q.Limit {
+			page.NextCursor = strconv.FormatInt(page.Items[q.Limit-1].ID, 10)
+			continue
+		}
+		page.Items = append(page.Items, e)
+	}
+	return page, nil
+}
+
+func (q Query) matches(e Entry) bool {
+	search := strings.ToLower(q.Search)
+	return (q.Method == "" || e.Method == q.Method) &&
+		strings.HasPrefix(e.Path, q.PathPrefix) &&
+		(q.StatusMin == 0 || e.Status >= q.StatusMin) &&
+		(q.StatusMax == 0 || e.Status <= q.StatusMax) &&
+		(q.RemoteAddr == "" || e.RemoteAddr == q.RemoteAddr) &&
+		(q.Since.IsZero() || !e.Timestamp.Before(q.Since)) &&
+		(q.Until.IsZero() || e.Timestamp.Before(q.Until)) &&
+		(search == "" || strings.Contains(strings.ToLower(e.Path), search) ||
+			strings.Contains(strings.ToLower(e.RequestBody), search) ||
+			strings.Contains(strings.ToLower(e.ResponseBody), search))
+}
+
+func (s *Store) listDB(q Query, beforeID int64) (Page, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, a ...any) {
+		conds = append(conds, cond)
+		args = append(args, a...)
+	}
+	if q.Method != "" {
+		add("method = ?", q.Method)
+	}
+	if q.PathPrefix != "" {
+		add("substr(path, 1, length(?)) = ?", q.PathPrefix, q.PathPrefix)
+	}
+	if q.StatusMin != 0 {
+		add("status >= ?", q.StatusMin)
+	}
+	if q.StatusMax != 0 {
+		add("status <= ?", q.StatusMax)
+	}
+	if q.RemoteAddr != "" {
+		add("remote_addr = ?", q.RemoteAddr)
+	}
+	if !q.Since.IsZero() {
+		add("timestamp >= ?", q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		add("timestamp < ?", q.Until.UnixNano())
+	}
+	if q.Search != "" {
+		like := "%" + likeEscaper.Replace(q.Search) + "%"
+		add(`(path LIKE ? ESCAPE '\' OR request_body LIKE ? ESCAPE '\' OR response_body LIKE ? ESCAPE '\')`, like, like, like)
+	}
+	filter := ""
+	if len(conds) > 0 {
+		filter = " WHERE " + strings.Join(conds, " AND ")
+	}
+	page := Page{Items: []Entry{}}
+	if err := s.db.QueryRow("SELECT count(*) FROM request_logs"+filter, args...).Scan(&page.Total); err != nil {
+		return Page{}, err
+	}
+	if beforeID > 0 {
+		if filter == "" {
+			filter = " WHERE id < ?"
+		} else {
+			filter += " AND id < ?"
+		}
+		args = append(args, beforeID)
+	}
+	rows, err := s.db.Query("SELECT "+entryColumns+" FROM request_logs"+filter+" ORDER BY id DESC LIMIT ?", append(args, q.Limit+1)...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Items = append(page.Items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+	if len(page.Items) > q.Limit {
+		page.Items = page.Items[:q.Limit]
+		page.NextCursor = strconv.FormatInt(page.Items[q.Limit-1].ID, 10)
+	}
+	return page, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ByID returns the entry with the given ID, or ErrNotFound.
+func (s *Store) ByID(id int64) (Entry, error) {
+	if s.db != nil {
+		e, err := scanEntry(s.db.QueryRow("SELECT "+entryColumns+" FROM request_logs WHERE id=?", id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return Entry{}, ErrNotFound
+		}
+		return e, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+const entryColumns = `id,method,path,query,proto,status,remote_addr,timestamp,duration_ms,request_headers,response_headers,
+	request_body,response_body,request_size,response_size,replayable`
+
+func scanEntry(row interface{ Scan(...any) error }) (Entry, error) {
+	var (
+		e               Entry
+		ns              int64
+		reqHdr, respHdr string
+	)
+	if err := row.Scan(&e.ID, &e.Method, &e.Path, &e.Query, &e.Proto, &e.Status, &e.RemoteAddr, &ns, &e.DurationMS, &reqHdr, &respHdr,
+		&e.RequestBody, &e.ResponseBody, &e.RequestSize, &e.ResponseSize, &e.Replayable); err != nil {
+		return Entry{}, err
+	}
+	e.Timestamp = time.Unix(0, ns).UTC()
+	e.RequestHeaders, e.ResponseHeaders = decodeHeader(reqHdr), decodeHeader(respHdr)
+	return e, nil
+}
+
+// encodeHeader stores h as JSON; an empty header is stored as "".
+func encodeHeader(h http.Header) string {
+	if len(h) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func decodeHeader(s string) http.Header {
+	if s == "" {
+		return nil
+	}
+	var h http.Header
+	if json.Unmarshal([]byte(s), &h) != nil {
+		return nil
+	}
+	return h
+}
+
+// Prune removes persisted entries older than the retention and returns how
+// many it removed. Memory-only stores and stores without retention keep everything.
+func (s *Store) Prune(now time.Time) (int64, error) {
+	if s.db == nil || s.retention <= 0 {
+		return 0, nil
+	}
+	res, err := s.db.Exec("DELETE FROM request_logs WHERE timestamp < ?", now.Add(-s.retention).UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
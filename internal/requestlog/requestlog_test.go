@@ -0,0 +1,113 @@
+package requestlog
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"local-clipboard/internal/history"
+)
+
+func newTestStores(t *testing.T) map[string]*Store {
+	t.Helper()
+	h := history.NewDB(t.TempDir() + "/logs.db")
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	persistent := NewDB(h.DB(), time.Hour)
+	return map[string]*Store{"memory": NewMemory(), "sqlite": persistent}
+}
+
+func TestListFiltersAndPages(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for name, s := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, e := range []Entry{
+				{Method: "POST", Path: "/api/clipboard", Status: 201, RemoteAddr: "10.0.0.2", RequestBody: `{"text":"[redacted: 5 bytes]"}`},
+				{Method: "GET", Path: "/api/clipboard", Status: 200, RemoteAddr: "10.0.0.3"},
+				{Method: "GET", Path: "/api/history", Status: 200, RemoteAddr: "10.0.0.2"},
+				{Method: "POST", Path: "/api/clipboard", Status: 400, RemoteAddr: "10.0.0.2", ResponseBody: "text is required"},
+				{Method: "GET", Path: "/", Status: 200, RemoteAddr: "10.0.0.4"},
+			} {
+				e.Timestamp = base.Add(time.Duration(i) * time.Minute)
+				s.Add(e)
+			}
+			count := func(q Query) int {
+				t.Helper()
+				page, err := s.List(q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return page.Total
+			}
+			for _, c := range []struct {
+				name string
+				q    Query
+				want int
+			}{
+				{"all", Query{}, 5},
+				{"method", Query{Method: "POST"}, 2},
+				{"path prefix", Query{PathPrefix: "/api/"}, 4},
+				{"client errors", Query{StatusMin: 400, StatusMax: 499}, 1},
+				{"remote", Query{RemoteAddr: "10.0.0.2"}, 3},
+				{"window", Query{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}, 2},
+				{"search", Query{Search: "REQUIRED"}, 1},
+				{"search literal percent", Query{Search: "100%"}, 0},
+			} {
+				if got := count(c.q); got != c.want {
+					t.Errorf("%s: %d entries, want %d", c.name, got, c.want)
+				}
+			}
+
+			page, err := s.List(Query{Limit: 2, Method: "GET"})
+			if err != nil || len(page.Items) != 2 || page.Items[0].Path != "/" || page.NextCursor == "" {
+				t.Fatalf("first page = %+v (%v)", page, err)
+			}
+			next, err := s.List(Query{Limit: 2, Method: "GET", Cursor: page.NextCursor})
+			if err != nil || len(next.Items) != 1 || next.Items[0].Path != "/api/clipboard" || next.NextCursor != "" || next.Total != 3 {
+				t.Fatalf("second page = %+v (%v)", next, err)
+			}
+			if !next.Items[0].Timestamp.Equal(base.Add(time.Minute)) {
+				t.Fatalf("timestamp = %v", next.Items[0].Timestamp)
+			}
+			if _, err := s.List(Query{Cursor: "nope"}); err != ErrInvalidCursor {
+				t.Fatalf("bad cursor: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := newTestStores(t)["sqlite"]
+	now := time.Now()
+	s.Add(Entry{Method: "GET", Path: "/old", Status: 200, Timestamp: now.Add(-2 * time.Hour)})
+	s.Add(Entry{Method: "GET", Path: "/new", Status: 200, Timestamp: now})
+	if n, err := s.Prune(now); err != nil || n != 1 {
+		t.Fatalf("prune removed %d (%v), want 1", n, err)
+	}
+	page, _ := s.List(Query{})
+	if len(page.Items) != 1 || page.Items[0].Path != "/new" {
+		t.Fatalf("after prune: %+v", page.Items)
+	}
+}
+
+func TestByIDKeepsHeaders(t *testing.T) {
+	for name, s := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s.Add(Entry{Method: "GET", Path: "/api/history", Query: "q=a", Status: 200, Timestamp: time.Now(), DurationMS: 1.5,
+				RequestHeaders: http.Header{"Accept": {"application/json"}}, Replayable: true})
+			page, err := s.List(Query{})
+			if err != nil || len(page.Items) != 1 {
+				t.Fatalf("list: %v %+v", err, page)
+			}
+			e, err := s.ByID(page.Items[0].ID)
+			if err != nil || e.Query != "q=a" || e.DurationMS != 1.5 || e.RequestHeaders.Get("Accept") != "application/json" || !e.Replayable {
+				t.Fatalf("ByID = %+v, %v", e, err)
+			}
+			if _, err := s.ByID(e.ID + 1); err != ErrNotFound {
+				t.Fatalf("missing entry: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package sensitive
+
+import "fmt"
+
+// Action is what happens to clipboard text that contains a secret.
+type Action string
+
+const (
+	ActionOff    Action = "off"    // Store and sync it unchanged
+	ActionRefuse Action = "refuse" // Do not store or sync it
+	ActionExpire Action = "expire" // Store it flagged as sensitive, with a short TTL
+	ActionMask   Action = "mask"   // Store it with the secrets masked
+)
+
+// ParseAction parses a flag value; "" is ActionOff.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case "":
+		return ActionOff, nil
+	case ActionOff, ActionRefuse, ActionExpire, ActionMask:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown sensitive-content action %q (want off, refuse, expire or mask)", s)
+}
+
+// Verdict is the outcome of applying an Action to a text.
+type Verdict struct {
+	Text      string    // Text to store: the input, or a masked copy
+	Findings  []Finding // Secrets found in the input
+	Refuse    bool      // The text must not be stored
+	Sensitive bool      // Store with the sensitive flag and TTL
+}
+
+// Apply scans text and decides what to do with it. The zero Action behaves like ActionOff.
+func (a Action) Apply(text string) Verdict {
+	v := Verdict{Text: text}
+	if a == "" || a == ActionOff {
+		return v
+	}
+	if v.Findings = Scan(text); len(v.Findings) == 0 {
+		return v
+	}
+	switch a {
+	case ActionRefuse:
+		v.Refuse = true
+	case ActionMask:
+		v.Text = Mask(text, v.Findings)
+	case ActionExpire:
+		v.Sensitive = true
+	}
+	return v
+}
@@ -0,0 +1,192 @@
+// Package sensitive detects secrets in clipboard text: API keys, tokens, private
+// keys, one-time passwords and other high-entropy strings.
+package sensitive
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Finding is a detected secret at text[Start:End].
+type Finding struct {
+	Rule  string `json:"rule"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Rule matches one kind of secret.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// Rules are the known token formats checked by Scan.
+var Rules = []Rule{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----(?s:.*?)(-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----|\z)`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"aws-access-key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github-token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"gitlab-token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"stripe-key", regexp.MustCompile(`\b[sr]k_(live|test)_[A-Za-z0-9]{16,}\b`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"api-key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{"password-assignment", regexp.MustCompile(`(?i)(password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token)\s*[:=]\s*["']?[^\s"']{6,}`)},
+}
+
+// otpPatterns match a one-time password ("482913", "482 913" or 7-8 digits) next
+// to words saying what it is, as in "Your verification code is 482913" or
+// "482 913 is your login code". A bare number is not enough: order numbers,
+// PINs, postal codes and phone numbers look the same. The first group is the
+// password.
+var otpPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b` + otpWords + `\b[^\d\n]{0,20}?\b(\d{3} ?\d{3}|\d{7,8})\b`),
+	regexp.MustCompile(`(?i)\b(\d{3} ?\d{3}|\d{7,8})\b[^\d\n]{0,40}?\b` + otpWords + `\b`),
+}
+
+const otpWords = `(?:(?:verification|security|login|sign[- ]?in|confirmation|access|auth(?:entication)?|one[- ]time|your) code|otp|passcode|2fa|one[- ]time password)`
+
+// Thresholds for the entropy rule: a token of at least minTokenLen characters
+// mixing upper case, lower case and digits, with at least minEntropy bits per character.
+const (
+	minTokenLen = 20
+	minEntropy  = 4.0
+)
+
+// Scan returns the secrets found in text, ordered by position and not overlapping.
+func Scan(text string) []Finding {
+	var found []Finding
+	for _, r := range Rules {
+		for _, m := range r.Pattern.FindAllStringIndex(text, -1) {
+			found = append(found, Finding{Rule: r.Name, Start: m[0], End: m[1]})
+		}
+	}
+	for _, p := range otpPatterns {
+		for _, m := range p.FindAllStringSubmatchIndex(text, -1) {
+			found = append(found, Finding{Rule: "one-time-password", Start: m[2], End: m[3]})
+		}
+	}
+	for _, t := range tokens(text) {
+		if isHighEntropy(text[t[0]:t[1]]) {
+			found = append(found, Finding{Rule: "high-entropy", Start: t[0], End: t[1]})
+		}
+	}
+	return merge(found)
+}
+
+// Names returns the distinct rule names of findings.
+func Names(findings []Finding) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, f := range findings {
+		if !seen[f.Rule] {
+			seen[f.Rule] = true
+			names = append(names, f.Rule)
+		}
+	}
+	return names
+}
+
+// Mask replaces each finding in text with its first four characters followed by "****".
+func Mask(text string, findings []Finding) string {
+	var b strings.Builder
+	last := 0
+	for _, f := range findings {
+		b.WriteString(text[last:f.Start])
+		keep := f.Start + 4
+		if keep > f.End {
+			keep = f.Start
+		}
+		b.WriteString(text[f.Start:keep])
+		b.WriteString("****")
+		last = f.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Redact masks every secret Scan finds in text.
+func Redact(text string) string {
+	found := Scan(text)
+	if len(found) == 0 {
+		return text
+	}
+	return Mask(text, found)
+}
+
+// tokens splits text on whitespace, quotes, brackets and separators, returning
+// the byte ranges of the pieces. Path and URL separators split too, so long
+// paths are not mistaken for one random string.
+func tokens(text string) [][2]int {
+	var out [][2]int
+	start := -1
+	for i, r := range text {
+		sep := unicode.IsSpace(r) || strings.ContainsRune("\"'`,;:()[]{}<>|=/.?&", r)
+		switch {
+		case sep && start >= 0:
+			out = append(out, [2]int{start, i})
+			start = -1
+		case !sep && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		out = append(out, [2]int{start, len(text)})
+	}
+	return out
+}
+
+// isHighEntropy reports whether tok looks like a random secret rather than a word,
+// path or hex digest.
+func isHighEntropy(tok string) bool {
+	if len(tok) < minTokenLen {
+		return false
+	}
+	var upper, lower, digit bool
+	counts := map[rune]int{}
+	for _, r := range tok {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+		counts[r]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	var bits float64
+	n := float64(len(tok))
+	for _, c := range counts {
+		p := float64(c) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits >= minEntropy
+}
+
+// merge sorts findings and folds overlapping ones into the first (outermost) match.
+func merge(found []Finding) []Finding {
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Start != found[j].Start {
+			return found[i].Start < found[j].Start
+		}
+		return found[i].End > found[j].End
+	})
+	var out []Finding
+	for _, f := range found {
+		if n := len(out); n > 0 && f.Start < out[n-1].End {
+			if f.End > out[n-1].End {
+				out[n-1].End = f.End
+			}
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"local-clipboard/internal/ratelimit"
+)
+
+// Keywords accepted in Config.Allow and Config.TrustedProxies besides
+// addresses and CIDRs.
+const (
+	AllowLAN      = "lan"      // Private networks of this host's interfaces, plus loopback
+	AllowPrivate  = "private"  // Every private, link-local and loopback range
+	AllowLoopback = "loopback" // This host only
+	AllowAny      = "any"      // Everyone
+)
+
+var (
+	loopbackNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	privateNetworks  = append([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+		netip.MustParsePrefix("169.254.0.0/16"),
+		netip.MustParsePrefix("fc00::/7"),
+		netip.MustParsePrefix("fe80::/10"),
+	}, loopbackNetworks...)
+	anyNetworks = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+)
+
+// deniedLogEvery bounds how often a denied client is written to the log, so a
+// scanner cannot flood it.
+const deniedLogEvery = time.Minute
+
+// ParseNetworks resolves -allow style entries: addresses, CIDRs and the
+// keywords above. "lan" looks at the interfaces of this host, or only at iface
+// when it is set.
+func ParseNetworks(entries []string, iface string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		switch strings.ToLower(e) {
+		case "":
+		case AllowLAN:
+			lan, err := LANNetworks(iface)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, lan...)
+		case AllowPrivate:
+			out = append(out, privateNetworks...)
+		case AllowLoopback:
+			out = append(out, loopbackNetworks...)
+		case AllowAny:
+			out = append(out, anyNetworks...)
+		default:
+			if p, err := netip.ParsePrefix(e); err == nil {
+				out = append(out, p.Masked())
+			} else if a, err := netip.ParseAddr(e); err == nil {
+				a = a.Unmap()
+				out = append(out, netip.PrefixFrom(a, a.BitLen()))
+			} else {
+				return nil, fmt.Errorf("invalid network %q: want an address, a CIDR or one of lan, private, loopback, any", e)
+			}
+		}
+	}
+	return out, nil
+}
+
+// networks resolves cfg.Allow, defaulting to lan, and cfg.TrustedProxies.
+func (cfg Config) networks() (allow, proxies []netip.Prefix, err error) {
+	allowed := cfg.Allow
+	if len(allowed) == 0 {
+		allowed = []string{AllowLAN}
+	}
+	if allow, err = ParseNetworks(allowed, cfg.BindInterface); err != nil {
+		return nil, nil, fmt.Errorf("allowed networks: %w", err)
+	}
+	if proxies, err = ParseNetworks(cfg.TrustedProxies, ""); err != nil {
+		return nil, nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	return allow, proxies, nil
+}
+
+// accessList decides which clients may use the server, and who they are when
+// requests come through a trusted reverse proxy. It is safe for concurrent
+// use; set replaces the networks on reload.
+type accessList struct {
+	mu      sync.RWMutex
+	allow   []netip.Prefix
+	proxies []netip.Prefix     // Peers whose X-Forwarded-For is believed
+	logged  *ratelimit.Limiter // Throttles "denied" log lines per client
+}
+
+func newAccessList(allow, proxies []netip.Prefix) *accessList {
+	return &accessList{allow: allow, proxies: proxies, logged: ratelimit.New(1/deniedLogEvery.Seconds(), 1)}
+}
+
+func (l *accessList) set(allow, proxies []netip.Prefix) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.allow, l.proxies = allow, proxies
+}
+
+func (l *accessList) networks() (allow, proxies []netip.Prefix) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.allow, l.proxies
+}
+
+func contains(networks []netip.Prefix, a netip.Addr) bool {
+	for _, p := range networks {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client behind r: the peer, or for a
+// trusted proxy the last X-Forwarded-For hop that is not itself a trusted
+// proxy. It fails for unparsable addresses.
+func clientAddr(r *http.Request, proxies []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	client, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	client = client.WithZone("").Unmap()
+	if !contains(proxies, client) {
+		return client, true
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && contains(proxies, client); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		a, err := netip.ParseAddr(hop)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		client = a.WithZone("").Unmap()
+	}
+	return client, true
+}
+
+type viaProxyKey struct{}
+
+// direct reports whether r came straight from the client: not through a trusted
+// proxy (see accessMiddleware), and without the headers reverse proxies add. A
+// proxy on this host makes every client it forwards look like loopback.
+func direct(r *http.Request) bool {
+	if via, _ := r.Context().Value(viaProxyKey{}).(bool); via {
+		return false
+	}
+	for _, h := range []string{"X-Forwarded-For", "Forwarded", "X-Real-Ip"} {
+		if r.Header.Get(h) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// accessMiddleware answers 403 to clients outside the allowed networks, and
+// otherwise passes r on with RemoteAddr set to the client's address, so that
+// logs, rate limits and the loopback trust see the client rather than a proxy.
+// Requests from a trusted proxy are marked so that direct reports false.
+func accessMiddleware(l *accessList, m *serverMetrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allow, proxies := l.networks()
+		client, ok := clientAddr(r, proxies)
+		if !ok || !contains(allow, client) {
+			m.deny()
+			who := r.RemoteAddr
+			if ok {
+				who = client.String()
+			}
+			if logOK, _ := l.logged.Allow(who, time.Now()); logOK {
+				log.Printf("denied %s %s from %s: not in the allowed networks (-allow)", r.Method, r.URL.Path, who)
+			}
+			respondError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if peer, _ := clientAddr(r, nil); contains(proxies, peer) {
+			r = r.WithContext(context.WithValue(r.Context(), viaProxyKey{}, true))
+		}
+		if host, _, _ := net.SplitHostPort(r.RemoteAddr); host != client.String() {
+			r = r.WithContext(r.Context())
+			r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseNetworks(t *testing.T) {
+	got, err := ParseNetworks([]string{"192.168.1.0/24", " 10.1.2.3 ", "loopback", "::ffff:10.9.9.9"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.168.1.0/24", "10.1.2.3/32", "127.0.0.0/8", "::1/128", "10.9.9.9/32"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, p := range got {
+		if p.String() != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if _, err := ParseNetworks([]string{"somewhere"}, ""); err == nil {
+		t.Fatal("invalid entry accepted")
+	}
+	lan, err := ParseNetworks([]string{AllowLAN}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(lan, netip.MustParseAddr("127.0.0.1")) {
+		t.Fatalf("lan %v does not include loopback", lan)
+	}
+}
+
+func TestAccessMiddleware(t *testing.T) {
+	allow, _ := ParseNetworks([]string{"192.168.1.0/24", "loopback"}, "")
+	proxies, _ := ParseNetworks([]string{"10.0.0.5"}, "")
+	var seen string
+	h := accessMiddleware(newAccessList(allow, proxies), nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.RemoteAddr
+	}))
+	send := func(remote, forwarded string) int {
+		seen = ""
+		req := httptest.NewRequest(http.MethodGet, "/api/clipboard", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send("192.168.1.20:4000", ""); code != http.StatusOK || seen != "192.168.1.20:4000" {
+		t.Fatalf("allowed client = %d, RemoteAddr %q", code, seen)
+	}
+	if code := send("[::1]:4000", ""); code != http.StatusOK {
+		t.Fatalf("loopback = %d", code)
+	}
+	if code := send("203.0.113.7:4000", ""); code != http.StatusForbidden || seen != "" {
+		t.Fatalf("outside client = %d", code)
+	}
+	// An untrusted peer cannot claim an allowed address.
+	if code := send("203.0.113.7:4000", "192.168.1.20"); code != http.StatusForbidden {
+		t.Fatalf("spoofed X-Forwarded-For = %d", code)
+	}
+	// Through the trusted proxy the client is the last untrusted hop.
+	if code := send("10.0.0.5:4000", "203.0.113.7, 192.168.1.30"); code != http.StatusOK || seen != "192.168.1.30:0" {
+		t.Fatalf("proxied client = %d, RemoteAddr %q", code, seen)
+	}
+	if code := send("10.0.0.5:4000", "192.168.1.30, 203.0.113.7"); code != http.StatusForbidden {
+		t.Fatalf("proxied outside client = %d", code)
+	}
+	if code := send("10.0.0.5:4000", "not-an-ip"); code != http.StatusForbidden {
+		t.Fatalf("garbage X-Forwarded-For = %d", code)
+	}
+	// The proxy itself is not in the allowed networks.
+	if code := send("10.0.0.5:4000", ""); code != http.StatusForbidden {
+		t.Fatalf("proxy without X-Forwarded-For = %d", code)
+	}
+}
+
+func TestListenRejectsHostWithInterface(t *testing.T) {
+	if _, err := listen("192.168.1.2:8080", "lo"); err == nil {
+		t.Fatal("host and interface both accepted")
+	}
+}
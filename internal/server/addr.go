@@ -1,7 +1,9 @@
 package server
 
 import (
+	"fmt"
 	"net"
+	"net/netip"
 	"strings"
 )
 
@@ -35,6 +37,80 @@ func LocalIPs() []string {
 	return out
 }
 
+// LANNetworks returns the private and link-local networks this host's
+// interfaces are on (only iface's when it is set), plus loopback. It is the
+// default of -allow.
+func LANNetworks(iface string) ([]netip.Prefix, error) {
+	var ifaces []net.Interface
+	if iface != "" {
+		i, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, err
+		}
+		ifaces = []net.Interface{*i}
+	} else {
+		var err error
+		if ifaces, err = net.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+	out := append([]netip.Prefix(nil), loopbackNetworks...)
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := i.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, _ := netip.AddrFromSlice(ipNet.IP)
+			ip = ip.Unmap()
+			if !ip.IsPrivate() && !ip.IsLinkLocalUnicast() {
+				continue
+			}
+			ones, _ := ipNet.Mask.Size()
+			if ip.Is4() && ones > 32 {
+				ones -= 96
+			}
+			if p := netip.PrefixFrom(ip, ones).Masked(); !contains(out, p.Addr()) {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+// InterfaceIPs returns the addresses to listen on for -bind-interface: every
+// address of the named interface except IPv6 link-local ones, which need a zone.
+func InterfaceIPs(name string) ([]net.IP, error) {
+	i, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if i.Flags&net.FlagUp == 0 {
+		return nil, fmt.Errorf("interface %s is down", name)
+	}
+	addrs, err := i.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var out []net.IP
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && !(ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast()) {
+			out = append(out, ipNet.IP)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("interface %s has no addresses", name)
+	}
+	return out, nil
+}
+
 // PortFromAddr extracts the port from a listen address like ":8080" or "0.0.0.0:8080".
 func PortFromAddr(addr string) string {
 	if addr == "" {
@@ -46,18 +122,28 @@ func PortFromAddr(addr string) string {
 	return addr
 }
 
-// ServerURLs returns http://<ip>:<port> for each local IP using the given port.
-func ServerURLs(port string) []string {
+// ServerURLs returns <scheme>://<ip>:<port> for each local IP using the given
+// port, or only for the IPv4 addresses of iface when it is set.
+func ServerURLs(scheme, port, iface string) []string {
 	if port == "" {
 		port = "8080"
 	}
 	ips := LocalIPs()
+	if iface != "" {
+		ifaceIPs, _ := InterfaceIPs(iface)
+		ips = nil
+		for _, ip := range ifaceIPs {
+			if ip.To4() != nil {
+				ips = append(ips, ip.String())
+			}
+		}
+	}
 	if len(ips) == 0 {
 		return []string{}
 	}
 	urls := make([]string, 0, len(ips))
 	for _, ip := range ips {
-		urls = append(urls, "http://"+net.JoinHostPort(ip, port))
+		urls = append(urls, scheme+"://"+net.JoinHostPort(ip, port))
 	}
 	return urls
 }
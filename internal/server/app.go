@@ -1,14 +1,45 @@
 package server
 
 import (
+	"net/http"
+	"sync"
+	"time"
+
+	"local-clipboard/internal/auth"
+	"local-clipboard/internal/channels"
 	"local-clipboard/internal/history"
+	"local-clipboard/internal/presence"
+	"local-clipboard/internal/requestlog"
+	"local-clipboard/internal/sensitive"
 	"local-clipboard/internal/store"
 )
 
-// App holds server dependencies (in-memory store, history, request logs, and server info).
+// App holds server dependencies (in-memory store, history, channels, event broker, paired devices, request logs, and server info).
 type App struct {
 	Store      *store.Store
 	History    history.History
-	Logs       *RequestLogs
-	ServerURLs []string // LAN URLs where this server is reachable (e.g. http://192.168.1.5:8080)
+	Channels   *channels.Store    // Registered channels and their tokens
+	Events     *store.Broker      // Publishes clipboard changes to /api/events subscribers; nil disables streaming
+	Devices    *auth.Store        // Paired devices; nil when auth is disabled
+	Pairing    *auth.Pairing      // One-time pairing codes; nil when auth is disabled
+	Presence   *presence.Registry // Clients seen by the server and whether they are online
+	Logs       *requestlog.Store
+	LogBodies  bool           // Keep clipboard text in logged bodies (and replayed responses)
+	Replay     http.Handler   // The API behind auth and logging, with request limits, which replayed requests go through; nil disables replay
+	Metrics    *serverMetrics // nil when -metrics is off
+	Limits     Limits         // Rate and body size limits enforced by limitMiddleware
+	ServerURLs []string       // LAN URLs where this server is reachable (e.g. http://192.168.1.5:8080)
+
+	TLSFingerprint string // SHA-256 fingerprint of the served certificate; empty without -tls
+	RequireE2E     bool   // Reject text entries that are not end-to-end encrypted
+	E2ESalt        string // Salt clients derive their end-to-end encryption key with, advertised by /api/server-info
+
+	Sensitive    sensitive.Action // What to do with text that looks like a secret; zero means off (the -sensitive flag defaults to expire)
+	SensitiveTTL time.Duration    // Lifetime of entries stored with ActionExpire
+
+	Retention history.Retention // Limits the janitor enforces on the history
+
+	// mu guards the settings a reload changes while requests are served:
+	// Limits, Sensitive, SensitiveTTL and Retention.
+	mu sync.RWMutex
 }
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/auth"
+)
+
+const (
+	tokenCookie    = "lc_token"
+	maxDeviceName  = 64
+	pairingCodeTTL = 10 * time.Minute
+)
+
+// authMiddleware requires a valid device token on every /api/* request except
+// pairing. The token is read from "Authorization: Bearer" or, for the web UI
+// (EventSource and <img> cannot set headers), from the lc_token cookie.
+// With trustLoopback, requests from 127.0.0.1/::1 are let through without a token
+// so the client in "run" mode works out of the box, but only when they come
+// straight from the client (see direct), not through a reverse proxy.
+func authMiddleware(devices *auth.Store, trustLoopback bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/pair" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if d, ok := devices.Lookup(requestToken(r)); ok {
+			next.ServeHTTP(w, r.WithContext(auth.WithDevice(r.Context(), d)))
+			return
+		}
+		if trustLoopback && isLoopback(r.RemoteAddr) && direct(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="local-clipboard"`)
+		respondError(w, "device not paired", http.StatusUnauthorized)
+	})
+}
+
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// handlePair exchanges a one-time pairing code for a long-lived device token.
+// The token is returned in the body (for CLI clients and scripts) and set as a
+// cookie (for the web UI).
+func (a *App) handlePair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Devices == nil || a.Pairing == nil {
+		respondError(w, "pairing is disabled", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondBodyError(w, err, "invalid JSON body")
+		return
+	}
+	name := strings.TrimSpace(sanitizeForDB(req.Name))
+	if name == "" {
+		respondError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(name) > maxDeviceName {
+		name = name[:maxDeviceName]
+	}
+	if wait := a.Pairing.LockedFor(); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondError(w, "too many wrong pairing codes; try again later", http.StatusTooManyRequests)
+		return
+	}
+	if !a.Pairing.Redeem(strings.TrimSpace(req.Code)) {
+		if wait := a.Pairing.LockedFor(); wait > 0 {
+			log.Printf("pairing locked for %s after repeated wrong codes", wait.Round(time.Second))
+		}
+		respondError(w, "invalid or expired pairing code", http.StatusForbidden)
+		return
+	}
+	device, token, err := a.Devices.Create(name)
+	if err != nil {
+		log.Printf("pair device failed: %v", err)
+		respondError(w, "failed to pair device", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("paired device %q (id %d)", device.Name, device.ID)
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   10 * 365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"token":  token,
+		"device": device,
+	})
+}
+
+// handlePairCode lets an already paired device show a fresh pairing code,
+// e.g. to pair a laptop from the phone's web UI.
+func (a *App) handlePairCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Pairing == nil {
+		respondError(w, "pairing is disabled", http.StatusNotFound)
+		return
+	}
+	code, expires := a.Pairing.Rotate()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"code":       code,
+		"expires_at": expires.UTC(),
+	})
+}
+
+func (a *App) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Devices == nil {
+		respondJSON(w, http.StatusOK, []interface{}{})
+		return
+	}
+	respondJSON(w, http.StatusOK, a.Devices.List())
+}
+
+func (a *App) handleRevokeDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Devices == nil {
+		respondError(w, "pairing is disabled", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondBodyError(w, err, "invalid JSON body")
+		return
+	}
+	if req.ID <= 0 {
+		respondError(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	if err := a.Devices.Revoke(req.ID); err != nil {
+		if errors.Is(err, auth.ErrNotFound) {
+			respondError(w, "device not found", http.StatusNotFound)
+			return
+		}
+		respondError(w, "failed to revoke device", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("revoked device id %d", req.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
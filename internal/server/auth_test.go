@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"local-clipboard/internal/auth"
+	"local-clipboard/internal/history"
+)
+
+func newAuthTestHandler(t *testing.T, trustLoopback bool) (*App, http.Handler) {
+	t.Helper()
+	a := newTestApp(t)
+	a.Devices = auth.NewStore(a.History.(*history.DBHistory).DB())
+	if err := a.Devices.Init(); err != nil {
+		t.Fatal(err)
+	}
+	a.Pairing = auth.NewPairing(time.Minute)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/clipboard", a.handleClipboard)
+	mux.HandleFunc("/api/pair", a.handlePair)
+	mux.HandleFunc("/api/auth/devices", a.handleDevices)
+	mux.HandleFunc("/api/auth/devices/revoke", a.handleRevokeDevice)
+	return a, authMiddleware(a.Devices, trustLoopback, mux)
+}
+
+func TestPairingFlow(t *testing.T) {
+	a, h := newAuthTestHandler(t, false)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/auth/devices", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/pair", strings.NewReader(`{"code":"nope","name":"phone"}`)))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for wrong code, got %d", rr.Code)
+	}
+
+	code, _ := a.Pairing.Code()
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/pair", strings.NewReader(fmt.Sprintf(`{"code":%q,"name":"phone"}`, code))))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var paired struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &paired); err != nil || paired.Token == "" {
+		t.Fatalf("missing token: %s", rr.Body.String())
+	}
+	if len(rr.Result().Cookies()) == 0 {
+		t.Fatal("expected token cookie")
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/pair", strings.NewReader(fmt.Sprintf(`{"code":%q,"name":"again"}`, code))))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected used code to be rejected, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/devices", nil)
+	req.Header.Set("Authorization", "Bearer "+paired.Token)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"phone"`) {
+		t.Fatalf("expected device list, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/devices/revoke", strings.NewReader(`{"id":1}`))
+	req.Header.Set("Authorization", "Bearer "+paired.Token)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 on revoke, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/devices", nil)
+	req.Header.Set("Authorization", "Bearer "+paired.Token)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked token to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestPairingLocksAfterWrongCodes(t *testing.T) {
+	a, h := newAuthTestHandler(t, false)
+	pair := func(code string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/pair", strings.NewReader(fmt.Sprintf(`{"code":%q,"name":"phone"}`, code))))
+		return rr
+	}
+	a.Pairing.Code()
+	for i := 0; i < 5; i++ {
+		if rr := pair("wrong"); rr.Code != http.StatusForbidden {
+			t.Fatalf("wrong code %d = %d", i, rr.Code)
+		}
+	}
+	code, _ := a.Pairing.Code()
+	rr := pair(code)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("even the right code must wait out the lockout, got %d", rr.Code)
+	}
+	if wait := a.Pairing.LockedFor(); wait <= 0 || wait > time.Minute {
+		t.Fatalf("first lockout = %s", wait)
+	}
+
+	// A paired device asking for a fresh code lifts the lockout.
+	code, _ = a.Pairing.Rotate()
+	if rr := pair(code); rr.Code != http.StatusCreated {
+		t.Fatalf("pair after rotate = %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAuthTrustLoopback(t *testing.T) {
+	_, h := newAuthTestHandler(t, true)
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/devices", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected loopback to be trusted, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code == http.StatusUnauthorized {
+		t.Fatal("non-API paths must not require a token")
+	}
+}
+
+func TestAuthTrustLoopbackOnlyForDirectConnections(t *testing.T) {
+	_, inner := newAuthTestHandler(t, true)
+	allow, _ := ParseNetworks([]string{"any"}, "")
+	proxies, _ := ParseNetworks([]string{"loopback"}, "")
+	for _, tc := range []struct {
+		name    string
+		proxies []netip.Prefix
+		header  string
+		want    int
+	}{
+		{"direct", nil, "", http.StatusOK},
+		{"untrusted local proxy", nil, "X-Forwarded-For", http.StatusUnauthorized},
+		{"untrusted local proxy with Forwarded", nil, "Forwarded", http.StatusUnauthorized},
+		{"trusted proxy without X-Forwarded-For", proxies, "", http.StatusUnauthorized},
+		{"trusted proxy forwarding loopback", proxies, "X-Forwarded-For", http.StatusUnauthorized},
+	} {
+		h := accessMiddleware(newAccessList(allow, tc.proxies), nil, inner)
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/devices", nil)
+		req.RemoteAddr = "127.0.0.1:50000"
+		if tc.header != "" {
+			req.Header.Set(tc.header, "127.0.0.1")
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rr.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif" // register decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/models"
+)
+
+const maxBlobSize = 20 << 20 // Default body limit of blob uploads (see DefaultLimits)
+
+// inlineBlobTypes are the raster image types served for display in the
+// browser. Anything else (SVG, HTML, PDF, ...) could run script in the
+// server's origin, so it is served as a download.
+var inlineBlobTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// handleBlob accepts binary clipboard uploads (POST) and serves stored payloads (GET).
+//
+// POST accepts either multipart/form-data with a "file" part (and optional "source"
+// and "tags" fields), or a raw body whose Content-Type is the payload's MIME type, with
+// the source and tags in the "source" and "tags" query parameters. GET serves the entry given by ?id=, or the latest entry.
+func (a *App) handleBlob(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		a.uploadBlob(w, r)
+	case http.MethodGet, http.MethodHead:
+		a.serveBlob(w, r)
+	default:
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) uploadBlob(w http.ResponseWriter, r *http.Request) {
+	if a.RequireE2E {
+		// Clients cannot encrypt binary entries, so none would be end-to-end encrypted.
+		respondError(w, "server requires end-to-end encrypted entries; binary entries cannot be encrypted", http.StatusBadRequest)
+		return
+	}
+	var (
+		data     []byte
+		mimeType string
+		source   = r.URL.Query().Get("source")
+		tags     = splitTags(r.URL.Query()["tags"])
+	)
+	ct := r.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxBlobSize); err != nil {
+			respondBodyError(w, err, "invalid multipart body")
+			return
+		}
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			respondError(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, err = io.ReadAll(f)
+		if err != nil {
+			respondError(w, "failed to read file", http.StatusBadRequest)
+			return
+		}
+		mimeType = hdr.Header.Get("Content-Type")
+		if v := r.FormValue("source"); v != "" {
+			source = v
+		}
+		if v := splitTags(r.MultipartForm.Value["tags"]); len(v) > 0 {
+			tags = v
+		}
+	} else {
+		var err error
+		data, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			respondBodyError(w, err, "failed to read body")
+			return
+		}
+		mimeType = ct
+	}
+	if len(data) == 0 {
+		respondError(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	mimeType = blobMimeType(mimeType, data)
+	if strings.HasPrefix(mimeType, "text/") {
+		respondError(w, "text must be sent to /api/clipboard", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(source) == "" {
+		source = "unknown"
+	}
+
+	tags, err := history.NormalizeTags(tags)
+	if err != nil {
+		respondError(w, "invalid tags", http.StatusBadRequest)
+		return
+	}
+
+	meta := models.ClipboardUpdate{Channel: channelFrom(r), Source: sanitizeForDB(source), MimeType: mimeType, Tags: tags}
+	if strings.HasPrefix(mimeType, "image/") {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			meta.Width, meta.Height = cfg.Width, cfg.Height
+		}
+	}
+	entry, err := a.History.InsertBlob(meta, data)
+	if err != nil {
+		log.Printf("clipboard blob insert failed: %v", err)
+		respondError(w, "failed to save clipboard", http.StatusInternalServerError)
+		return
+	}
+	a.Store.Set(entry)
+	a.Metrics.push(entry)
+	a.publish(models.EventNew, entry)
+	respondJSON(w, insertStatus(entry), entry)
+}
+
+func (a *App) serveBlob(w http.ResponseWriter, r *http.Request) {
+	var entry models.ClipboardUpdate
+	byID := false
+	if raw := strings.TrimSpace(r.URL.Query().Get("id")); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			respondError(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		if entry, err = a.entryInChannel(r, id); err != nil {
+			respondError(w, "entry not found", http.StatusNotFound)
+			return
+		}
+		byID = true
+	} else {
+		entry = a.Store.Get(channelFrom(r))
+	}
+	if !entry.IsBlob() {
+		respondError(w, "entry has no binary content", http.StatusNotFound)
+		return
+	}
+	data, err := a.History.Blob(entry.ID)
+	if err != nil {
+		respondError(w, "entry not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", entry.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if !inlineBlobTypes[entry.MimeType] {
+		w.Header().Set("Content-Disposition", `attachment; filename="clipboard-`+strconv.FormatInt(entry.ID, 10)+`"`)
+	}
+	if byID {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		a.Metrics.pull(r)
+		_, _ = w.Write(data)
+	}
+}
+
+// blobMimeType normalizes the declared MIME type, sniffing the content when it is
+// missing or generic.
+func blobMimeType(declared string, data []byte) string {
+	mt, _, err := mime.ParseMediaType(declared)
+	if err != nil || mt == "" || mt == "application/octet-stream" || mt == "application/x-www-form-urlencoded" {
+		mt, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	return mt
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"local-clipboard/internal/channels"
+	"local-clipboard/internal/models"
+)
+
+const (
+	channelHeader      = "X-Clipboard-Channel"
+	channelTokenHeader = "X-Channel-Token"
+	channelPathPrefix  = "/api/channels/"
+)
+
+type channelKey struct{}
+
+// channelFrom returns the channel selected by channelMiddleware for r.
+func channelFrom(r *http.Request) string {
+	if ch, ok := r.Context().Value(channelKey{}).(string); ok {
+		return ch
+	}
+	return models.DefaultChannel
+}
+
+// splitChannelPath maps "/api/channels/<name>/<rest>" to ("<name>", "/api/<rest>").
+// Other paths are returned unchanged with an empty channel.
+func splitChannelPath(path string) (channel, apiPath string) {
+	rest, ok := strings.CutPrefix(path, channelPathPrefix)
+	if !ok {
+		return "", path
+	}
+	name, sub, ok := strings.Cut(rest, "/")
+	if !ok || name == "" || sub == "" {
+		return "", path
+	}
+	return name, "/api/" + sub
+}
+
+// channelMiddleware selects the channel for every /api/* request, either from
+// the path ("/api/channels/work/clipboard" is served as "/api/clipboard" on
+// channel "work"; this is what EventSource and <img> use) or from the
+// X-Clipboard-Channel header, and checks the channel token of protected channels.
+func channelMiddleware(reg *channels.Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := strings.TrimSpace(r.Header.Get(channelHeader))
+		if ch, apiPath := splitChannelPath(r.URL.Path); ch != "" {
+			name = ch
+			u := *r.URL
+			u.Path, u.RawPath = apiPath, ""
+			r = r.Clone(r.Context())
+			r.URL = &u
+		}
+		if name == "" {
+			name = models.DefaultChannel
+		}
+		if !channels.ValidName(name) {
+			respondError(w, channels.ErrInvalidName.Error(), http.StatusBadRequest)
+			return
+		}
+		if !reg.Authorize(name, r.Header.Get(channelTokenHeader)) {
+			respondError(w, "channel token required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), channelKey{}, name)))
+	})
+}
+
+// handleChannels lists channels (registered ones and any with history) on GET
+// and registers a channel, optionally protected by a token, on POST.
+func (a *App) handleChannels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		byName := map[string]models.Channel{models.DefaultChannel: {Name: models.DefaultChannel}}
+		if names, err := a.History.Channels(); err == nil {
+			for _, n := range names {
+				byName[n] = models.Channel{Name: n}
+			}
+		}
+		for _, c := range a.Channels.List() {
+			byName[c.Name] = c
+		}
+		out := make([]models.Channel, 0, len(byName))
+		for _, c := range byName {
+			out = append(out, c)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+		respondJSON(w, http.StatusOK, out)
+	case http.MethodPost:
+		var req struct {
+			Name  string `json:"name"`
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondBodyError(w, err, "invalid JSON body")
+			return
+		}
+		c, err := a.Channels.Create(strings.TrimSpace(req.Name), req.Token)
+		switch {
+		case errors.Is(err, channels.ErrInvalidName):
+			respondError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, channels.ErrExists):
+			respondError(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			log.Printf("create channel failed: %v", err)
+			respondError(w, "failed to create channel", http.StatusInternalServerError)
+		default:
+			respondJSON(w, http.StatusCreated, c)
+		}
+	default:
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"local-clipboard/internal/models"
+)
+
+func TestChannelsAreIsolated(t *testing.T) {
+	a := newTestApp(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/clipboard", a.handleClipboard)
+	mux.HandleFunc("/api/history", a.handleHistory)
+	mux.HandleFunc("/api/channels", a.handleChannels)
+	h := channelMiddleware(a.Channels, mux)
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodPost, "/api/channels", `{"name":"work","token":"s3cret"}`, nil); rr.Code != http.StatusCreated {
+		t.Fatalf("create channel: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/api/channels", `{"name":"work"}`, nil); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate channel: expected 409 got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/api/channels", `{"name":"Bad Name"}`, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid name: expected 400 got %d", rr.Code)
+	}
+
+	do(http.MethodPost, "/api/clipboard", `{"text":"home","source":"a"}`, nil)
+	if rr := do(http.MethodPost, "/api/channels/work/clipboard", `{"text":"work","source":"a"}`, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("protected channel without token: expected 403 got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/api/channels/work/clipboard", `{"text":"work","source":"a"}`, map[string]string{channelTokenHeader: "s3cret"}); rr.Code != http.StatusCreated {
+		t.Fatalf("post to channel: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr := do(http.MethodGet, "/api/clipboard", "", map[string]string{channelHeader: "work", channelTokenHeader: "s3cret"})
+	var latest models.ClipboardUpdate
+	if err := json.Unmarshal(rr.Body.Bytes(), &latest); err != nil || latest.Text != "work" || latest.Channel != "work" {
+		t.Fatalf("work latest: %s", rr.Body.String())
+	}
+	rr = do(http.MethodGet, "/api/history?format=array", "", nil)
+	var items []models.ClipboardUpdate
+	if err := json.Unmarshal(rr.Body.Bytes(), &items); err != nil || len(items) != 1 || items[0].Text != "home" {
+		t.Fatalf("default history leaked other channels: %s", rr.Body.String())
+	}
+
+	rr = do(http.MethodGet, "/api/channels", "", nil)
+	var list []models.Channel
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 2 || list[0].Name != "default" || list[1].Name != "work" || !list[1].Protected {
+		t.Fatalf("unexpected channel list: %s", rr.Body.String())
+	}
+}
+
+func TestCreateChannelWithHistoryIsRefused(t *testing.T) {
+	a := newTestApp(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/clipboard", a.handleClipboard)
+	mux.HandleFunc("/api/channels", a.handleChannels)
+	h := channelMiddleware(a.Channels, mux)
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodPost, "/api/channels/team/clipboard", `{"text":"shared","source":"a"}`, nil); rr.Code != http.StatusCreated {
+		t.Fatalf("post to unregistered channel: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/api/channels", `{"name":"team","token":"mine"}`, nil); rr.Code != http.StatusConflict {
+		t.Fatalf("take over channel with history: expected 409 got %d", rr.Code)
+	}
+	if _, ok := a.Channels.Get("team"); ok {
+		t.Fatal("channel with history was registered")
+	}
+	if rr := do(http.MethodGet, "/api/clipboard", "", map[string]string{channelHeader: "team"}); rr.Code != http.StatusOK {
+		t.Fatalf("channel locked after refused create: %d", rr.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+const eventsHeartbeat = 25 * time.Second
+
+// publish sends a clipboard event to stream subscribers, if a broker is configured.
+func (a *App) publish(typ string, entry models.ClipboardUpdate) {
+	if a.Events != nil {
+		a.Events.Publish(typ, withoutBurnContent(entry))
+	}
+}
+
+// withoutBurnContent blanks the text of a burn-after-read entry: it may only
+// leave the server through GET /api/clipboard, where reads are counted.
+func withoutBurnContent(e models.ClipboardUpdate) models.ClipboardUpdate {
+	if e.MaxReads > 0 {
+		e.Text, e.Nonce = "", ""
+	}
+	return e
+}
+
+// handleEvents streams clipboard changes of the request's channel as Server-Sent Events.
+// Clients that reconnect with Last-Event-ID receive the events they missed;
+// fresh connections, and those whose id cannot be resumed, get the current
+// latest entry as an initial "new" event.
+func (a *App) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Events == nil {
+		respondError(w, "events not available", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	channel := channelFrom(r)
+	lastID, _ := strconv.ParseInt(strings.TrimSpace(r.Header.Get("Last-Event-ID")), 10, 64)
+	if !a.Events.Resumes(lastID) {
+		// A fresh connection, or an id from before a restart or too old to
+		// resume from: start over with the current entry.
+		lastID = 0
+	}
+	events, missed, cancel := a.Events.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	if lastID <= 0 {
+		if latest := a.Store.Get(channel); !latest.IsEmpty() {
+			missed = append(missed, models.Event{ID: a.Events.LastID(), Type: models.EventNew, Entry: withoutBurnContent(latest)})
+		}
+	}
+	for _, ev := range missed {
+		if ev.Entry.ChannelName() != channel {
+			continue
+		}
+		if err := writeEvent(w, ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				// Dropped as a slow subscriber; the client reconnects with Last-Event-ID.
+				return
+			}
+			if ev.Entry.ChannelName() != channel {
+				continue
+			}
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+			flusher.Flush()
+			if ev.Type == models.EventNew {
+				a.Metrics.pull(r)
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev models.Event) error {
+	data, err := json.Marshal(ev.Entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
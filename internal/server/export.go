@@ -0,0 +1,102 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/export"
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/models"
+	"local-clipboard/internal/requestlog"
+	"local-clipboard/internal/version"
+)
+
+// maxHAREntries caps a request log export; the newest matching requests are kept.
+const maxHAREntries = 5000
+
+// handleExport streams the channel's history as a download in the format given
+// by ?format= (jsonl, csv or markdown). Sensitive entries are left out unless
+// ?include_sensitive=true.
+func (a *App) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		respondError(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+	q := history.ExportQuery{Channel: channelFrom(r), WithData: format.Lossless()}
+	if raw := strings.TrimSpace(r.URL.Query().Get("include_sensitive")); raw != "" {
+		if q.IncludeSensitive, err = strconv.ParseBool(raw); err != nil {
+			respondError(w, "invalid include_sensitive", http.StatusBadRequest)
+			return
+		}
+	}
+	name := "clipboard-" + q.Channel + "-" + time.Now().Format("2006-01-02") + format.Ext()
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	ew := export.NewWriter(w, format)
+	err = a.History.Export(q, func(e models.ClipboardUpdate, data []byte) error {
+		return ew.Write(e, data)
+	})
+	if err == nil {
+		err = ew.Close()
+	}
+	if err != nil {
+		// The status is already sent; the client sees a truncated file.
+		log.Printf("export failed: %v", err)
+	}
+}
+
+// handleLogsExport downloads the request log as a HAR 1.2 file (?format=har,
+// the only format), oldest request first. It takes the filters of /api/logs.
+func (a *App) handleLogsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if f := r.URL.Query().Get("format"); f != "" && f != "har" {
+		respondError(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+	q, err := logsQuery(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Limit, q.Cursor = 500, ""
+	var entries []requestlog.Entry
+	for a.Logs != nil && len(entries) < maxHAREntries {
+		page, err := a.Logs.List(q)
+		if err != nil {
+			respondError(w, "failed to read request logs", http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, page.Items...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if len(entries) > maxHAREntries {
+		entries = entries[:maxHAREntries]
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	name := "local-clipboard-requests-" + time.Now().Format("2006-01-02") + ".har"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if err := requestlog.WriteHAR(w, entries, scheme+"://"+r.Host, version.Version); err != nil {
+		log.Printf("request log export failed: %v", err)
+	}
+}
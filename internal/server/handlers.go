@@ -2,13 +2,24 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/models"
+	"local-clipboard/internal/requestlog"
+	"local-clipboard/internal/sensitive"
 )
 
+var errEntryNotInChannel = errors.New("entry belongs to another channel")
+
 func respondJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -38,80 +49,347 @@ func (a *App) handleIndex(w http.ResponseWriter, r *http.Request) {
 func (a *App) handleClipboard(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		var text, source string
+		var text, source, nonce, keyID string
+		var flagged bool // The client found a secret (it may have encrypted the text)
+		var expiresIn, maxReads any
+		var tags []string
 		ct := r.Header.Get("Content-Type")
 		if strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
 			if err := r.ParseForm(); err != nil {
-				respondError(w, "invalid form body", http.StatusBadRequest)
+				respondBodyError(w, err, "invalid form body")
 				return
 			}
 			text = r.FormValue("text")
 			source = r.FormValue("source")
+			nonce = r.FormValue("nonce")
+			keyID = r.FormValue("key_id")
+			flagged, _ = strconv.ParseBool(r.FormValue("sensitive"))
+			expiresIn, maxReads = r.FormValue("expires_in"), r.FormValue("max_reads")
+			tags = splitTags(r.Form["tags"])
 		} else {
 			var req struct {
-				Text   string `json:"text"`
-				Source string `json:"source"`
+				Text      string   `json:"text"`
+				Source    string   `json:"source"`
+				Nonce     string   `json:"nonce"`
+				KeyID     string   `json:"key_id"`
+				Sensitive bool     `json:"sensitive"`
+				ExpiresIn any      `json:"expires_in"` // Duration ("10m") or seconds
+				MaxReads  any      `json:"max_reads"`
+				Tags      []string `json:"tags"`
 			}
-			body, _ := io.ReadAll(r.Body)
+			body, err := io.ReadAll(r.Body)
 			r.Body.Close()
+			if err != nil {
+				respondBodyError(w, err, "failed to read body")
+				return
+			}
 			if err := json.Unmarshal(body, &req); err != nil {
 				respondError(w, "invalid JSON body", http.StatusBadRequest)
 				return
 			}
 			text = req.Text
 			source = req.Source
+			nonce = req.Nonce
+			keyID = req.KeyID
+			flagged = req.Sensitive
+			expiresIn, maxReads = req.ExpiresIn, req.MaxReads
+			tags = req.Tags
 		}
 		text = strings.TrimSpace(text)
 		if text == "" {
 			respondError(w, "text is required", http.StatusBadRequest)
 			return
 		}
+		encrypted := nonce != "" || keyID != ""
+		if encrypted && (nonce == "" || keyID == "") {
+			respondError(w, "encrypted entries need both nonce and key_id", http.StatusBadRequest)
+			return
+		}
+		if a.RequireE2E && !encrypted {
+			respondError(w, "server requires end-to-end encrypted entries", http.StatusBadRequest)
+			return
+		}
 		if strings.TrimSpace(source) == "" {
 			source = "unknown"
 		}
-		text = sanitizeForDB(text)
-		source = sanitizeForDB(source)
-		entry, err := a.History.Insert(text, source)
+		ttl, reads, err := lifetimeParams(expiresIn, maxReads)
+		if err != nil {
+			respondError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if tags, err = history.NormalizeTags(tags); err != nil {
+			respondError(w, "invalid tags", http.StatusBadRequest)
+			return
+		}
+		action, sensitiveTTL := a.sensitivity()
+		verdict := sensitive.Verdict{Text: text}
+		if !encrypted {
+			verdict = action.Apply(text)
+		}
+		if verdict.Refuse || (flagged && action == sensitive.ActionRefuse) {
+			respondError(w, "refusing to store what looks like a secret ("+strings.Join(sensitive.Names(verdict.Findings), ", ")+")", http.StatusUnprocessableEntity)
+			return
+		}
+		update := models.ClipboardUpdate{
+			Channel:   channelFrom(r),
+			Text:      sanitizeForDB(verdict.Text),
+			Source:    sanitizeForDB(source),
+			Encrypted: encrypted,
+			Nonce:     nonce,
+			KeyID:     keyID,
+			Sensitive: verdict.Sensitive || flagged,
+			MaxReads:  reads,
+			Tags:      tags,
+		}
+		if update.Sensitive && (ttl == 0 || sensitiveTTL < ttl) {
+			ttl = sensitiveTTL
+		}
+		if ttl > 0 {
+			expires := time.Now().Add(ttl).UTC()
+			update.ExpiresAt = &expires
+		}
+		entry, err := a.History.Insert(update)
 		if err != nil {
 			log.Printf("clipboard insert failed: %v", err)
 			respondError(w, "failed to save clipboard", http.StatusInternalServerError)
 			return
 		}
 		a.Store.Set(entry)
-		respondJSON(w, http.StatusCreated, entry)
+		a.Metrics.push(entry)
+		a.publish(models.EventNew, entry)
+		respondJSON(w, insertStatus(entry), entry)
 	case http.MethodGet:
-		latest := a.Store.Get()
-		if strings.TrimSpace(latest.Text) == "" {
+		latest := a.readLatest(channelFrom(r))
+		if latest.IsEmpty() {
 			respondError(w, "clipboard is empty", http.StatusNotFound)
 			return
 		}
+		a.Metrics.pull(r)
 		respondJSON(w, http.StatusOK, latest)
 	default:
 		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// handleHistory lists history as {items, next_cursor, total}. Pass next_cursor
+// back as ?cursor= for the next page. ?format=array returns the bare item array
+// of older versions (a single page).
 func (a *App) handleHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	limit := 50
-	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+	q, err := historyQuery(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := a.History.List(q)
+	if errors.Is(err, history.ErrInvalidCursor) {
+		respondError(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		respondError(w, "failed to read history", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "array" {
+		respondJSON(w, http.StatusOK, page.Items)
+		return
+	}
+	respondJSON(w, http.StatusOK, page)
+}
+
+// Limits for the expires_in and max_reads options of POST /api/clipboard.
+const (
+	maxExpiresIn = 7 * 24 * time.Hour
+	maxMaxReads  = 100
+)
+
+// lifetimeParams parses the expires_in (a duration like "10m", or seconds) and
+// max_reads options of POST /api/clipboard. Numbers and numeric strings mean
+// the same; missing or zero values mean no limit.
+func lifetimeParams(expiresIn, maxReads any) (time.Duration, int, error) {
+	var secs float64
+	switch v := expiresIn.(type) {
+	case nil:
+	case float64:
+		secs = v
+	case string:
+		if v = strings.TrimSpace(v); v == "" {
+			break
+		}
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			secs = n
+		} else if d, err := time.ParseDuration(v); err == nil {
+			secs = d.Seconds()
+		} else {
+			return 0, 0, errors.New("invalid expires_in")
+		}
+	default:
+		return 0, 0, errors.New("invalid expires_in")
+	}
+	// Written so that NaN fails too.
+	if !(secs >= 0 && secs <= maxExpiresIn.Seconds()) {
+		return 0, 0, fmt.Errorf("expires_in must be between 0 (no expiry) and %s", maxExpiresIn)
+	}
+	ttl := time.Duration(secs * float64(time.Second))
+	var reads float64
+	switch v := maxReads.(type) {
+	case nil:
+	case float64:
+		reads = v
+	case string:
+		if v = strings.TrimSpace(v); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0, 0, errors.New("invalid max_reads")
+			}
+			reads = n
+		}
+	default:
+		return 0, 0, errors.New("invalid max_reads")
+	}
+	if reads != math.Trunc(reads) {
+		return 0, 0, errors.New("invalid max_reads")
+	}
+	if !(reads >= 0 && reads <= maxMaxReads) {
+		return 0, 0, fmt.Errorf("max_reads must be between 0 and %d", maxMaxReads)
+	}
+	return ttl, int(reads), nil
+}
+
+// readLatest returns the latest entry of channel for GET /api/clipboard. Reading
+// a burn-after-read entry counts against its max_reads; once it is used up (or
+// expired) the channel falls back to the previous live entry.
+func (a *App) readLatest(channel string) models.ClipboardUpdate {
+	for i := 0; i < 3; i++ {
+		latest := a.Store.Get(channel)
+		if latest.MaxReads == 0 {
+			return latest
+		}
+		e, err := a.History.Consume(latest.ID)
+		if err != nil {
+			a.Store.Remove(latest.ID)
+			continue
+		}
+		if e.Expired(time.Now()) {
+			// That was the last read; the sweeper deletes the row.
+			a.Store.Remove(e.ID)
+		}
+		return e
+	}
+	return models.ClipboardUpdate{}
+}
+
+// sensitivity returns what to do with text that looks like a secret, and how
+// long entries flagged as sensitive are kept.
+func (a *App) sensitivity() (sensitive.Action, time.Duration) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.SensitiveTTL > 0 {
+		return a.Sensitive, a.SensitiveTTL
+	}
+	return a.Sensitive, defaultSensitiveTTL
+}
+
+// insertStatus is 201 for a new entry and 200 when the content was already in
+// history and the existing entry was returned.
+func insertStatus(e models.ClipboardUpdate) int {
+	if e.CopyCount > 1 {
+		return http.StatusOK
+	}
+	return http.StatusCreated
+}
+
+// historyQuery parses /api/history parameters: limit, q, sort, cursor, before_id,
+// source, pinned, since, until (RFC 3339 or YYYY-MM-DD), min_size, max_size and
+// include_sensitive.
+func historyQuery(r *http.Request) (history.Query, error) {
+	v := r.URL.Query()
+	q := history.Query{
+		Channel: channelFrom(r),
+		Limit:   50,
+		Search:  strings.TrimSpace(v.Get("q")),
+		Cursor:  v.Get("cursor"),
+		Source:  v.Get("source"),
+	}
+	if raw := strings.TrimSpace(v.Get("tag")); raw != "" {
+		tag, err := history.NormalizeTag(raw)
+		if err != nil {
+			return q, errors.New("invalid tag")
+		}
+		q.Tag = tag
+	}
+	switch sort := v.Get("sort"); sort {
+	case "", "recent":
+	case history.SortFrequent:
+		q.Sort = sort
+	default:
+		return q, errors.New("invalid sort")
+	}
+	if raw := strings.TrimSpace(v.Get("limit")); raw != "" {
 		parsed, err := strconv.Atoi(raw)
 		if err != nil || parsed < 1 || parsed > 200 {
-			respondError(w, "invalid limit", http.StatusBadRequest)
-			return
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = parsed
+	}
+	ints := []struct {
+		name string
+		dst  *int64
+	}{{"before_id", &q.BeforeID}, {"min_size", &q.MinSize}, {"max_size", &q.MaxSize}}
+	for _, p := range ints {
+		if raw := strings.TrimSpace(v.Get(p.name)); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	if raw := strings.TrimSpace(v.Get("include_sensitive")); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			return q, errors.New("invalid include_sensitive")
+		}
+		q.IncludeSensitive = include
+	}
+	if raw := strings.TrimSpace(v.Get("pinned")); raw != "" {
+		pinned, err := strconv.ParseBool(raw)
+		if err != nil {
+			return q, errors.New("invalid pinned")
 		}
-		limit = parsed
+		q.Pinned = &pinned
+	}
+	var err error
+	if q.Since, err = parseTimeParam(v.Get("since"), false); err != nil {
+		return q, errors.New("invalid since")
+	}
+	if q.Until, err = parseTimeParam(v.Get("until"), true); err != nil {
+		return q, errors.New("invalid until")
+	}
+	return q, nil
+}
+
+// parseTimeParam accepts RFC 3339 or a plain date. A date used as an upper
+// bound (endOfDay) includes that whole day.
+func parseTimeParam(raw string, endOfDay bool) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
 	}
-	query := strings.TrimSpace(r.URL.Query().Get("q"))
-	items, err := a.History.List(limit, query)
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
 	if err != nil {
-		respondError(w, "failed to read history", http.StatusInternalServerError)
-		return
+		return time.Time{}, err
 	}
-	respondJSON(w, http.StatusOK, items)
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
 }
 
 func (a *App) handlePin(w http.ResponseWriter, r *http.Request) {
@@ -124,13 +402,17 @@ func (a *App) handlePin(w http.ResponseWriter, r *http.Request) {
 		Pinned bool  `json:"pinned"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, "invalid JSON body", http.StatusBadRequest)
+		respondBodyError(w, err, "invalid JSON body")
 		return
 	}
 	if req.ID <= 0 {
 		respondError(w, "id is required", http.StatusBadRequest)
 		return
 	}
+	if _, err := a.entryInChannel(r, req.ID); err != nil {
+		respondError(w, "entry not found", http.StatusNotFound)
+		return
+	}
 	if err := a.History.SetPinned(req.ID, req.Pinned); err != nil {
 		respondError(w, "failed to update pin", http.StatusInternalServerError)
 		return
@@ -140,9 +422,77 @@ func (a *App) handlePin(w http.ResponseWriter, r *http.Request) {
 		respondError(w, "entry not found", http.StatusNotFound)
 		return
 	}
+	a.publish(models.EventPinned, entry)
 	respondJSON(w, http.StatusOK, entry)
 }
 
+// handleTags lists the channel's tags with their entry counts on GET and
+// changes the tags of an entry on POST ({"id": 4, "add": [...], "remove": [...]}).
+func (a *App) handleTags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := a.History.Tags(channelFrom(r))
+		if err != nil {
+			respondError(w, "failed to read tags", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, http.StatusOK, tags)
+	case http.MethodPost:
+		a.updateTags(w, r)
+	default:
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) updateTags(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     int64    `json:"id"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondBodyError(w, err, "invalid JSON body")
+		return
+	}
+	if req.ID <= 0 {
+		respondError(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := a.entryInChannel(r, req.ID); err != nil {
+		respondError(w, "entry not found", http.StatusNotFound)
+		return
+	}
+	err := a.History.UpdateTags(req.ID, req.Add, req.Remove)
+	if errors.Is(err, history.ErrInvalidTag) {
+		respondError(w, "invalid tags", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		respondError(w, "failed to update tags", http.StatusInternalServerError)
+		return
+	}
+	entry, err := a.History.ByID(req.ID)
+	if err != nil {
+		respondError(w, "entry not found", http.StatusNotFound)
+		return
+	}
+	a.publish(models.EventTagged, entry)
+	respondJSON(w, http.StatusOK, entry)
+}
+
+// splitTags accepts tags as repeated form values, comma-separated, or both.
+func splitTags(values []string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	return tags
+}
+
 func (a *App) handleDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
 		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -152,30 +502,121 @@ func (a *App) handleDelete(w http.ResponseWriter, r *http.Request) {
 		ID int64 `json:"id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, "invalid JSON body", http.StatusBadRequest)
+		respondBodyError(w, err, "invalid JSON body")
 		return
 	}
 	if req.ID <= 0 {
 		respondError(w, "id is required", http.StatusBadRequest)
 		return
 	}
+	entry, err := a.entryInChannel(r, req.ID)
+	if err != nil {
+		respondError(w, "entry not found", http.StatusNotFound)
+		return
+	}
 	if err := a.History.Delete(req.ID); err != nil {
 		respondError(w, "failed to delete", http.StatusInternalServerError)
 		return
 	}
+	a.Store.Remove(req.ID)
+	a.publish(models.EventDeleted, models.ClipboardUpdate{ID: req.ID, Channel: entry.Channel})
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// entryInChannel returns the entry with id if it belongs to the request's channel,
+// so ids from one channel cannot be used to read or modify another.
+func (a *App) entryInChannel(r *http.Request, id int64) (models.ClipboardUpdate, error) {
+	entry, err := a.History.ByID(id)
+	if err != nil {
+		return models.ClipboardUpdate{}, err
+	}
+	if entry.ChannelName() != channelFrom(r) {
+		return models.ClipboardUpdate{}, errEntryNotInChannel
+	}
+	return entry, nil
+}
+
 func (a *App) handleLogs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 	if a.Logs == nil {
-		respondJSON(w, http.StatusOK, []interface{}{})
+		respondJSON(w, http.StatusOK, requestlog.Page{Items: []requestlog.Entry{}})
+		return
+	}
+	q, err := logsQuery(r)
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := a.Logs.List(q)
+	if errors.Is(err, requestlog.ErrInvalidCursor) {
+		respondError(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		respondError(w, "failed to read request logs", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "array" {
+		respondJSON(w, http.StatusOK, page.Items)
 		return
 	}
-	respondJSON(w, http.StatusOK, a.Logs.List())
+	respondJSON(w, http.StatusOK, page)
+}
+
+// logsQuery parses /api/logs parameters: limit, cursor, method, path (a prefix),
+// status (e.g. 404 or 4xx), status_min, status_max, remote, since, until
+// (RFC 3339 or YYYY-MM-DD) and q (searched in the path and bodies).
+func logsQuery(r *http.Request) (requestlog.Query, error) {
+	v := r.URL.Query()
+	q := requestlog.Query{
+		Limit:      100,
+		Cursor:     v.Get("cursor"),
+		Method:     strings.ToUpper(strings.TrimSpace(v.Get("method"))),
+		PathPrefix: strings.TrimSpace(v.Get("path")),
+		RemoteAddr: strings.TrimSpace(v.Get("remote")),
+		Search:     strings.TrimSpace(v.Get("q")),
+	}
+	if raw := strings.TrimSpace(v.Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 500 {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = parsed
+	}
+	if raw := strings.ToLower(strings.TrimSpace(v.Get("status"))); raw != "" {
+		if class, ok := strings.CutSuffix(raw, "xx"); ok && len(class) == 1 && class[0] >= '1' && class[0] <= '5' {
+			q.StatusMin = int(class[0]-'0') * 100
+			q.StatusMax = q.StatusMin + 99
+		} else if code, err := strconv.Atoi(raw); err == nil && code >= 100 && code <= 599 {
+			q.StatusMin, q.StatusMax = code, code
+		} else {
+			return q, errors.New("invalid status")
+		}
+	}
+	ints := []struct {
+		name string
+		dst  *int
+	}{{"status_min", &q.StatusMin}, {"status_max", &q.StatusMax}}
+	for _, p := range ints {
+		if raw := strings.TrimSpace(v.Get(p.name)); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 100 || n > 599 {
+				return q, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	var err error
+	if q.Since, err = parseTimeParam(v.Get("since"), false); err != nil {
+		return q, errors.New("invalid since")
+	}
+	if q.Until, err = parseTimeParam(v.Get("until"), true); err != nil {
+		return q, errors.New("invalid until")
+	}
+	return q, nil
 }
 
 func (a *App) handleServerInfo(w http.ResponseWriter, r *http.Request) {
@@ -187,7 +628,15 @@ func (a *App) handleServerInfo(w http.ResponseWriter, r *http.Request) {
 	if urls == nil {
 		urls = []string{}
 	}
+	a.mu.RLock()
+	limits := a.Limits
+	a.mu.RUnlock()
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"urls": urls,
+		"urls":        urls,
+		"tls":         a.TLSFingerprint != "",
+		"fingerprint": a.TLSFingerprint,
+		"require_e2e": a.RequireE2E,
+		"e2e_salt":    a.E2ESalt,
+		"limits":      limits,
 	})
 }
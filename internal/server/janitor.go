@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"local-clipboard/internal/models"
+	"local-clipboard/internal/requestlog"
+)
+
+const (
+	defaultPruneInterval = time.Hour
+	defaultSensitiveTTL  = 10 * time.Minute
+	sweepInterval        = 15 * time.Second
+	logPruneInterval     = 10 * time.Minute
+)
+
+// runJanitor enforces the retention policy once now and then every interval
+// until ctx is done. It asks for the policy each time, so a reload can change
+// it. Removed entries are dropped like expired ones (see sweepExpired).
+func (a *App) runJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPruneInterval
+	}
+	prune := func() {
+		r := a.retention()
+		if !r.Enabled() {
+			return
+		}
+		res, err := a.History.Prune(r, false)
+		if err != nil {
+			log.Printf("retention: prune failed: %v", err)
+			return
+		}
+		if res.Entries() > 0 {
+			log.Printf("retention: removed %s", res)
+		}
+		a.dropRemoved(res.Removed)
+	}
+	prune()
+	every(ctx, interval, prune)
+}
+
+// runSweeper deletes expired and used-up entries every sweepInterval until ctx is done.
+func (a *App) runSweeper(ctx context.Context) {
+	a.sweepExpired()
+	every(ctx, sweepInterval, a.sweepExpired)
+}
+
+// runLogJanitor removes request logs past their retention every
+// logPruneInterval until ctx is done.
+func runLogJanitor(ctx context.Context, logs *requestlog.Store) {
+	prune := func() {
+		if _, err := logs.Prune(time.Now()); err != nil {
+			log.Printf("request log: prune failed: %v", err)
+		}
+	}
+	prune()
+	every(ctx, logPruneInterval, prune)
+}
+
+// every calls fn each interval until ctx is done.
+func every(ctx context.Context, interval time.Duration, fn func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fn()
+		}
+	}
+}
+
+// sweepExpired deletes entries that expired or used up their reads, tells
+// subscribers they are gone and drops them from the latest clipboard.
+func (a *App) sweepExpired() {
+	removed, err := a.History.DeleteExpired()
+	if err != nil {
+		log.Printf("expiry: sweep failed: %v", err)
+		return
+	}
+	a.dropRemoved(removed)
+}
+
+// dropRemoved tells subscribers that entries deleted behind their back are
+// gone and drops them from the latest clipboard.
+func (a *App) dropRemoved(removed []models.ClipboardUpdate) {
+	for _, e := range removed {
+		a.Store.Remove(e.ID)
+		a.publish(models.EventDeleted, models.ClipboardUpdate{ID: e.ID, Channel: e.Channel})
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"local-clipboard/internal/auth"
+	"local-clipboard/internal/ratelimit"
+)
+
+// Limits are the request limits of the API, reported by /api/server-info so
+// clients can pace themselves. Zero rates and sizes mean no limit.
+type Limits struct {
+	ReadRate   float64 `json:"read_rate"`   // GET and HEAD requests per second per client
+	ReadBurst  int     `json:"read_burst"`  // Reads allowed at once before ReadRate applies
+	WriteRate  float64 `json:"write_rate"`  // Other requests per second per client
+	WriteBurst int     `json:"write_burst"` // Writes allowed at once before WriteRate applies
+
+	MaxBody       int64            `json:"max_body"`         // Request body limit in bytes for routes not in MaxBodyByPath
+	MaxBodyByPath map[string]int64 `json:"max_body_by_path"` // Request body limits by API path, e.g. "/api/clipboard"
+}
+
+// DefaultLimits are generous enough for the web UI loading a page of images
+// and for clients pushing every copy, while stopping a script from flooding
+// the history.
+func DefaultLimits() Limits {
+	return Limits{
+		ReadRate:   20,
+		ReadBurst:  200,
+		WriteRate:  2,
+		WriteBurst: 20,
+		MaxBody:    64 << 10,
+		MaxBodyByPath: map[string]int64{
+			"/api/clipboard":      1 << 20,
+			"/api/clipboard/blob": maxBlobSize,
+		},
+	}
+}
+
+// maxBodyFor returns the body limit of apiPath; 0 means none.
+func (l Limits) maxBodyFor(apiPath string) int64 {
+	if n, ok := l.MaxBodyByPath[apiPath]; ok {
+		return n
+	}
+	return l.MaxBody
+}
+
+// requestLimits holds the Limits limitMiddleware enforces and their rate
+// limiters. It is safe for concurrent use; set replaces the limits on reload.
+type requestLimits struct {
+	mu     sync.RWMutex
+	limits Limits
+	reads  *ratelimit.Limiter
+	writes *ratelimit.Limiter
+}
+
+func newRequestLimits(l Limits) *requestLimits {
+	rl := &requestLimits{}
+	rl.set(l)
+	return rl
+}
+
+// set replaces the limits. A limiter is only rebuilt, forgetting what clients
+// have used, when its rate or burst changes.
+func (rl *requestLimits) set(l Limits) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	old := rl.limits
+	if rl.reads == nil || l.ReadRate != old.ReadRate || l.ReadBurst != old.ReadBurst {
+		rl.reads = ratelimit.New(l.ReadRate, l.ReadBurst)
+	}
+	if rl.writes == nil || l.WriteRate != old.WriteRate || l.WriteBurst != old.WriteBurst {
+		rl.writes = ratelimit.New(l.WriteRate, l.WriteBurst)
+	}
+	rl.limits = l
+}
+
+func (rl *requestLimits) get() (Limits, *ratelimit.Limiter, *ratelimit.Limiter) {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.limits, rl.reads, rl.writes
+}
+
+// limitMiddleware rate limits /api/* requests per paired device, or per client
+// IP without one, and caps request bodies. Over the rate it answers 429 with
+// Retry-After; bodies declared larger than the limit get 413 at once, and
+// bodies that turn out larger fail when read (see respondBodyError).
+// It must run after authMiddleware so the device is known.
+func limitMiddleware(rl *requestLimits, m *serverMetrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l, reads, writes := rl.get()
+		limiter, kind := writes, "write"
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			limiter, kind = reads, "read"
+		}
+		if ok, wait := limiter.Allow(clientKey(r), time.Now()); !ok {
+			m.limited(kind)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondError(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		_, apiPath := splitChannelPath(r.URL.Path)
+		if max := l.maxBodyFor(apiPath); max > 0 && r.Body != nil {
+			if r.ContentLength > max {
+				m.limited("body")
+				respondError(w, fmt.Sprintf("request body larger than %d bytes", max), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey identifies the client a rate limit applies to: its paired device,
+// else its IP address.
+func clientKey(r *http.Request) string {
+	if d, ok := auth.DeviceFromContext(r.Context()); ok {
+		return "device:" + strconv.FormatInt(d.ID, 10)
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// respondBodyError answers a request whose body could not be read or parsed:
+// 413 when it exceeded the route's limit, else 400 with msg.
+func respondBodyError(w http.ResponseWriter, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondError(w, fmt.Sprintf("request body larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	respondError(w, msg, http.StatusBadRequest)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newLimitTestHandler(t *testing.T, l Limits) (*App, http.Handler) {
+	t.Helper()
+	a := newTestApp(t)
+	a.Limits = l
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/clipboard", a.handleClipboard)
+	mux.HandleFunc("/api/clipboard/blob", a.handleBlob)
+	mux.HandleFunc("/api/history/pin", a.handlePin)
+	mux.HandleFunc("/api/server-info", a.handleServerInfo)
+	return a, limitMiddleware(newRequestLimits(l), nil, mux)
+}
+
+func TestRateLimitsReadsAndWritesSeparately(t *testing.T) {
+	_, h := newLimitTestHandler(t, Limits{ReadRate: 1, ReadBurst: 2, WriteRate: 0.5, WriteBurst: 1})
+	send := func(method, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/clipboard", strings.NewReader(`{"text":"x"}`))
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := send(http.MethodPost, "10.0.0.2:5000"); rr.Code != http.StatusCreated {
+		t.Fatalf("first write = %d", rr.Code)
+	}
+	rr := send(http.MethodPost, "10.0.0.2:5001")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "2" {
+		t.Fatalf("second write = %d, Retry-After %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	// Reads have their own budget, and other clients theirs.
+	for i := 0; i < 2; i++ {
+		if rr := send(http.MethodGet, "10.0.0.2:5000"); rr.Code != http.StatusOK {
+			t.Fatalf("read %d = %d", i+1, rr.Code)
+		}
+	}
+	if rr := send(http.MethodGet, "10.0.0.2:5000"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("read past the burst = %d", rr.Code)
+	}
+	if rr := send(http.MethodPost, "10.0.0.3:5000"); rr.Code != http.StatusOK {
+		t.Fatalf("write from another client = %d", rr.Code)
+	}
+}
+
+func TestBodyLimits(t *testing.T) {
+	l := Limits{MaxBody: 64, MaxBodyByPath: map[string]int64{"/api/clipboard": 100, "/api/clipboard/blob": 200}}
+	_, h := newLimitTestHandler(t, l)
+	send := func(req *http.Request) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	text := `{"text":"` + strings.Repeat("a", 120) + `"}`
+	if code := send(httptest.NewRequest(http.MethodPost, "/api/clipboard", strings.NewReader(text))); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("declared oversize body = %d", code)
+	}
+	// Without a Content-Length the limit applies while reading.
+	chunked := httptest.NewRequest(http.MethodPost, "/api/clipboard", io.MultiReader(strings.NewReader(text)))
+	chunked.ContentLength = -1
+	if code := send(chunked); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("streamed oversize body = %d", code)
+	}
+	form := httptest.NewRequest(http.MethodPost, "/api/clipboard", io.MultiReader(strings.NewReader("text="+strings.Repeat("a", 120))))
+	form.ContentLength = -1
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if code := send(form); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversize form = %d", code)
+	}
+	if code := send(httptest.NewRequest(http.MethodPost, "/api/clipboard", strings.NewReader(`{"text":"fits"}`))); code != http.StatusCreated {
+		t.Fatalf("small body = %d", code)
+	}
+	// Routes without their own limit get MaxBody.
+	pin := httptest.NewRequest(http.MethodPost, "/api/history/pin", io.MultiReader(strings.NewReader(`{"id":1,"pinned":true,"pad":"`+strings.Repeat("x", 80)+`"}`)))
+	pin.ContentLength = -1
+	if code := send(pin); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversize pin = %d", code)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "big.bin")
+	fw.Write(bytes.Repeat([]byte{0xff}, 300))
+	mw.Close()
+	blob := httptest.NewRequest(http.MethodPost, "/api/clipboard/blob", io.MultiReader(&body))
+	blob.ContentLength = -1
+	blob.Header.Set("Content-Type", mw.FormDataContentType())
+	if code := send(blob); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversize multipart blob = %d", code)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/server-info", nil))
+	var info struct{ Limits Limits }
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil || info.Limits.MaxBodyByPath["/api/clipboard"] != 100 || info.Limits.MaxBody != 64 {
+		t.Fatalf("server-info = %s", rr.Body.String())
+	}
+}
@@ -2,73 +2,99 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
-	"sync"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
+
+	"local-clipboard/internal/requestlog"
+	"local-clipboard/internal/sensitive"
 )
 
-const maxRequestLogs = 500
 const maxBodyLogSize = 64 * 1024 // 64KB per body
 
-// RequestLogEntry is a single HTTP request log entry.
-type RequestLogEntry struct {
-	Method       string    `json:"method"`
-	Path         string    `json:"path"`
-	Status       int       `json:"status"`
-	RemoteAddr   string    `json:"remote_addr"`
-	Timestamp    time.Time `json:"timestamp"`
-	RequestBody  string    `json:"request_body,omitempty"`
-	ResponseBody string    `json:"response_body,omitempty"`
+// secretBodyPaths are logged without request/response bodies (they carry tokens
+// or codes, or a copy of the whole history).
+var secretBodyPaths = map[string]bool{
+	"/api/pair":           true,
+	"/api/auth/pair-code": true,
+	"/api/channels":       true,
+	"/api/export":         true,
 }
 
-// RequestLogs holds in-memory request log entries (ring buffer).
-type RequestLogs struct {
-	mu     sync.RWMutex
-	entries []RequestLogEntry
-}
+// secretHeaders carry credentials; their values are masked in the log, and a
+// replay sends the replaying client's own instead.
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie", channelTokenHeader}
 
-// NewRequestLogs creates a new request log store.
-func NewRequestLogs() *RequestLogs {
-	return &RequestLogs{entries: make([]RequestLogEntry, 0, maxRequestLogs)}
-}
+const redactedHeader = "[redacted]"
 
-// Add appends a log entry. Keeps at most maxRequestLogs entries.
-func (l *RequestLogs) Add(e RequestLogEntry) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.entries = append(l.entries, e)
-	if len(l.entries) > maxRequestLogs {
-		l.entries = l.entries[len(l.entries)-maxRequestLogs:]
+// headersForLog returns a copy of h with credentials masked.
+func headersForLog(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
 	}
-}
-
-// List returns a copy of recent entries (newest first).
-func (l *RequestLogs) List() []RequestLogEntry {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	out := make([]RequestLogEntry, len(l.entries))
-	copy(out, l.entries)
-	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
-		out[i], out[j] = out[j], out[i]
+	h = h.Clone()
+	for _, name := range secretHeaders {
+		if _, ok := h[name]; ok {
+			h[name] = []string{redactedHeader}
+		}
 	}
-	return out
+	return h
 }
 
-// responseRecorder buffers the response to capture body, then flushes to w at the end.
+// responseRecorder passes the response straight through to the client while
+// keeping the status and the first maxBodyLogSize bytes of the body for the log.
+// It implements http.Flusher so streaming handlers (e.g. /api/events) work behind it.
 type responseRecorder struct {
 	http.ResponseWriter
-	status int
-	buf    bytes.Buffer
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	size        int64 // Bytes written in total
 }
 
 func (r *responseRecorder) WriteHeader(code int) {
+	if r.wroteHeader {
+		return
+	}
 	r.status = code
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(code)
 }
 
 func (r *responseRecorder) Write(p []byte) (int, error) {
-	return r.buf.Write(p)
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if room := maxBodyLogSize + 1 - r.buf.Len(); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		r.buf.Write(p[:room])
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
 }
 
 func (r *responseRecorder) Status() int {
@@ -78,6 +104,38 @@ func (r *responseRecorder) Status() int {
 	return r.status
 }
 
+// statusRecorder keeps only the response status, for requests that are not logged.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
 func truncateForLog(b []byte, max int) string {
 	if len(b) == 0 {
 		return ""
@@ -88,46 +146,128 @@ func truncateForLog(b []byte, max int) string {
 	return string(b)
 }
 
-// loggingMiddleware logs each request and passes to next.
-func loggingMiddleware(logs *RequestLogs, next http.Handler) http.Handler {
+// bodyForLog returns the body as logged text with secrets masked (see
+// sensitive.Redact); binary payloads (images, files) are replaced by a short placeholder.
+// Unless keepText is set, clipboard text is masked too (see redactText).
+func bodyForLog(contentType string, b []byte, keepText bool) string {
+	if len(b) == 0 {
+		return ""
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if mt == "" || strings.HasPrefix(mt, "text/") || mt == "application/json" || mt == "application/x-www-form-urlencoded" {
+		body := truncateForLog(b, maxBodyLogSize)
+		if !keepText {
+			body = redactText(mt, body)
+		}
+		return sensitive.Redact(body)
+	}
+	if len(b) > maxBodyLogSize {
+		return fmt.Sprintf("[binary %s, more than %d bytes]", mt, maxBodyLogSize)
+	}
+	return fmt.Sprintf("[binary %s, %d bytes]", mt, len(b))
+}
+
+// jsonTextField matches the value of a "text" or "snippet" member in JSON,
+// including one cut off by truncation.
+var jsonTextField = regexp.MustCompile(`("(?:text|snippet)"\s*:\s*)"((?:[^"\\]|\\.)*)(?:"|$)`)
+
+// redactText masks clipboard text in a logged body, keeping its size: the
+// "text" and "snippet" members of JSON (also inside event streams and lists)
+// and the text field of forms.
+func redactText(mediaType, body string) string {
+	if mediaType == "application/x-www-form-urlencoded" {
+		v, err := url.ParseQuery(body)
+		if err != nil || !v.Has("text") {
+			return body
+		}
+		v.Set("text", redactedPlaceholder(len(v.Get("text"))))
+		return v.Encode()
+	}
+	return jsonTextField.ReplaceAllStringFunc(body, func(m string) string {
+		sub := jsonTextField.FindStringSubmatch(m)
+		var text string
+		size := len(sub[2])
+		if json.Unmarshal([]byte(`"`+sub[2]+`"`), &text) == nil {
+			size = len(text)
+		}
+		return sub[1] + `"` + redactedPlaceholder(size) + `"`
+	})
+}
+
+func redactedPlaceholder(size int) string {
+	return fmt.Sprintf("[redacted: %d bytes]", size)
+}
+
+// unloggedPaths are counted in metrics but kept out of the request log, which
+// they would otherwise fill with their own reads and scrapes.
+var unloggedPaths = map[string]bool{
+	"/api/logs":        true,
+	"/api/logs/export": true,
+	"/metrics":         true,
+}
+
+// loggingMiddleware logs each request, records its status and latency in m
+// (which may be nil) and passes to next. Clipboard text in logged bodies is
+// masked unless keepText is set.
+func loggingMiddleware(logs *requestlog.Store, m *serverMetrics, keepText bool, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 		path := r.URL.Path
 		if path == "" {
 			path = "/"
 		}
-		if path == "/api/logs" {
-			next.ServeHTTP(w, r)
+		if unloggedPaths[path] {
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			m.observeRequest(r, rec.Status(), time.Since(start))
 			return
 		}
 
 		var requestBody []byte
 		if r.Body != nil && (r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch) {
 			requestBody, _ = io.ReadAll(io.LimitReader(r.Body, maxBodyLogSize+1))
-			r.Body = io.NopCloser(bytes.NewReader(requestBody))
+			// Hand the handler the captured prefix followed by the unread remainder.
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
 		}
 
-		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		rec := &responseRecorder{ResponseWriter: w}
 		next.ServeHTTP(rec, r)
-
-		// Flush buffered response to client
-		if rec.status != 0 {
-			w.WriteHeader(rec.status)
-		}
+		elapsed := time.Since(start)
+		m.observeRequest(r, rec.Status(), elapsed)
 		respBytes := rec.buf.Bytes()
-		w.Write(respBytes)
 
 		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 		if ip == "" {
 			ip = r.RemoteAddr
 		}
-		logs.Add(RequestLogEntry{
-			Method:       r.Method,
-			Path:         path,
-			Status:       rec.Status(),
-			RemoteAddr:   ip,
-			Timestamp:    time.Now().UTC(),
-			RequestBody:  truncateForLog(requestBody, maxBodyLogSize),
-			ResponseBody: truncateForLog(respBytes, maxBodyLogSize),
+		if _, apiPath := splitChannelPath(path); secretBodyPaths[apiPath] {
+			requestBody, respBytes = nil, nil
+		}
+		requestSize := r.ContentLength
+		if requestSize < 0 {
+			requestSize = int64(len(requestBody))
+		}
+		loggedBody := bodyForLog(r.Header.Get("Content-Type"), requestBody, keepText)
+		logs.Add(requestlog.Entry{
+			Method:          r.Method,
+			Path:            path,
+			Query:           r.URL.RawQuery,
+			Proto:           r.Proto,
+			Status:          rec.Status(),
+			RemoteAddr:      ip,
+			Timestamp:       start.UTC(),
+			DurationMS:      float64(elapsed.Microseconds()) / 1000,
+			RequestHeaders:  headersForLog(r.Header),
+			ResponseHeaders: headersForLog(w.Header()),
+			RequestBody:     loggedBody,
+			ResponseBody:    bodyForLog(w.Header().Get("Content-Type"), respBytes, keepText),
+			RequestSize:     requestSize,
+			ResponseSize:    rec.size,
+			// Only a body logged byte for byte can be sent again.
+			Replayable: int64(len(requestBody)) == requestSize && loggedBody == string(requestBody),
 		})
 	})
 }
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"local-clipboard/internal/discovery"
+	"local-clipboard/internal/version"
+)
+
+// mdnsService describes this server for DNS-SD. The TXT record carries the
+// version, whether TLS/auth are on, and the certificate fingerprint so clients
+// using -server auto can pin it.
+func mdnsService(port, fingerprint string, authRequired bool) (discovery.Service, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return discovery.Service{}, err
+	}
+	host, err := os.Hostname()
+	if err != nil || strings.TrimSpace(host) == "" {
+		host = "local-clipboard"
+	}
+	host, _, _ = strings.Cut(host, ".")
+	var ips []net.IP
+	for _, s := range LocalIPs() {
+		ips = append(ips, net.ParseIP(s))
+	}
+	txt := map[string]string{"version": version.Version, "tls": "0", "auth": "0"}
+	if fingerprint != "" {
+		txt["tls"], txt["fp"] = "1", fingerprint
+	}
+	if authRequired {
+		txt["auth"] = "1"
+	}
+	return discovery.Service{
+		Instance: "local-clipboard on " + host,
+		Host:     host,
+		Port:     p,
+		IPs:      ips,
+		TXT:      txt,
+	}, nil
+}
+
+// advertise announces the server over mDNS until ctx is done, then says
+// goodbye so browsers drop it at once. Failures are logged, not fatal.
+func advertise(ctx context.Context, port, fingerprint string, authRequired bool) {
+	svc, err := mdnsService(port, fingerprint, authRequired)
+	if err != nil {
+		log.Printf("mdns: %v", err)
+		return
+	}
+	if len(svc.IPs) == 0 {
+		log.Printf("mdns: no LAN addresses to advertise")
+		return
+	}
+	log.Printf("mdns: advertising %q as %s", svc.Instance, discovery.ServiceType)
+	if err := discovery.Advertise(ctx, svc, discovery.Options{}); err != nil {
+		log.Printf("mdns: %v", err)
+	}
+}
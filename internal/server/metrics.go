@@ -0,0 +1,207 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/auth"
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/metrics"
+	"local-clipboard/internal/models"
+)
+
+// dbBuckets are upper bounds in seconds for SQLite query latency.
+var dbBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, 1}
+
+// serverMetrics records what the server exposes on /metrics. A nil
+// *serverMetrics records nothing, so handlers need not check -metrics.
+type serverMetrics struct {
+	requests  *metrics.Counter   // route, method, status
+	latency   *metrics.Histogram // route, status
+	pushes    *metrics.Counter   // source of the stored entry
+	pulls     *metrics.Counter   // name of the client that read the clipboard
+	dbLatency *metrics.Histogram // History method
+	rejected  *metrics.Counter   // Requests refused by limitMiddleware, by limit
+	denied    *metrics.Counter   // Requests from clients outside the allowed networks
+
+	mux *http.ServeMux // Resolves request paths to route patterns for labels
+}
+
+// newServerMetrics registers the server metrics on reg. The history gauges are
+// read from h at scrape time.
+func newServerMetrics(reg *metrics.Registry, h *history.DBHistory, mux *http.ServeMux) *serverMetrics {
+	m := &serverMetrics{
+		requests:  reg.Counter("local_clipboard_http_requests_total", "HTTP requests by route pattern, method and status.", "route", "method", "status"),
+		latency:   reg.Histogram("local_clipboard_http_request_duration_seconds", "HTTP request latency by route pattern and status; event streams count until they close.", metrics.DefBuckets, "route", "status"),
+		pushes:    reg.Counter("local_clipboard_pushes_total", "Clipboard entries stored, by source.", "source"),
+		pulls:     reg.Counter("local_clipboard_pulls_total", "Clipboard reads (latest entry, blobs and streamed events), by the name the client reports.", "source"),
+		dbLatency: reg.Histogram("local_clipboard_db_query_duration_seconds", "SQLite history query latency by operation.", dbBuckets, "op"),
+		rejected:  reg.Counter("local_clipboard_limited_requests_total", "Requests refused for exceeding the read or write rate or the body size limit.", "limit"),
+		denied:    reg.Counter("local_clipboard_denied_requests_total", "Requests refused because the client is outside the allowed networks."),
+		mux:       mux,
+	}
+	reg.GaugeFunc("local_clipboard_history_entries", "Rows in the clipboard history.", func() (float64, error) {
+		st, err := h.Stats()
+		return float64(st.Entries), err
+	})
+	reg.GaugeFunc("local_clipboard_db_size_bytes", "Size of the SQLite database file and its write-ahead log.", func() (float64, error) {
+		st, err := h.Stats()
+		return float64(st.Bytes), err
+	})
+	return m
+}
+
+// observeRequest records a finished request.
+func (m *serverMetrics) observeRequest(r *http.Request, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	route, code := m.route(r), strconv.Itoa(status)
+	m.requests.Inc(route, r.Method, code)
+	m.latency.Observe(elapsed.Seconds(), route, code)
+}
+
+// route returns the mux pattern serving r, so that ids and channel names in
+// paths do not become label values.
+func (m *serverMetrics) route(r *http.Request) string {
+	_, apiPath := splitChannelPath(r.URL.Path)
+	_, pattern := m.mux.Handler(&http.Request{Method: r.Method, Host: r.Host, URL: &url.URL{Path: apiPath}})
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+func (m *serverMetrics) push(e models.ClipboardUpdate) {
+	if m != nil {
+		m.pushes.Inc(e.Source)
+	}
+}
+
+// limited counts a request refused by limit ("read", "write" or "body").
+func (m *serverMetrics) limited(limit string) {
+	if m != nil {
+		m.rejected.Inc(limit)
+	}
+}
+
+func (m *serverMetrics) deny() {
+	if m != nil {
+		m.denied.Inc()
+	}
+}
+
+func (m *serverMetrics) pull(r *http.Request) {
+	if m != nil {
+		m.pulls.Inc(requester(r))
+	}
+}
+
+// requester names the client behind r: the name it reports, else the name of
+// its paired device.
+func requester(r *http.Request) string {
+	if name := strings.TrimSpace(r.Header.Get(clientNameHeader)); name != "" {
+		return truncate(name, maxDeviceName)
+	}
+	if d, ok := auth.DeviceFromContext(r.Context()); ok {
+		return d.Name
+	}
+	return "unknown"
+}
+
+// timedHistory records the latency of every History call in m.
+type timedHistory struct {
+	history.History
+	m *serverMetrics
+}
+
+func (t timedHistory) observe(op string, start time.Time) {
+	t.m.dbLatency.Observe(time.Since(start).Seconds(), op)
+}
+
+func (t timedHistory) Insert(e models.ClipboardUpdate) (models.ClipboardUpdate, error) {
+	defer t.observe("insert", time.Now())
+	return t.History.Insert(e)
+}
+
+func (t timedHistory) InsertBlob(meta models.ClipboardUpdate, data []byte) (models.ClipboardUpdate, error) {
+	defer t.observe("insert_blob", time.Now())
+	return t.History.InsertBlob(meta, data)
+}
+
+func (t timedHistory) Blob(id int64) ([]byte, error) {
+	defer t.observe("blob", time.Now())
+	return t.History.Blob(id)
+}
+
+func (t timedHistory) Latest(channel string) (models.ClipboardUpdate, error) {
+	defer t.observe("latest", time.Now())
+	return t.History.Latest(channel)
+}
+
+func (t timedHistory) ByID(id int64) (models.ClipboardUpdate, error) {
+	defer t.observe("by_id", time.Now())
+	return t.History.ByID(id)
+}
+
+func (t timedHistory) Consume(id int64) (models.ClipboardUpdate, error) {
+	defer t.observe("consume", time.Now())
+	return t.History.Consume(id)
+}
+
+func (t timedHistory) List(q history.Query) (history.Page, error) {
+	op := "list"
+	if q.Search != "" {
+		op = "search"
+	}
+	defer t.observe(op, time.Now())
+	return t.History.List(q)
+}
+
+func (t timedHistory) Channels() ([]string, error) {
+	defer t.observe("channels", time.Now())
+	return t.History.Channels()
+}
+
+func (t timedHistory) SetPinned(id int64, pinned bool) error {
+	defer t.observe("set_pinned", time.Now())
+	return t.History.SetPinned(id, pinned)
+}
+
+func (t timedHistory) UpdateTags(id int64, add, remove []string) error {
+	defer t.observe("update_tags", time.Now())
+	return t.History.UpdateTags(id, add, remove)
+}
+
+func (t timedHistory) Tags(channel string) ([]models.TagCount, error) {
+	defer t.observe("tags", time.Now())
+	return t.History.Tags(channel)
+}
+
+func (t timedHistory) Delete(id int64) error {
+	defer t.observe("delete", time.Now())
+	return t.History.Delete(id)
+}
+
+func (t timedHistory) DeleteExpired() ([]models.ClipboardUpdate, error) {
+	defer t.observe("delete_expired", time.Now())
+	return t.History.DeleteExpired()
+}
+
+func (t timedHistory) Prune(r history.Retention, dryRun bool) (history.PruneResult, error) {
+	defer t.observe("prune", time.Now())
+	return t.History.Prune(r, dryRun)
+}
+
+func (t timedHistory) Export(q history.ExportQuery, fn func(e models.ClipboardUpdate, data []byte) error) error {
+	defer t.observe("export", time.Now())
+	return t.History.Export(q, fn)
+}
+
+func (t timedHistory) Import(next func() (models.ClipboardUpdate, []byte, error)) (history.ImportResult, error) {
+	defer t.observe("import", time.Now())
+	return t.History.Import(next)
+}
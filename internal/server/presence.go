@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"local-clipboard/internal/auth"
+	"local-clipboard/internal/models"
+	"local-clipboard/internal/presence"
+)
+
+// Headers clients send so the server can keep its device registry.
+const (
+	clientIDHeader      = "X-Client-ID"
+	clientNameHeader    = "X-Client-Name"
+	clientVersionHeader = "X-Client-Version"
+	clientBackendHeader = "X-Clipboard-Backend"
+)
+
+// presenceMiddleware records every /api/* request that carries a client id in
+// the device registry. While a client holds /api/events open it counts as online.
+func presenceMiddleware(reg *presence.Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(clientIDHeader)
+		if id == "" || len(id) > 64 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		d := models.DeviceStatus{
+			ID:      id,
+			Name:    truncate(r.Header.Get(clientNameHeader), maxDeviceName),
+			IP:      ip,
+			Version: truncate(r.Header.Get(clientVersionHeader), 32),
+			Backend: truncate(r.Header.Get(clientBackendHeader), 32),
+			Channel: channelFrom(r),
+		}
+		if paired, ok := auth.DeviceFromContext(r.Context()); ok {
+			d.PairedID = paired.ID
+		}
+		reg.Seen(d)
+		if r.URL.Path == "/api/events" {
+			defer reg.Connected(id)()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// handleDeviceStatus lists clients from the device registry with their online state.
+func (a *App) handleDeviceStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Presence == nil {
+		respondJSON(w, http.StatusOK, []models.DeviceStatus{})
+		return
+	}
+	respondJSON(w, http.StatusOK, a.Presence.List())
+}
+
+// handleDevicePing lets clients without an event stream report that they are
+// still running; presenceMiddleware does the recording.
+func (a *App) handleDevicePing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/models"
+	"local-clipboard/internal/presence"
+)
+
+func TestPresenceMiddlewareRecordsClients(t *testing.T) {
+	a := newTestApp(t)
+	a.Presence = presence.NewRegistry(a.History.(*history.DBHistory).DB(), time.Minute)
+	if err := a.Presence.Init(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/devices", a.handleDeviceStatus)
+	mux.HandleFunc("/api/devices/ping", a.handleDevicePing)
+	h := channelMiddleware(a.Channels, presenceMiddleware(a.Presence, mux))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/channels/work/devices/ping", nil)
+	req.RemoteAddr = "192.168.1.7:50000"
+	req.Header.Set(clientIDHeader, "c0ffee")
+	req.Header.Set(clientNameHeader, "laptop")
+	req.Header.Set(clientVersionHeader, "1.2.3")
+	req.Header.Set(clientBackendHeader, "xclip")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("ping: expected 204 got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/devices", nil))
+	var list []models.DeviceStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected one device, got %s", rr.Body.String())
+	}
+	d := list[0]
+	if d.ID != "c0ffee" || d.Name != "laptop" || d.IP != "192.168.1.7" || d.Version != "1.2.3" || d.Backend != "xclip" || d.Channel != "work" || !d.Online {
+		t.Fatalf("unexpected device: %+v", d)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"log"
+
+	"local-clipboard/internal/history"
+)
+
+// reload applies the settings of cfg that can change while the server runs:
+// Allow, TrustedProxies, Limits, Retention, Sensitive and SensitiveTTL. The
+// other fields of cfg are ignored. Nothing changes when cfg is invalid.
+func reload(cfg Config, app *App, access *accessList, limits *requestLimits) error {
+	allow, proxies, err := cfg.networks()
+	if err != nil {
+		return err
+	}
+	access.set(allow, proxies)
+	limits.set(cfg.Limits)
+	app.mu.Lock()
+	app.Limits = cfg.Limits
+	app.Sensitive, app.SensitiveTTL = cfg.Sensitive, cfg.SensitiveTTL
+	app.Retention = cfg.Retention
+	app.mu.Unlock()
+	log.Printf("reloaded settings; accepting clients from %s", joinNetworks(allow))
+	return nil
+}
+
+// retention returns the limits the janitor enforces.
+func (a *App) retention() history.Retention {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Retention
+}
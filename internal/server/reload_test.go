@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/sensitive"
+)
+
+func TestReloadAppliesSafeSettings(t *testing.T) {
+	a := newTestApp(t)
+	cfg := Config{Allow: []string{"192.168.1.0/24"}, Limits: Limits{WriteRate: 1, WriteBurst: 1}}
+	allow, proxies, err := cfg.networks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	access := newAccessList(allow, proxies)
+	limits := newRequestLimits(cfg.Limits)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/clipboard", a.handleClipboard)
+	h := accessMiddleware(access, nil, limitMiddleware(limits, nil, mux))
+	push := func(remote, text string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/clipboard", strings.NewReader(`{"text":"`+text+`"}`))
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := push("192.168.1.2:5000", "one"); code != http.StatusCreated {
+		t.Fatalf("first push = %d", code)
+	}
+	if code := push("192.168.1.2:5000", "two"); code != http.StatusTooManyRequests {
+		t.Fatalf("second push = %d", code)
+	}
+
+	next := Config{
+		Allow:     []string{"10.0.0.0/8"},
+		Limits:    Limits{WriteRate: 5, WriteBurst: 5},
+		Retention: history.Retention{MaxEntries: 10},
+		Sensitive: sensitive.ActionRefuse, SensitiveTTL: time.Minute,
+	}
+	if err := reload(next, a, access, limits); err != nil {
+		t.Fatal(err)
+	}
+	if code := push("192.168.1.2:5000", "three"); code != http.StatusForbidden {
+		t.Fatalf("push from a network no longer allowed = %d", code)
+	}
+	if code := push("10.0.0.2:5000", "four"); code != http.StatusCreated {
+		t.Fatalf("push from a newly allowed network = %d", code)
+	}
+	if action, ttl := a.sensitivity(); action != sensitive.ActionRefuse || ttl != time.Minute {
+		t.Fatalf("sensitivity = %s, %s", action, ttl)
+	}
+	if a.retention().MaxEntries != 10 {
+		t.Fatalf("retention = %+v", a.retention())
+	}
+
+	// An invalid config changes nothing.
+	if err := reload(Config{Allow: []string{"nowhere"}}, a, access, limits); err == nil {
+		t.Fatal("invalid networks accepted")
+	}
+	if code := push("10.0.0.2:5000", "five"); code != http.StatusCreated {
+		t.Fatalf("push after a failed reload = %d", code)
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local-clipboard/internal/requestlog"
+)
+
+// replayTimeout bounds how long a replayed request may run.
+const replayTimeout = 10 * time.Second
+
+// replayResult answers POST /api/logs/{id}/replay: the logged request and
+// response, and the response the same request gets now.
+type replayResult struct {
+	Original requestlog.Entry `json:"original"`
+	Replay   replayResponse   `json:"replay"`
+}
+
+type replayResponse struct {
+	Status     int         `json:"status"`
+	Headers    http.Header `json:"headers,omitempty"` // Credentials masked
+	Body       string      `json:"body,omitempty"`    // Masked like logged bodies
+	Size       int64       `json:"size"`
+	DurationMS float64     `json:"duration_ms"`
+}
+
+// replayable reports whether a request to apiPath may be replayed. Event
+// streams never finish, pairing codes are single use, and replaying the log's
+// own endpoints would only recurse. Exports and blob downloads are refused
+// too: their responses are whole histories or files, not something to show
+// in a log viewer.
+func replayable(method, apiPath string) bool {
+	switch {
+	case apiPath == "/api/events", apiPath == "/api/pair", apiPath == "/api/export":
+		return false
+	case apiPath == "/api/logs", strings.HasPrefix(apiPath, "/api/logs/"):
+		return false
+	case apiPath == "/api/clipboard/blob" && method != http.MethodPost:
+		return false
+	}
+	return true
+}
+
+// replayRecorder captures the response of a replayed request. It keeps the
+// first maxBodyLogSize bytes of the body, as much as the result shows, and
+// only counts the rest.
+type replayRecorder struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+	size   int64
+}
+
+func (r *replayRecorder) Header() http.Header { return r.header }
+
+func (r *replayRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+}
+
+func (r *replayRecorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if room := maxBodyLogSize + 1 - r.buf.Len(); room > 0 {
+		r.buf.Write(p[:min(room, len(p))])
+	}
+	r.size += int64(len(p))
+	return len(p), nil
+}
+
+// handleReplayLog sends a logged request through the API again, as the calling
+// device: logged credentials are masked, so the caller's own Authorization,
+// cookie and channel token are used. Only requests whose body was logged in
+// full can be replayed; pushes therefore need -log-bodies.
+func (a *App) handleReplayLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Logs == nil || a.Replay == nil {
+		respondError(w, "replay is not available", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		respondError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	e, err := a.Logs.ByID(id)
+	if errors.Is(err, requestlog.ErrNotFound) {
+		respondError(w, "log entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondError(w, "failed to read request log", http.StatusInternalServerError)
+		return
+	}
+	if _, apiPath := splitChannelPath(e.Path); !replayable(e.Method, apiPath) {
+		respondError(w, "this request cannot be replayed", http.StatusUnprocessableEntity)
+		return
+	}
+	if !e.Replayable {
+		respondError(w, "request body was not logged in full (masked, binary or truncated)", http.StatusUnprocessableEntity)
+		return
+	}
+
+	target := e.Path
+	if e.Query != "" {
+		target += "?" + e.Query
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), replayTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, e.Method, target, strings.NewReader(e.RequestBody))
+	if err != nil {
+		respondError(w, "logged request is not valid", http.StatusUnprocessableEntity)
+		return
+	}
+	for name, values := range e.RequestHeaders {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	req.Header.Del("Content-Length")
+	for _, name := range secretHeaders {
+		req.Header.Del(name)
+		if values, ok := r.Header[name]; ok {
+			req.Header[name] = values
+		}
+	}
+	req.Host, req.RemoteAddr, req.TLS = r.Host, r.RemoteAddr, r.TLS
+
+	rec := &replayRecorder{header: http.Header{}}
+	start := time.Now()
+	a.Replay.ServeHTTP(rec, req)
+	elapsed := time.Since(start)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	respondJSON(w, http.StatusOK, replayResult{
+		Original: e,
+		Replay: replayResponse{
+			Status:     rec.status,
+			Headers:    headersForLog(rec.header),
+			Body:       bodyForLog(rec.header.Get("Content-Type"), rec.buf.Bytes(), a.LogBodies),
+			Size:       rec.size,
+			DurationMS: float64(elapsed.Microseconds()) / 1000,
+		},
+	})
+}
@@ -1,55 +1,308 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	_ "embed"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
 
+	"local-clipboard/internal/auth"
+	"local-clipboard/internal/channels"
 	"local-clipboard/internal/history"
+	"local-clipboard/internal/metrics"
+	"local-clipboard/internal/presence"
+	"local-clipboard/internal/requestlog"
+	"local-clipboard/internal/sensitive"
 	"local-clipboard/internal/store"
 )
 
+const (
+	defaultOfflineAfter = 2 * time.Minute
+	shutdownTimeout     = 10 * time.Second // How long Run waits for requests in flight on shutdown
+)
+
 //go:embed static/index.html
 var indexHTML []byte
 
 // Config holds server options.
 type Config struct {
-	Addr     string // Listen address, e.g. ":8080"
-	DBPath   string // Path to SQLite database
+	Addr      string // Listen address, e.g. ":8080"
+	DBPath    string // Path to SQLite database
 	StaticDir string // Root directory for static files (e.g. "web/dist"). Empty = use embedded fallback.
+
+	TLS           bool          // Serve HTTPS with a self-signed certificate kept next to the database
+	DisableAuth   bool          // Serve /api/* without device tokens (previous open behavior)
+	TrustLoopback bool          // Let direct requests from 127.0.0.1/::1 through without a token (used by "run" mode)
+	RequireE2E    bool          // Reject plaintext text entries; clients must encrypt with a shared passphrase
+	OfflineAfter  time.Duration // Silence after which a client is shown as offline (default 2m)
+	MDNS          bool          // Advertise the server on the LAN as _local-clipboard._tcp
+
+	Allow          []string // Networks clients may connect from: addresses, CIDRs or lan, private, loopback, any (default lan)
+	TrustedProxies []string // Reverse proxies whose X-Forwarded-For header names the client, in the same forms
+	BindInterface  string   // Listen only on the addresses of this network interface, at Addr's port
+
+	Retention     history.Retention // Limits enforced on the history; pinned entries are always kept
+	PruneInterval time.Duration     // How often the retention janitor runs (default 1h)
+
+	Sensitive    sensitive.Action // What to do with text that looks like a secret; zero means off (the -sensitive flag defaults to expire)
+	SensitiveTTL time.Duration    // Lifetime of entries flagged as sensitive (default 10m)
+
+	PersistLogs  bool          // Keep the request log in the database instead of the last 500 requests in memory
+	LogRetention time.Duration // Age after which persisted request logs are removed (0 keeps them)
+	LogBodies    bool          // Keep clipboard text in logged request and response bodies instead of masking it
+
+	Limits Limits // Per-client rate limits and request body limits (see DefaultLimits)
+
+	Metrics *metrics.Registry // Served on /metrics (without auth) and fed by the server; nil disables metrics
+
+	Ready  chan<- struct{} // Closed once the listener is bound and requests are served
+	Reload <-chan Config   // New settings to apply while serving (see reload); others need a restart
 }
 
-// Run starts the HTTP server. It does not return unless there is a fatal error.
-func Run(cfg Config) {
-	h := history.NewSqlite(cfg.DBPath)
+// Run serves the clipboard until ctx is done. It then stops accepting
+// connections, waits up to shutdownTimeout for requests in flight, stops the
+// background jobs and closes the database. Errors starting or serving are
+// returned; a clean shutdown returns nil.
+func Run(ctx context.Context, cfg Config) error {
+	allow, proxies, err := cfg.networks()
+	if err != nil {
+		return err
+	}
+
+	h := history.NewDB(cfg.DBPath)
 	if err := h.Init(); err != nil {
-		log.Fatalf("failed to initialize sqlite history: %v", err)
+		return fmt.Errorf("initialize history database: %w", err)
+	}
+	defer h.Close()
+	// Background jobs use the database, so they are stopped (deferred below)
+	// before it is closed, including when Run fails to start.
+	var jobs sync.WaitGroup
+	ctx, cancel := context.WithCancel(ctx)
+	defer jobs.Wait()
+	defer cancel()
+	background := func(fn func()) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			fn()
+		}()
+	}
+
+	reg := channels.NewStore(h.DB())
+	if err := reg.Init(); err != nil {
+		return fmt.Errorf("initialize channels: %w", err)
+	}
+	offlineAfter := cfg.OfflineAfter
+	if offlineAfter <= 0 {
+		offlineAfter = defaultOfflineAfter
+	}
+	devices := presence.NewRegistry(h.DB(), offlineAfter)
+	if err := devices.Init(); err != nil {
+		return fmt.Errorf("initialize device registry: %w", err)
+	}
+	e2eSalt, err := h.E2ESalt()
+	if err != nil {
+		return fmt.Errorf("read end-to-end encryption salt: %w", err)
 	}
 	st := store.New()
-	if latest, err := h.Latest(); err == nil {
-		st.Set(latest)
+	st.Fallback = h.MostRecent
+	names, err := h.Channels()
+	if err != nil {
+		return fmt.Errorf("read channels: %w", err)
+	}
+	for _, name := range names {
+		if latest, err := h.Latest(name); err == nil {
+			st.Set(latest)
+		}
+	}
+	requestLogs := requestlog.NewMemory()
+	if cfg.PersistLogs {
+		requestLogs = requestlog.NewDB(h.DB(), cfg.LogRetention)
 	}
-	requestLogs := NewRequestLogs()
 	port := PortFromAddr(cfg.Addr)
-	serverURLs := ServerURLs(port)
-	app := &App{Store: st, History: h, Logs: requestLogs, ServerURLs: serverURLs}
+	scheme := "http"
+	var tlsConfig *tls.Config
+	var fingerprint string
+	if cfg.TLS {
+		cert, fp, err := EnsureCertificate(cfg.DBPath)
+		if err != nil {
+			return fmt.Errorf("set up TLS certificate: %w", err)
+		}
+		scheme, fingerprint = "https", fp
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	serverURLs := ServerURLs(scheme, port, cfg.BindInterface)
+	app := &App{Store: st, History: h, Channels: reg, Presence: devices, Events: store.NewBroker(), Logs: requestLogs, LogBodies: cfg.LogBodies, Limits: cfg.Limits, ServerURLs: serverURLs, TLSFingerprint: fingerprint, RequireE2E: cfg.RequireE2E, E2ESalt: e2eSalt, Sensitive: cfg.Sensitive, SensitiveTTL: cfg.SensitiveTTL, Retention: cfg.Retention}
+	if !cfg.DisableAuth {
+		app.Devices = auth.NewStore(h.DB())
+		if err := app.Devices.Init(); err != nil {
+			return fmt.Errorf("initialize device store: %w", err)
+		}
+		app.Pairing = auth.NewPairing(pairingCodeTTL)
+		app.Pairing.OnNew = func(code string, expires time.Time) {
+			log.Printf("pairing code: %s (valid until %s)", code, expires.Format("15:04:05"))
+		}
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/clipboard", app.handleClipboard)
+	mux.HandleFunc("/api/clipboard/blob", app.handleBlob)
+	mux.HandleFunc("/api/events", app.handleEvents)
 	mux.HandleFunc("/api/history", app.handleHistory)
 	mux.HandleFunc("/api/history/pin", app.handlePin)
 	mux.HandleFunc("/api/history/delete", app.handleDelete)
+	mux.HandleFunc("/api/history/tags", app.handleTags)
+	mux.HandleFunc("/api/export", app.handleExport)
 	mux.HandleFunc("/api/logs", app.handleLogs)
+	mux.HandleFunc("/api/logs/export", app.handleLogsExport)
+	mux.HandleFunc("/api/logs/{id}/replay", app.handleReplayLog)
 	mux.HandleFunc("/api/server-info", app.handleServerInfo)
+	mux.HandleFunc("/api/channels", app.handleChannels)
+	mux.HandleFunc("/api/devices", app.handleDeviceStatus)
+	mux.HandleFunc("/api/devices/ping", app.handleDevicePing)
+	mux.HandleFunc("/api/pair", app.handlePair)
+	mux.HandleFunc("/api/auth/pair-code", app.handlePairCode)
+	mux.HandleFunc("/api/auth/devices", app.handleDevices)
+	mux.HandleFunc("/api/auth/devices/revoke", app.handleRevokeDevice)
 	mux.Handle("/", &spaHandler{rootDir: cfg.StaticDir, embed: indexHTML})
+	if cfg.Metrics != nil {
+		app.Metrics = newServerMetrics(cfg.Metrics, h, mux)
+		app.History = timedHistory{History: h, m: app.Metrics}
+		mux.Handle("/metrics", cfg.Metrics.Handler())
+	}
 
-	handler := loggingMiddleware(requestLogs, mux)
-	log.Printf("clipboard server listening on %s", cfg.Addr)
+	background(func() { app.runSweeper(ctx) })
+	background(func() { app.runJanitor(ctx, cfg.PruneInterval) })
+	if requestLogs.Persistent() {
+		background(func() { runLogJanitor(ctx, requestLogs) })
+	}
+
+	var handler http.Handler = channelMiddleware(reg, presenceMiddleware(devices, mux))
+	limits := newRequestLimits(cfg.Limits)
+	handler = limitMiddleware(limits, app.Metrics, handler)
+	app.Replay = handler
+	if app.Devices != nil {
+		handler = authMiddleware(app.Devices, cfg.TrustLoopback, handler)
+	}
+	handler = loggingMiddleware(requestLogs, app.Metrics, cfg.LogBodies, handler)
+	access := newAccessList(allow, proxies)
+	handler = accessMiddleware(access, app.Metrics, handler)
+
+	listeners, err := listen(cfg.Addr, cfg.BindInterface)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: handler, TLSConfig: tlsConfig}
+	// Event streams never go idle; end them so Shutdown can drain.
+	srv.RegisterOnShutdown(app.Events.Close)
+	served := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			if tlsConfig != nil {
+				served <- srv.ServeTLS(ln, "", "")
+			} else {
+				served <- srv.Serve(ln)
+			}
+		}(ln)
+		log.Printf("clipboard server listening on %s", ln.Addr())
+	}
+	log.Printf("accepting clients from %s", joinNetworks(allow))
 	for _, u := range serverURLs {
 		log.Printf("open from phone: %s", u)
 	}
 	if len(serverURLs) == 0 {
-		log.Printf("no LAN IPs found; use 127.0.0.1:%s on this machine only", port)
+		log.Printf("no LAN IPs found; use %s://127.0.0.1:%s on this machine only", scheme, port)
+	}
+	if fingerprint != "" {
+		log.Printf("TLS certificate SHA-256 fingerprint: %s", fingerprint)
+		log.Printf("connect clients with: client -server %s://<ip>:%s -fingerprint %s", scheme, port, fingerprint)
+	}
+	if app.Pairing != nil {
+		app.Pairing.Code()
+		log.Printf("pair a device: enter the code in the web UI, or run: client -pair <code>")
+	} else {
+		log.Printf("warning: auth disabled; anyone on the network can read and write the clipboard")
+	}
+	if cfg.MDNS {
+		background(func() { advertise(ctx, port, fingerprint, app.Devices != nil) })
+	}
+	if cfg.Ready != nil {
+		close(cfg.Ready)
+	}
+
+serve:
+	for {
+		select {
+		case err := <-served:
+			srv.Close()
+			return err
+		case next := <-cfg.Reload:
+			next.BindInterface = cfg.BindInterface
+			if err := reload(next, app, access, limits); err != nil {
+				log.Printf("reload: %v; keeping the previous settings", err)
+			}
+		case <-ctx.Done():
+			break serve
+		}
+	}
+	log.Printf("shutting down: finishing requests in flight")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	for range listeners {
+		<-served // http.ErrServerClosed
+	}
+	return nil
+}
+
+// listen binds addr or, with iface set, addr's port on each address of iface.
+func listen(addr, iface string) ([]net.Listener, error) {
+	if iface == "" {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host != "" {
+		return nil, fmt.Errorf("listen address %s names a host; with a bind interface give only the port (e.g. :8080)", addr)
+	}
+	ips, err := InterfaceIPs(iface)
+	if err != nil {
+		return nil, err
+	}
+	var listeners []net.Listener
+	for _, ip := range ips {
+		ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), port))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+func joinNetworks(networks []netip.Prefix) string {
+	s := make([]string, len(networks))
+	for i, p := range networks {
+		s[i] = p.String()
 	}
-	log.Fatal(http.ListenAndServe(cfg.Addr, handler))
+	return strings.Join(s, ", ")
 }
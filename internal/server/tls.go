@@ -0,0 +1,104 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	certFileName = "local-clipboard-cert.pem"
+	keyFileName  = "local-clipboard-key.pem"
+	certValidity = 10 * 365 * 24 * time.Hour
+)
+
+// CertPaths returns where the self-signed certificate and key are kept: next to the database.
+func CertPaths(dbPath string) (certFile, keyFile string) {
+	dir := filepath.Dir(dbPath)
+	return filepath.Join(dir, certFileName), filepath.Join(dir, keyFileName)
+}
+
+// EnsureCertificate loads the self-signed TLS certificate stored next to dbPath,
+// generating and persisting an ECDSA P-256 one on first use. It returns the
+// certificate and its SHA-256 fingerprint (see Fingerprint).
+func EnsureCertificate(dbPath string) (tls.Certificate, string, error) {
+	certFile, keyFile := CertPaths(dbPath)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := generateCertificate(certFile, keyFile); err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("generate certificate: %w", err)
+		}
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	}
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	return cert, Fingerprint(cert.Certificate[0]), nil
+}
+
+// Fingerprint formats the SHA-256 of a DER certificate as colon-separated hex (AB:CD:...).
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func generateCertificate(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "local-clipboard", Organization: []string{"local-clipboard"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host != "" {
+		tmpl.DNSNames = append(tmpl.DNSNames, host, host+".local")
+	}
+	for _, ip := range LocalIPs() {
+		tmpl.IPAddresses = append(tmpl.IPAddresses, net.ParseIP(ip))
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureCertificatePersists(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "clipboard.db")
+	cert, fp, err := EnsureCertificate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp != Fingerprint(cert.Certificate[0]) || len(fp) != 95 {
+		t.Fatalf("unexpected fingerprint %q", fp)
+	}
+	_, again, err := EnsureCertificate(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != fp {
+		t.Fatal("certificate was regenerated instead of reused")
+	}
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+const (
+	brokerBacklog    = 256 // events kept for Last-Event-ID resume
+	subscriberBuffer = 16
+)
+
+// Broker fans out clipboard events to subscribers and keeps a short backlog
+// so reconnecting clients can resume from their last seen event id.
+type Broker struct {
+	mu      sync.Mutex
+	start   int64 // seq before the first event
+	seq     int64
+	backlog []models.Event
+	subs    map[chan models.Event]struct{}
+	closed  bool
+}
+
+// NewBroker returns an empty Broker. Event ids start from the current time in
+// microseconds rather than 1, so they keep growing across server restarts and
+// an id a client kept from an earlier run is never taken for a recent one.
+func NewBroker() *Broker {
+	now := time.Now().UnixMicro()
+	return &Broker{start: now, seq: now, subs: make(map[chan models.Event]struct{})}
+}
+
+// Publish assigns the next event id and delivers the event to all subscribers.
+// A subscriber whose buffer is full is dropped (its channel is closed) so it
+// reconnects and resumes from the backlog instead of blocking publishers.
+func (b *Broker) Publish(typ string, entry models.ClipboardUpdate) models.Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	ev := models.Event{ID: b.seq, Type: typ, Entry: entry}
+	b.backlog = append(b.backlog, ev)
+	if len(b.backlog) > brokerBacklog {
+		b.backlog = b.backlog[len(b.backlog)-brokerBacklog:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ev
+}
+
+// Subscribe registers a new subscriber. Events newer than afterID that are
+// still in the backlog are returned as missed; afterID <= 0 skips the backlog.
+// The returned cancel func must be called when the subscriber goes away.
+func (b *Broker) Subscribe(afterID int64) (events <-chan models.Event, missed []models.Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if afterID > 0 {
+		for _, ev := range b.backlog {
+			if ev.ID > afterID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	ch := make(chan models.Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, missed, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, missed, cancel
+}
+
+// Close ends every subscription, as if each subscriber had been dropped, and
+// makes later subscriptions end at once. The server calls it on shutdown so
+// event streams, which never go idle, let the HTTP server drain.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Resumes reports whether the backlog holds every event this broker published
+// after afterID, so a subscriber that has seen afterID misses nothing by
+// resuming from it. Ids from before this broker, unknown ids and ids that
+// have left the backlog do not resume.
+func (b *Broker) Resumes(afterID int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if afterID < b.start || afterID > b.seq {
+		return false
+	}
+	return len(b.backlog) == 0 || afterID >= b.backlog[0].ID-1
+}
+
+// LastID returns the id of the most recently published event.
+func (b *Broker) LastID() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
@@ -3,29 +3,74 @@ package store
 import (
 	"local-clipboard/internal/models"
 	"sync"
+	"time"
 )
 
-// Store holds the latest clipboard value in memory.
+// Store holds the latest clipboard value of each channel in memory.
 type Store struct {
+	// Fallback loads the entry a channel falls back to when its latest value
+	// expires or is removed (normally the newest live history entry). Nil leaves
+	// the channel empty.
+	Fallback func(channel string) (models.ClipboardUpdate, error)
+
 	mu     sync.RWMutex
-	latest models.ClipboardUpdate
+	latest map[string]models.ClipboardUpdate
 }
 
 // New returns a new Store.
 func New() *Store {
-	return &Store{}
+	return &Store{latest: make(map[string]models.ClipboardUpdate)}
 }
 
-// Set updates the latest clipboard value.
+// Set updates the latest clipboard value of v's channel.
 func (s *Store) Set(v models.ClipboardUpdate) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.latest = v
+	s.latest[v.ChannelName()] = v
 }
 
-// Get returns the latest clipboard value.
-func (s *Store) Get() models.ClipboardUpdate {
+// Get returns the latest clipboard value of channel. An expired value is
+// replaced by its fallback first.
+func (s *Store) Get(channel string) models.ClipboardUpdate {
+	if channel == "" {
+		channel = models.DefaultChannel
+	}
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.latest
+	v := s.latest[channel]
+	s.mu.RUnlock()
+	if v.ID != 0 && v.Expired(time.Now()) {
+		s.Remove(v.ID)
+		s.mu.RLock()
+		v = s.latest[channel]
+		s.mu.RUnlock()
+	}
+	return v
+}
+
+// Remove drops the entry with the given id wherever it is the latest value; the
+// channel falls back to Fallback's entry, or is left empty.
+func (s *Store) Remove(id int64) {
+	var channels []string
+	s.mu.Lock()
+	for channel, v := range s.latest {
+		if v.ID == id {
+			delete(s.latest, channel)
+			channels = append(channels, channel)
+		}
+	}
+	s.mu.Unlock()
+	if s.Fallback == nil {
+		return
+	}
+	for _, channel := range channels {
+		prev, err := s.Fallback(channel)
+		if err != nil || prev.IsEmpty() || prev.Expired(time.Now()) {
+			continue
+		}
+		s.mu.Lock()
+		if _, ok := s.latest[channel]; !ok { // A value Set meanwhile is newer
+			s.latest[channel] = prev
+		}
+		s.mu.Unlock()
+	}
 }
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"local-clipboard/internal/models"
+)
+
+func TestStoreSetAndGet(t *testing.T) {
+	s := New()
+	s.Set(models.ClipboardUpdate{Text: "hello", Source: "test", Pinned: true})
+	latest := s.Get(models.DefaultChannel)
+	if latest.Text != "hello" || latest.Source != "test" || !latest.Pinned {
+		t.Fatalf("unexpected latest: %+v", latest)
+	}
+	s.Set(models.ClipboardUpdate{Text: "work", Channel: "work"})
+	if got := s.Get("work"); got.Text != "work" {
+		t.Fatalf("unexpected work latest: %+v", got)
+	}
+	if got := s.Get(""); got.Text != "hello" {
+		t.Fatalf("channels are not independent: %+v", got)
+	}
+}
+
+func TestBrokerResumeFromBacklog(t *testing.T) {
+	b := NewBroker()
+	first := b.Publish(models.EventNew, models.ClipboardUpdate{ID: 1, Text: "one"})
+	b.Publish(models.EventPinned, models.ClipboardUpdate{ID: 1, Text: "one", Pinned: true})
+	b.Publish(models.EventDeleted, models.ClipboardUpdate{ID: 1})
+
+	_, missed, cancel := b.Subscribe(first.ID)
+	defer cancel()
+	if len(missed) != 2 || missed[0].Type != models.EventPinned || missed[1].Type != models.EventDeleted {
+		t.Fatalf("unexpected missed events: %+v", missed)
+	}
+}
+
+func TestBrokerResumes(t *testing.T) {
+	b := NewBroker()
+	start := b.LastID()
+	if start <= 0 || b.Resumes(0) {
+		t.Fatalf("fresh broker: LastID %d, Resumes(0) %v", start, b.Resumes(0))
+	}
+	for i := 0; i < brokerBacklog+2; i++ {
+		b.Publish(models.EventNew, models.ClipboardUpdate{ID: int64(i + 1)})
+	}
+	last := b.LastID()
+	for id, want := range map[int64]bool{
+		last:                     true,
+		last - brokerBacklog:     true, // The backlog still holds every later event
+		last - brokerBacklog - 1: false,
+		last + 1:                 false, // From a run that published more
+		start - 1:                false, // From an earlier run
+	} {
+		if got := b.Resumes(id); got != want {
+			t.Errorf("Resumes(last%+d) = %v", id-last, got)
+		}
+	}
+}
+
+func TestBrokerDropsSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	events, _, cancel := b.Subscribe(0)
+	defer cancel()
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(models.EventNew, models.ClipboardUpdate{ID: int64(i + 1)})
+	}
+	n := 0
+	for range events {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("expected %d buffered events before close, got %d", subscriberBuffer, n)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker()
+	events, _, cancel := b.Subscribe(0)
+	defer cancel()
+	b.Close()
+	if _, ok := <-events; ok {
+		t.Fatal("subscription still open after Close")
+	}
+	late, _, cancelLate := b.Subscribe(0)
+	defer cancelLate()
+	if _, ok := <-late; ok {
+		t.Fatal("subscription after Close should end at once")
+	}
+}
+
+func TestStoreFallsBackWhenLatestExpires(t *testing.T) {
+	s := New()
+	prev := models.ClipboardUpdate{ID: 1, Text: "previous"}
+	s.Fallback = func(channel string) (models.ClipboardUpdate, error) { return prev, nil }
+	past := time.Now().Add(-time.Second)
+	s.Set(models.ClipboardUpdate{ID: 2, Text: "gone", ExpiresAt: &past})
+	if got := s.Get(models.DefaultChannel); got.ID != 1 {
+		t.Fatalf("expected fallback to previous entry, got %+v", got)
+	}
+	s.Set(models.ClipboardUpdate{ID: 3, Text: "burn", MaxReads: 1})
+	s.Remove(3)
+	if got := s.Get(models.DefaultChannel); got.ID != 1 {
+		t.Fatalf("expected fallback after Remove, got %+v", got)
+	}
+	s.Fallback = nil
+	s.Remove(1)
+	if got := s.Get(models.DefaultChannel); !got.IsEmpty() {
+		t.Fatalf("expected empty channel, got %+v", got)
+	}
+}
@@ -0,0 +1,7 @@
+// Package version holds the build version reported by server and client.
+package version
+
+// Version is overridden at build time:
+//
+//	go build -ldflags "-X local-clipboard/internal/version.Version=1.2.3"
+var Version = "dev"
@@ -1,76 +1,610 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"local-clipboard/internal/client"
+	"local-clipboard/internal/config"
+	"local-clipboard/internal/export"
+	"local-clipboard/internal/history"
+	"local-clipboard/internal/metrics"
+	"local-clipboard/internal/models"
+	"local-clipboard/internal/sensitive"
 	"local-clipboard/internal/server"
 )
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run . <server|client|run> [flags]")
-		fmt.Println("  server  - run web server only")
-		fmt.Println("  client  - run clipboard client only")
-		fmt.Println("  run     - run server and client in one process (single binary)")
+		fmt.Println("Usage: go run . <server|client|run|discover|devices|prune|export|import|migrate|config> [flags]")
+		fmt.Println("  server   - run web server only")
+		fmt.Println("  client   - run clipboard client only")
+		fmt.Println("  run      - run server and client in one process (single binary)")
+		fmt.Println("  discover - list clipboard servers advertised on the LAN")
+		fmt.Println("  devices  - list clients known to a server and whether they are online")
+		fmt.Println("  prune    - remove history entries outside the retention limits")
+		fmt.Println("  export   - write history as JSONL, CSV or a Markdown report")
+		fmt.Println("  import   - add entries from a JSONL or CSV export to history")
+		fmt.Println("  migrate  - show (status) or apply (up) database schema migrations")
+		fmt.Println("  config   - print the effective settings of server, client and run (show)")
 		os.Exit(1)
 	}
 
+	// SIGINT/SIGTERM cancel ctx; the long-running modes then shut down cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	switch os.Args[1] {
 	case "server":
 		fs := flag.NewFlagSet("server", flag.ExitOnError)
-		addr := fs.String("addr", ":8080", "listen address for the web server")
-		dbPath := fs.String("db", "clipboard.db", "path to sqlite database")
-		staticDir := fs.String("static", "web/dist", "directory containing built Vue app (e.g. web/dist); empty = embedded fallback")
-		noBuild := fs.Bool("no-build", false, "skip automatic Vue build before starting")
-		_ = fs.Parse(os.Args[2:])
-		if p := os.Getenv("PORT"); p != "" {
-			*addr = ":" + p
+		opts := newServerFlags(fs)
+		if _, err := parseFlags(fs, os.Args[2:]); err != nil {
+			log.Fatalf("server: %v", err)
+		}
+		cfg := opts.config()
+		if !opts.noBuild && cfg.StaticDir != "" {
+			buildVue(cfg.StaticDir)
 		}
-		if !*noBuild && *staticDir != "" {
-			buildVue(*staticDir)
+		cfg.Metrics = metricsRegistry(opts.withMetrics)
+		reload := make(chan server.Config, 1)
+		cfg.Reload = reload
+		go reloadOnHangup(ctx, fs, func(next *flag.FlagSet) func() error {
+			opts := newServerFlags(next)
+			return func() error {
+				replacePending(reload, opts.config())
+				return nil
+			}
+		})
+		if err := server.Run(ctx, cfg); err != nil {
+			log.Fatalf("server: %v", err)
 		}
-		server.Run(server.Config{Addr: *addr, DBPath: *dbPath, StaticDir: *staticDir})
 	case "client":
 		fs := flag.NewFlagSet("client", flag.ExitOnError)
-		serverURL := fs.String("server", "http://127.0.0.1:8080", "base URL of clipboard server")
-		interval := fs.Duration("interval", 1*time.Second, "poll interval for local clipboard")
-		source := fs.String("source", client.HostName(), "source label for this machine")
-		_ = fs.Parse(os.Args[2:])
-		client.Run(client.Config{ServerURL: *serverURL, Interval: *interval, Source: *source})
+		opts := newClientFlags(fs)
+		if _, err := parseFlags(fs, os.Args[2:]); err != nil {
+			log.Fatalf("client: %v", err)
+		}
+		cfg, err := opts.config()
+		if err != nil {
+			log.Fatalf("client: %v", err)
+		}
+		reload := make(chan client.Config, 1)
+		cfg.Reload = reload
+		go reloadOnHangup(ctx, fs, func(next *flag.FlagSet) func() error {
+			opts := newClientFlags(next)
+			return func() error {
+				cfg, err := opts.config()
+				if err == nil {
+					replacePending(reload, cfg)
+				}
+				return err
+			}
+		})
+		if err := client.Run(ctx, cfg); err != nil {
+			log.Fatalf("client: %v", err)
+		}
 	case "run":
 		fs := flag.NewFlagSet("run", flag.ExitOnError)
-		addr := fs.String("addr", ":8080", "listen address for the web server")
+		opts := newRunFlags(fs)
+		if _, err := parseFlags(fs, os.Args[2:]); err != nil {
+			log.Fatalf("run: %v", err)
+		}
+		serverCfg := opts.serverConfig()
+		clientCfg, err := opts.clientConfig()
+		if err != nil {
+			log.Fatalf("client: %v", err)
+		}
+		if !opts.noBuild && serverCfg.StaticDir != "" {
+			buildVue(serverCfg.StaticDir)
+		}
+		port := server.PortFromAddr(serverCfg.Addr)
+		clientCfg.ServerURL = "http://127.0.0.1:" + port
+		if serverCfg.TLS {
+			// Create the certificate up front so the in-process client can pin it.
+			_, fp, err := server.EnsureCertificate(serverCfg.DBPath)
+			if err != nil {
+				log.Fatalf("failed to set up TLS certificate: %v", err)
+			}
+			clientCfg.ServerURL = "https://127.0.0.1:" + port
+			clientCfg.Fingerprint = fp
+		}
+		reg := metricsRegistry(opts.withMetrics)
+		serverCfg.Metrics, clientCfg.Metrics = reg, reg
+		serverReload, clientReload := make(chan server.Config, 1), make(chan client.Config, 1)
+		serverCfg.Reload, clientCfg.Reload = serverReload, clientReload
+		go reloadOnHangup(ctx, fs, func(next *flag.FlagSet) func() error {
+			opts := newRunFlags(next)
+			return func() error {
+				cfg, err := opts.clientConfig()
+				if err == nil {
+					replacePending(serverReload, opts.serverConfig())
+					replacePending(clientReload, cfg)
+				}
+				return err
+			}
+		})
+		// The server outlives the client so the client's last push on shutdown still lands.
+		serverCtx, stopServer := context.WithCancel(context.Background())
+		defer stopServer()
+		ready := make(chan struct{})
+		serverCfg.Ready = ready
+		served := make(chan error, 1)
+		go func() {
+			served <- server.Run(serverCtx, serverCfg)
+		}()
+		select {
+		case <-ready:
+		case err := <-served:
+			log.Fatalf("server: %v", err)
+		case <-ctx.Done():
+			stopServer()
+			if err := <-served; err != nil {
+				log.Fatalf("server: %v", err)
+			}
+			return
+		}
+		log.Printf("running server + client (client -> %s)", clientCfg.ServerURL)
+		clientErr := client.Run(ctx, clientCfg)
+		stopServer()
+		serverErr := <-served
+		if clientErr != nil {
+			log.Fatalf("client: %v", clientErr)
+		}
+		if serverErr != nil {
+			log.Fatalf("server: %v", serverErr)
+		}
+	case "discover":
+		fs := flag.NewFlagSet("discover", flag.ExitOnError)
+		wait := fs.Duration("wait", 2*time.Second, "how long to wait for answers")
+		_ = fs.Parse(os.Args[2:])
+		services, err := client.Discover(ctx, *wait)
+		if err != nil {
+			log.Fatalf("discover: %v", err)
+		}
+		if len(services) == 0 {
+			fmt.Println("no clipboard servers found")
+			os.Exit(1)
+		}
+		for _, s := range services {
+			fmt.Printf("%s\n  url:         %s\n  version:     %s\n", s.Instance, s.URL(), s.TXT["version"])
+			if fp := s.TXT["fp"]; fp != "" {
+				fmt.Printf("  fingerprint: %s\n", fp)
+			}
+		}
+	case "devices":
+		fs := flag.NewFlagSet("devices", flag.ExitOnError)
+		serverURL := fs.String("server", "http://127.0.0.1:8080", "base URL of clipboard server, or \"auto\" to find it over mDNS")
+		token := fs.String("token", "", "device token (default: the token saved for this server)")
+		tokenFile := fs.String("token-file", client.DefaultTokenFile(), "file where paired device tokens are saved")
+		fingerprint := fs.String("fingerprint", "", "SHA-256 fingerprint of the server's TLS certificate to pin")
+		_ = fs.Parse(os.Args[2:])
+		devices, err := client.ListDevices(ctx, client.Config{ServerURL: *serverURL, Token: *token, TokenFile: *tokenFile, Fingerprint: *fingerprint})
+		if err != nil {
+			log.Fatalf("devices: %v", err)
+		}
+		for _, d := range devices {
+			state := "offline"
+			if d.Online {
+				state = "online"
+			}
+			fmt.Printf("%-7s  %-20s  %-15s  %-8s  %-10s  #%s  last seen %s\n", state, d.Name, d.IP, d.Version, d.Backend, d.Channel, d.LastSeen.Local().Format("2006-01-02 15:04:05"))
+		}
+	case "prune":
+		fs := flag.NewFlagSet("prune", flag.ExitOnError)
+		dbPath := fs.String("db", "clipboard.db", "path to sqlite database")
+		retention := retentionFlags(fs)
+		dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+		_ = fs.Parse(os.Args[2:])
+		if !retention.Enabled() {
+			log.Fatal("prune: set at least one of -max-entries, -max-age or -max-bytes")
+		}
+		h := history.NewDB(*dbPath)
+		if err := h.Init(); err != nil {
+			log.Fatalf("prune: open database: %v", err)
+		}
+		defer h.Close()
+		res, err := h.Prune(*retention, *dryRun)
+		if err != nil {
+			log.Fatalf("prune: %v", err)
+		}
+		if *dryRun {
+			fmt.Printf("would remove %s\n", res)
+		} else {
+			fmt.Printf("removed %s\n", res)
+		}
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		dbPath := fs.String("db", "clipboard.db", "path to sqlite database")
+		out := fs.String("o", "-", "output file (- for stdout)")
+		formatName := fs.String("format", "", "jsonl (lossless), csv or markdown (default: from the -o extension, else jsonl)")
+		channel := fs.String("channel", "", "only export this channel (default: all channels)")
+		includeSensitive := fs.Bool("include-sensitive", false, "also export entries flagged as sensitive")
+		_ = fs.Parse(os.Args[2:])
+		format, err := export.ParseFormat(*formatName)
+		if err != nil {
+			log.Fatalf("export: %v", err)
+		}
+		if f, ok := export.FormatFromPath(*out); ok && *formatName == "" {
+			format = f
+		}
+		h := history.NewDB(*dbPath)
+		if err := h.Init(); err != nil {
+			log.Fatalf("export: open database: %v", err)
+		}
+		defer h.Close()
+		w := os.Stdout
+		if *out != "-" {
+			if w, err = os.Create(*out); err != nil {
+				log.Fatalf("export: %v", err)
+			}
+		}
+		ew := export.NewWriter(w, format)
+		n := 0
+		err = h.Export(history.ExportQuery{Channel: *channel, IncludeSensitive: *includeSensitive, WithData: format.Lossless()}, func(e models.ClipboardUpdate, data []byte) error {
+			n++
+			return ew.Write(e, data)
+		})
+		if err == nil {
+			err = ew.Close()
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			log.Fatalf("export: %v", err)
+		}
+		log.Printf("exported %d entries", n)
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
 		dbPath := fs.String("db", "clipboard.db", "path to sqlite database")
-		staticDir := fs.String("static", "web/dist", "directory containing built Vue app; empty = embedded fallback")
-		noBuild := fs.Bool("no-build", false, "skip automatic Vue build before starting")
-		interval := fs.Duration("interval", 1*time.Second, "poll interval for local clipboard")
-		source := fs.String("source", client.HostName(), "source label for this machine")
+		formatName := fs.String("format", "", "jsonl or csv (default: from the file extension, else jsonl)")
+		sources := sourceMap{}
+		fs.Var(sources, "map-source", "rename a source while importing, as old=new (repeatable)")
 		_ = fs.Parse(os.Args[2:])
-		if p := os.Getenv("PORT"); p != "" {
-			*addr = ":" + p
-		}
-		if !*noBuild && *staticDir != "" {
-			buildVue(*staticDir)
-		}
-		port := server.PortFromAddr(*addr)
-		clientURL := "http://127.0.0.1:" + port
-		go server.Run(server.Config{Addr: *addr, DBPath: *dbPath, StaticDir: *staticDir})
-		time.Sleep(400 * time.Millisecond)
-		log.Printf("running server + client (client -> %s)", clientURL)
-		client.Run(client.Config{ServerURL: clientURL, Interval: *interval, Source: *source})
+		if fs.NArg() != 1 {
+			log.Fatal("usage: import [flags] <file | ->")
+		}
+		path := fs.Arg(0)
+		format, err := export.ParseFormat(*formatName)
+		if err != nil {
+			log.Fatalf("import: %v", err)
+		}
+		if f, ok := export.FormatFromPath(path); ok && *formatName == "" {
+			format = f
+		}
+		in := os.Stdin
+		if path != "-" {
+			if in, err = os.Open(path); err != nil {
+				log.Fatalf("import: %v", err)
+			}
+			defer in.Close()
+		}
+		r, err := export.NewReader(in, format)
+		if err != nil {
+			log.Fatalf("import: %v", err)
+		}
+		h := history.NewDB(*dbPath)
+		if err := h.Init(); err != nil {
+			log.Fatalf("import: open database: %v", err)
+		}
+		defer h.Close()
+		res, err := h.Import(func() (models.ClipboardUpdate, []byte, error) {
+			e, data, err := r.Next()
+			if to, ok := sources[e.Source]; ok {
+				e.Source = to
+			}
+			return e, data, err
+		})
+		if err != nil {
+			log.Fatalf("import: %v (nothing was imported)", err)
+		}
+		fmt.Printf("imported %d entries, skipped %d (already in history, expired, or without payload)\n", res.Imported, res.Skipped)
+	case "migrate":
+		fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+		dbPath := fs.String("db", "clipboard.db", "path to sqlite database")
+		_ = fs.Parse(os.Args[2:])
+		switch fs.Arg(0) {
+		case "status":
+			status, err := history.MigrationStatus(*dbPath)
+			if err != nil {
+				log.Fatalf("migrate: %v", err)
+			}
+			version, pending := 0, 0
+			for _, m := range status {
+				state := "pending"
+				if !m.AppliedAt.IsZero() {
+					state = "applied " + m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+					version = max(version, m.Version)
+				} else {
+					pending++
+				}
+				if m.Unknown {
+					state += " (unknown to this version)"
+				}
+				fmt.Printf("%3d  %-50s  %s\n", m.Version, m.Name, state)
+			}
+			fmt.Printf("schema version %d, this binary supports %d; %d pending\n", version, history.LatestVersion(), pending)
+		case "up":
+			applied, err := history.Migrate(*dbPath)
+			for _, m := range applied {
+				fmt.Printf("applied %3d  %s\n", m.Version, m.Name)
+			}
+			if err != nil {
+				log.Fatalf("migrate: %v", err)
+			}
+			fmt.Printf("schema is at version %d\n", history.LatestVersion())
+		default:
+			log.Fatal("usage: migrate [-db path] status|up")
+		}
+	case "config":
+		fs := flag.NewFlagSet("config", flag.ExitOnError)
+		path := fs.String(config.FileFlag, "", "config file to show (default: the one the other modes would read)")
+		_ = fs.Parse(os.Args[2:])
+		modes := fs.Args()
+		if len(modes) == 0 || modes[0] != "show" {
+			log.Fatal("usage: config [-config path] show [server|client|run]")
+		}
+		if modes = modes[1:]; len(modes) == 0 {
+			modes = configModes
+		}
+		var args []string
+		if *path != "" {
+			args = []string{"-" + config.FileFlag, *path}
+		}
+		for i, mode := range modes {
+			if !slices.Contains(configModes, mode) {
+				log.Fatalf("config: unknown mode %q, expected server, client or run", mode)
+			}
+			mfs := newModeFlags(mode)
+			res, err := parseFlags(mfs, args)
+			if err != nil {
+				log.Fatalf("config: %v", err)
+			}
+			if i == 0 {
+				if res.File.Path != "" {
+					fmt.Printf("# config file: %s\n", res.File.Path)
+				} else {
+					fmt.Printf("# no config file (looked for %s)\n", config.DefaultPath())
+				}
+			}
+			fmt.Println()
+			if err := res.WriteTOML(os.Stdout, mfs, secretFlags); err != nil {
+				log.Fatalf("config: %v", err)
+			}
+		}
 	default:
-		fmt.Printf("unknown mode %q, expected server, client, or run\n", os.Args[1])
+		fmt.Printf("unknown mode %q, expected server, client, run, discover, devices, prune, export, import, migrate, or config\n", os.Args[1])
 		os.Exit(1)
 	}
 }
 
+// retentionFlags registers the history retention limits on fs.
+func retentionFlags(fs *flag.FlagSet) *history.Retention {
+	r := &history.Retention{}
+	fs.IntVar(&r.MaxEntries, "max-entries", 0, "keep at most this many history entries (0 = unlimited; pinned entries are always kept)")
+	fs.DurationVar(&r.MaxAge, "max-age", 0, "remove history entries older than this, e.g. 720h (0 = keep forever)")
+	fs.Var((*byteSize)(&r.MaxBytes), "max-bytes", "cap the total size of history entries, e.g. 500MB (0 = unlimited)")
+	return r
+}
+
+// requestLogOptions are the request log flags shared by server and run.
+type requestLogOptions struct {
+	persist   bool
+	retention time.Duration
+	bodies    bool
+}
+
+// requestLogFlags registers the request log flags on fs.
+func requestLogFlags(fs *flag.FlagSet) *requestLogOptions {
+	o := &requestLogOptions{}
+	fs.BoolVar(&o.persist, "persist-logs", false, "keep the request log in the database instead of the last 500 requests in memory")
+	fs.DurationVar(&o.retention, "log-retention", 7*24*time.Hour, "remove persisted request logs older than this (0 = keep forever)")
+	fs.BoolVar(&o.bodies, "log-bodies", false, "keep clipboard text in logged request and response bodies instead of masking it")
+	return o
+}
+
+// limitFlags registers the rate and request body limits on fs, starting from
+// server.DefaultLimits.
+func limitFlags(fs *flag.FlagSet) *server.Limits {
+	l := server.DefaultLimits()
+	fs.Float64Var(&l.ReadRate, "read-rate", l.ReadRate, "GET requests per second allowed per client (0 = unlimited)")
+	fs.IntVar(&l.ReadBurst, "read-burst", l.ReadBurst, "GET requests a client may make at once before -read-rate applies")
+	fs.Float64Var(&l.WriteRate, "write-rate", l.WriteRate, "POST and other write requests per second allowed per client (0 = unlimited)")
+	fs.IntVar(&l.WriteBurst, "write-burst", l.WriteBurst, "write requests a client may make at once before -write-rate applies")
+	fs.Var((*byteSize)(&l.MaxBody), "max-body", "request body limit for API routes without their own, e.g. 64KB (0 = unlimited)")
+	fs.Var(routeSizes(l.MaxBodyByPath), "max-body-route", "request body limit of one API route as path=size, e.g. /api/clipboard/blob=50MB (repeat for several; defaults: /api/clipboard=1MB, /api/clipboard/blob=20MB)")
+	return &l
+}
+
+// routeSizes is a flag.Value setting body limits by API path from path=size.
+type routeSizes map[string]int64
+
+func (m routeSizes) String() string { return strings.Join(m.Get().([]string), ",") }
+
+// Get returns the limits as path=size, sorted by path.
+func (m routeSizes) Get() any {
+	pairs := []string{}
+	for path, n := range m {
+		pairs = append(pairs, path+"="+strconv.FormatInt(n, 10))
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func (m routeSizes) Set(s string) error {
+	path, size, ok := strings.Cut(s, "=")
+	path = strings.TrimSpace(path)
+	if !ok || !strings.HasPrefix(path, "/api/") {
+		return fmt.Errorf("expected /api/path=size, got %q", s)
+	}
+	var n byteSize
+	if err := n.Set(size); err != nil {
+		return err
+	}
+	m[path] = int64(n)
+	return nil
+}
+
+// accessOptions are the network access flags shared by server and run.
+type accessOptions struct {
+	allow   listFlag
+	proxies listFlag
+}
+
+// accessFlags registers -allow and -trusted-proxy on fs; both may be repeated
+// or comma-separated, and are checked by server.Run.
+func accessFlags(fs *flag.FlagSet) *accessOptions {
+	o := &accessOptions{}
+	fs.Var(&o.allow, "allow", "networks clients may connect from: addresses, CIDRs, or lan, private, loopback, any (repeat or comma-separate; default lan)")
+	fs.Var(&o.proxies, "trusted-proxy", "reverse proxy addresses or CIDRs whose X-Forwarded-For header names the real client (repeat or comma-separate)")
+	return o
+}
+
+// metricsRegistry returns a registry for /metrics, or nil when metrics are off.
+func metricsRegistry(enabled bool) *metrics.Registry {
+	if !enabled {
+		return nil
+	}
+	return metrics.NewRegistry()
+}
+
+// sensitiveFlag registers -sensitive on fs, defaulting to sensitive.ActionExpire.
+func sensitiveFlag(fs *flag.FlagSet, usage string) *sensitive.Action {
+	action := sensitive.ActionExpire
+	fs.Var((*actionFlag)(&action), "sensitive", usage+": off, refuse, expire (store with a short TTL) or mask")
+	return &action
+}
+
+// actionFlag is a flag.Value for a sensitive.Action.
+type actionFlag sensitive.Action
+
+func (a *actionFlag) String() string { return string(*a) }
+
+func (a *actionFlag) Set(s string) error {
+	action, err := sensitive.ParseAction(s)
+	*a = actionFlag(action)
+	return err
+}
+
+// tagFlag registers -tag on fs; it may be repeated or hold comma-separated tags.
+func tagFlag(fs *flag.FlagSet) *listFlag {
+	tags := &listFlag{normalize: func(t string) (string, error) {
+		tag, err := history.NormalizeTag(t)
+		if err != nil {
+			return "", fmt.Errorf("%q: %w", t, err)
+		}
+		return tag, nil
+	}}
+	fs.Var(tags, "tag", "tag added to every entry this client sends (repeat or comma-separate for several)")
+	return tags
+}
+
+// listFlag is a flag.Value collecting values that may be repeated or
+// comma-separated. normalize, when set, checks and rewrites each value.
+type listFlag struct {
+	values    []string
+	normalize func(string) (string, error)
+}
+
+func (l *listFlag) String() string { return strings.Join(l.values, ",") }
+
+func (l *listFlag) Get() any { return l.values }
+
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if l.normalize != nil {
+			var err error
+			if v, err = l.normalize(v); err != nil {
+				return err
+			}
+		}
+		l.values = append(l.values, v)
+	}
+	return nil
+}
+
+// sourceMap is a flag.Value collecting old=new source renames.
+type sourceMap map[string]string
+
+func (m sourceMap) String() string {
+	var pairs []string
+	for from, to := range m {
+		pairs = append(pairs, from+"="+to)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m sourceMap) Set(s string) error {
+	from, to, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+		return fmt.Errorf("want old=new, got %q", s)
+	}
+	m[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	return nil
+}
+
+// byteSize is a flag.Value for sizes like 1048576, 512KB, 500MB or 2GB.
+type byteSize int64
+
+func (b *byteSize) String() string { return strconv.FormatInt(int64(*b), 10) }
+
+func (b *byteSize) Get() any { return int64(*b) }
+
+func (b *byteSize) Set(s string) error {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(n * mult)
+	return nil
+}
+
+// passphraseEnv and channelTokenEnv hold secrets when no file is given. A flag
+// would expose them in the process list, so there is no -e2e-passphrase or -channel-token.
+const (
+	passphraseEnv   = "LOCAL_CLIPBOARD_PASSPHRASE"
+	channelTokenEnv = "LOCAL_CLIPBOARD_CHANNEL_TOKEN"
+)
+
+// readSecret returns a secret from file (first line) or, without a file, from the env variable.
+func readSecret(file, env string) (string, error) {
+	if file == "" {
+		return os.Getenv(env), nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	line, _, _ := strings.Cut(string(b), "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
 // buildVue runs "npm run build" in the web directory (parent of staticDir, e.g. web).
 // On failure, logs a warning and returns so the server can still start with embedded fallback.
 func buildVue(staticDir string) {
@@ -1,7 +1,21 @@
-const API = '/api'
+/** Channel selected by the page URL (?channel=work); empty means the server's default channel. */
+export const CHANNEL = new URLSearchParams(window.location.search).get('channel') || ''
+
+// Channel-scoped requests go through /api/channels/<name>/..., which also works for EventSource and <img>.
+const API = CHANNEL ? `/api/channels/${encodeURIComponent(CHANNEL)}` : '/api'
+
+/** Fired on window when the server answers 401 (this browser is not paired). */
+export const AUTH_REQUIRED_EVENT = 'auth-required'
+
+/** fetch wrapper that signals AUTH_REQUIRED_EVENT on 401; the token itself travels as an HttpOnly cookie. */
+async function apiFetch(url, opts) {
+  const res = await fetch(url, opts)
+  if (res.status === 401) window.dispatchEvent(new CustomEvent(AUTH_REQUIRED_EVENT))
+  return res
+}
 
 export async function getClipboard() {
-  const res = await fetch(`${API}/clipboard`, { cache: 'no-store' })
+  const res = await apiFetch(`${API}/clipboard`, { cache: 'no-store' })
   if (!res.ok) {
     if (res.status === 404) return null
     throw new Error(res.statusText)
@@ -9,6 +23,24 @@ export async function getClipboard() {
   return res.json()
 }
 
+/**
+ * Subscribe to clipboard change events (Server-Sent Events).
+ * handlers maps event type ("new", "pinned", "deleted") to a callback receiving the entry.
+ * Returns a close function, or null when EventSource is unavailable.
+ */
+export function subscribeEvents(handlers) {
+  if (typeof EventSource === 'undefined') return null
+  const es = new EventSource(`${API}/events`)
+  for (const [type, fn] of Object.entries(handlers)) {
+    es.addEventListener(type, (e) => {
+      let entry = null
+      try { entry = JSON.parse(e.data) } catch { /* ignore malformed event */ }
+      fn(entry)
+    })
+  }
+  return () => es.close()
+}
+
 /** Normalize line endings for multi-line text (iOS can use \r, \r\n, or Unicode separators). */
 function normalizeLineEndings(s) {
   if (typeof s !== 'string') return s
@@ -19,12 +51,16 @@ function normalizeLineEndings(s) {
     .replace(/\u2029/g, '\n')
 }
 
-export async function postClipboard(text, source = 'web') {
+/**
+ * Send text to the clipboard. opts may set expires_in (duration such as "10m")
+ * and max_reads (entry disappears after that many reads).
+ */
+export async function postClipboard(text, source = 'web', opts = {}) {
   const normalized = normalizeLineEndings(text).trim()
   const tryJson = async () => {
-    const payload = JSON.stringify({ text: normalized, source })
+    const payload = JSON.stringify({ text: normalized, source, ...opts })
     const body = new Blob([payload], { type: 'application/json; charset=utf-8' })
-    const res = await fetch(`${API}/clipboard`, {
+    const res = await apiFetch(`${API}/clipboard`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json; charset=utf-8' },
       body,
@@ -39,7 +75,8 @@ export async function postClipboard(text, source = 'web') {
     const body = new URLSearchParams()
     body.set('text', normalized)
     body.set('source', source)
-    const res = await fetch(`${API}/clipboard`, {
+    for (const [k, v] of Object.entries(opts)) body.set(k, String(v))
+    const res = await apiFetch(`${API}/clipboard`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/x-www-form-urlencoded; charset=utf-8' },
       body: body.toString(),
@@ -61,16 +98,34 @@ export async function postClipboard(text, source = 'web') {
   }
 }
 
-export async function getHistory(limit = 80, search = '') {
+/** URL of a binary entry's payload (images etc.), usable as <img src>. */
+export function blobUrl(id) {
+  return `${API}/clipboard/blob?id=${encodeURIComponent(id)}`
+}
+
+/** True when the entry carries a binary payload instead of text. */
+export function isBlob(item) {
+  return !!item?.mime_type && !item.mime_type.startsWith('text/')
+}
+
+/**
+ * One page of history: { items, next_cursor, total }. Pass next_cursor back as
+ * cursor for the following page; filters are source, tag, pinned, since, until, min_size, max_size.
+ */
+export async function getHistory(limit = 80, search = '', cursor = '', filters = {}) {
   const params = new URLSearchParams({ limit: String(limit) })
   if (search) params.set('q', search)
-  const res = await fetch(`${API}/history?${params}`, { cache: 'no-store' })
+  if (cursor) params.set('cursor', cursor)
+  for (const [k, v] of Object.entries(filters)) {
+    if (v !== undefined && v !== null && v !== '') params.set(k, String(v))
+  }
+  const res = await apiFetch(`${API}/history?${params}`, { cache: 'no-store' })
   if (!res.ok) throw new Error(res.statusText)
   return res.json()
 }
 
 export async function setPin(id, pinned) {
-  const res = await fetch(`${API}/history/pin`, {
+  const res = await apiFetch(`${API}/history/pin`, {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify({ id, pinned }),
@@ -79,8 +134,29 @@ export async function setPin(id, pinned) {
   return res.json()
 }
 
+/** Tags of the channel with their entry counts: [{ name, count }], most used first. */
+export async function getTags() {
+  const res = await apiFetch(`${API}/history/tags`, { cache: 'no-store' })
+  if (!res.ok) throw new Error(res.statusText)
+  return res.json()
+}
+
+/** Add and remove tags of an entry; returns the updated entry. */
+export async function updateTags(id, add = [], remove = []) {
+  const res = await apiFetch(`${API}/history/tags`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ id, add, remove }),
+  })
+  if (!res.ok) {
+    const msg = await res.text()
+    throw new Error(msg.trim() || res.statusText)
+  }
+  return res.json()
+}
+
 export async function deleteHistory(id) {
-  const res = await fetch(`${API}/history/delete`, {
+  const res = await apiFetch(`${API}/history/delete`, {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify({ id }),
@@ -88,15 +164,74 @@ export async function deleteHistory(id) {
   if (!res.ok) throw new Error(res.statusText)
 }
 
-export async function getLogs() {
-  const res = await fetch(`${API}/logs`, { cache: 'no-store' })
+/**
+ * One page of request logs, newest first: { items, next_cursor, total }. Filters
+ * are method, path (prefix), status (404 or 4xx), remote, since, until and q (search).
+ */
+export async function getLogs(cursor = '', filters = {}) {
+  const params = new URLSearchParams()
+  if (cursor) params.set('cursor', cursor)
+  for (const [k, v] of Object.entries(filters)) {
+    if (v !== undefined && v !== null && v !== '') params.set(k, String(v))
+  }
+  const res = await apiFetch(`${API}/logs?${params}`, { cache: 'no-store' })
+  if (!res.ok) throw new Error(res.statusText)
+  return res.json()
+}
+
+/** URL that downloads the request logs matching filters as a HAR 1.2 file. */
+export function logsExportUrl(filters = {}) {
+  const params = new URLSearchParams({ format: 'har' })
+  for (const [k, v] of Object.entries(filters)) {
+    if (v !== undefined && v !== null && v !== '') params.set(k, String(v))
+  }
+  return `${API}/logs/export?${params}`
+}
+
+/**
+ * Send a logged request again; returns { original, replay } where replay has
+ * status, headers, body, size and duration_ms of the new response.
+ */
+export async function replayLog(id) {
+  const res = await apiFetch(`${API}/logs/${encodeURIComponent(id)}/replay`, { method: 'POST' })
+  if (!res.ok) {
+    const msg = await res.text()
+    throw new Error(msg.trim() || res.statusText)
+  }
+  return res.json()
+}
+
+/** Exchange a pairing code (shown in the server log) for a device token cookie. */
+export async function pairDevice(code, name) {
+  const res = await fetch(`${API}/pair`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ code, name }),
+  })
+  if (!res.ok) {
+    const msg = await res.text()
+    throw new Error(msg.trim() || res.statusText)
+  }
+  return res.json()
+}
+
+/** Channels known to the server: [{ name, protected, created_at }]. */
+export async function getChannels() {
+  const res = await apiFetch('/api/channels', { cache: 'no-store' })
+  if (!res.ok) throw new Error(res.statusText)
+  return res.json()
+}
+
+/** Clients known to the server: [{ id, name, ip, version, backend, channel, last_seen, online }]. */
+export async function getDevices() {
+  const res = await apiFetch('/api/devices', { cache: 'no-store' })
   if (!res.ok) throw new Error(res.statusText)
   return res.json()
 }
 
 /** Server LAN URLs (e.g. http://192.168.1.5:8080) for opening from phone. */
 export async function getServerInfo() {
-  const res = await fetch(`${API}/server-info`, { cache: 'no-store' })
+  const res = await apiFetch(`${API}/server-info`, { cache: 'no-store' })
   if (!res.ok) return { urls: [] }
   return res.json()
 }
@@ -5,3 +5,4 @@ export { default as LogsPage } from './LogsPage.vue'
 export { default as LogDetailOverlay } from './LogDetailOverlay.vue'
 export { default as ToastContainer } from './ToastContainer.vue'
 export { default as ShortcutsModal } from './ShortcutsModal.vue'
+export { default as PairModal } from './PairModal.vue'
@@ -1,16 +1,27 @@
 import { ref, onMounted, onUnmounted } from 'vue'
-import { getClipboard, postClipboard } from '../api.js'
+import { getClipboard, postClipboard, subscribeEvents } from '../api.js'
 import { normalizeLineEndings } from '../utils/text.js'
 
+/** Lifetimes offered for sent text, mapped to postClipboard options. */
+export const LIFETIMES = {
+  '': {},
+  '10m': { expires_in: '10m' },
+  '1h': { expires_in: '1h' },
+  '24h': { expires_in: '24h' },
+  once: { max_reads: 1, expires_in: '24h' },
+}
+
 export function useClipboard(showToast) {
   const inputText = ref('')
   const sending = ref(false)
   const sendStatus = ref('')
   const sendError = ref(false)
+  const lifetime = ref('')
   const latest = ref(null)
   const latestLoading = ref(true)
   const latestUpdated = ref(false)
   let latestTimer = null
+  let closeEvents = null
   let latestUpdatedTimeout = null
 
   /** @param {boolean} [skipHistoryRefresh] - true when we're about to refresh history ourselves (e.g. after send from this tab) */
@@ -18,9 +29,9 @@ export function useClipboard(showToast) {
     latestLoading.value = true
     try {
       const data = await getClipboard()
-      const hadText = latest.value?.text
+      const hadID = latest.value?.id
       latest.value = data
-      if (data?.text && data.text !== hadText) {
+      if (data?.id && data.id !== hadID) {
         latestUpdated.value = true
         clearTimeout(latestUpdatedTimeout)
         latestUpdatedTimeout = setTimeout(() => { latestUpdated.value = false }, 2000)
@@ -46,11 +57,13 @@ export function useClipboard(showToast) {
     sendStatus.value = ''
     sendError.value = false
     try {
-      await postClipboard(text, 'web')
+      const entry = await postClipboard(text, 'web', LIFETIMES[lifetime.value] || {})
       sendStatus.value = 'Saved.'
       showToast('Sent to clipboard', 'success')
       inputText.value = ''
-      await loadLatest(true)
+      // Reading a burn-after-read entry back would use up one of its reads.
+      if (entry?.max_reads) latest.value = { ...entry, text: '' }
+      else await loadLatest(true)
       if (loadHistoryRef) await loadHistoryRef()
     } catch (e) {
       sendStatus.value = 'Failed: ' + (e.message || 'network error')
@@ -127,10 +140,22 @@ export function useClipboard(showToast) {
 
   onMounted(() => {
     loadLatest()
-    latestTimer = setInterval(loadLatest, 3500)
+    // Server pushes changes over /api/events; fall back to polling where EventSource is missing.
+    closeEvents = subscribeEvents({
+      // Burn-after-read entries arrive without text; fetching them would count a read.
+      new: (entry) => {
+        if (entry?.max_reads) latest.value = entry
+        else loadLatest()
+      },
+      pinned: () => loadHistoryRef && loadHistoryRef(),
+      tagged: () => loadHistoryRef && loadHistoryRef(),
+      deleted: () => loadHistoryRef && loadHistoryRef(),
+    })
+    if (!closeEvents) latestTimer = setInterval(loadLatest, 3500)
   })
 
   onUnmounted(() => {
+    if (closeEvents) closeEvents()
     if (latestTimer) clearInterval(latestTimer)
     if (latestUpdatedTimeout) clearTimeout(latestUpdatedTimeout)
   })
@@ -140,6 +165,7 @@ export function useClipboard(showToast) {
     sending,
     sendStatus,
     sendError,
+    lifetime,
     latest,
     latestLoading,
     latestUpdated,
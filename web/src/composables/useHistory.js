@@ -1,15 +1,20 @@
-import { ref, computed, onMounted, onUnmounted } from 'vue'
-import { getHistory, setPin, deleteHistory } from '../api.js'
-import { highlightSearch } from '../utils/text.js'
+import { ref, computed, watch, onMounted, onUnmounted } from 'vue'
+import { getHistory, setPin, deleteHistory, getTags, updateTags } from '../api.js'
+import { highlightSearch, highlightSnippet } from '../utils/text.js'
 
 export function useHistory(showToast) {
   const historyItems = ref([])
   const historyLoading = ref(true)
+  const historyTotal = ref(0)
+  const nextCursor = ref('')
+  const loadingMore = ref(false)
   const searchQuery = ref('')
   const copyId = ref(null)
   const viewMode = ref('list')
   const sortBy = ref('recent')
   const limit = ref(80)
+  const tagFilter = ref('')
+  const tags = ref([])
   let copyTimeout = null
   let searchDebounceTimer = null
 
@@ -20,8 +25,29 @@ export function useHistory(showToast) {
     return list
   })
 
-  function highlightItem(text) {
-    return highlightSearch(text, searchQuery.value)
+  function highlightItem(item) {
+    if (item.snippet) return highlightSnippet(item.snippet)
+    return highlightSearch(item.text, searchQuery.value)
+  }
+
+  // "Most copied" and the tag filter are applied by the server; the other orders only rearrange the loaded page.
+  function serverFilters() {
+    const filters = sortBy.value === 'frequent' ? { sort: 'frequent' } : {}
+    if (tagFilter.value) filters.tag = tagFilter.value
+    return filters
+  }
+
+  watch(sortBy, (now, before) => {
+    if (now === 'frequent' || before === 'frequent') loadHistory()
+  })
+  watch(tagFilter, () => loadHistory())
+
+  async function loadTags() {
+    try {
+      tags.value = await getTags()
+    } catch {
+      tags.value = []
+    }
   }
 
   function debouncedSearch() {
@@ -32,15 +58,35 @@ export function useHistory(showToast) {
   async function loadHistory() {
     historyLoading.value = true
     try {
-      const items = await getHistory(limit.value, searchQuery.value)
-      historyItems.value = Array.isArray(items) ? items : []
+      const page = await getHistory(limit.value, searchQuery.value, '', serverFilters())
+      historyItems.value = Array.isArray(page?.items) ? page.items : []
+      historyTotal.value = page?.total ?? historyItems.value.length
+      nextCursor.value = page?.next_cursor || ''
+      loadTags()
     } catch {
       historyItems.value = []
+      historyTotal.value = 0
+      nextCursor.value = ''
     } finally {
       historyLoading.value = false
     }
   }
 
+  async function loadMore() {
+    if (!nextCursor.value || loadingMore.value) return
+    loadingMore.value = true
+    try {
+      const page = await getHistory(limit.value, searchQuery.value, nextCursor.value, serverFilters())
+      const seen = new Set(historyItems.value.map((i) => i.id))
+      historyItems.value = historyItems.value.concat((page?.items || []).filter((i) => !seen.has(i.id)))
+      nextCursor.value = page?.next_cursor || ''
+    } catch {
+      showToast('Could not load more history', 'error')
+    } finally {
+      loadingMore.value = false
+    }
+  }
+
   async function togglePin(item) {
     try {
       await setPin(item.id, !item.pinned)
@@ -51,6 +97,27 @@ export function useHistory(showToast) {
     }
   }
 
+  async function addTag(item, name) {
+    const tag = (name || '').trim()
+    if (!tag) return
+    try {
+      await updateTags(item.id, [tag], [])
+      await loadHistory()
+    } catch (e) {
+      showToast(e.message?.includes('invalid') ? 'Tags are letters, digits, - _ or .' : 'Tagging failed', 'error')
+    }
+  }
+
+  async function removeTag(item, name) {
+    try {
+      await updateTags(item.id, [], [name])
+      if (tagFilter.value === name) tagFilter.value = ''
+      else await loadHistory()
+    } catch {
+      showToast('Tagging failed', 'error')
+    }
+  }
+
   async function deleteItem(item) {
     try {
       await deleteHistory(item.id)
@@ -62,6 +129,10 @@ export function useHistory(showToast) {
   }
 
   async function copyItem(item, copyTextFn) {
+    if (item?.encrypted) {
+      showToast('Encrypted entry; copy it from a client with the passphrase', 'info')
+      return
+    }
     const text = item?.text || ''
     await copyTextFn(text)
     copyId.value = item.id
@@ -81,16 +152,24 @@ export function useHistory(showToast) {
   return {
     historyItems,
     historyLoading,
+    historyTotal,
+    nextCursor,
+    loadingMore,
     searchQuery,
     copyId,
     viewMode,
     sortBy,
     limit,
+    tagFilter,
+    tags,
     filteredItems,
     highlightItem,
     debouncedSearch,
     loadHistory,
+    loadMore,
     togglePin,
+    addTag,
+    removeTag,
     deleteItem,
     copyItem,
   }
@@ -1,34 +1,91 @@
-import { ref, onUnmounted } from 'vue'
-import { getLogs } from '../api.js'
+import { ref, reactive, computed, watch, onUnmounted } from 'vue'
+import { getLogs, logsExportUrl, replayLog } from '../api.js'
 import { formatLogTime, formatLogBody } from '../utils/format.js'
 
 export function useLogs(showToast) {
   const requestLogs = ref([])
   const logsLoading = ref(false)
+  const logsTotal = ref(0)
+  const nextCursor = ref('')
+  const loadingMore = ref(false)
   const selectedLogEntry = ref(null)
+  const filters = reactive({ method: '', status: '', q: '' })
+  const exportUrl = computed(() => logsExportUrl(filters))
+  const replayResult = ref(null)
+  const replaying = ref(false)
+  let searchDebounceTimer = null
+
+  watch(selectedLogEntry, () => { replayResult.value = null })
 
   async function loadLogs() {
     logsLoading.value = true
     try {
-      const list = await getLogs()
-      requestLogs.value = Array.isArray(list) ? list : []
+      const page = await getLogs('', filters)
+      requestLogs.value = Array.isArray(page?.items) ? page.items : []
+      logsTotal.value = page?.total ?? requestLogs.value.length
+      nextCursor.value = page?.next_cursor || ''
     } catch {
       requestLogs.value = []
+      logsTotal.value = 0
+      nextCursor.value = ''
       showToast('Failed to load logs', 'error')
     } finally {
       logsLoading.value = false
     }
   }
 
+  async function loadMore() {
+    if (!nextCursor.value || loadingMore.value) return
+    loadingMore.value = true
+    try {
+      const page = await getLogs(nextCursor.value, filters)
+      requestLogs.value = requestLogs.value.concat(page?.items || [])
+      nextCursor.value = page?.next_cursor || ''
+    } catch {
+      showToast('Could not load more logs', 'error')
+    } finally {
+      loadingMore.value = false
+    }
+  }
+
+  async function replay(entry) {
+    if (!entry || replaying.value) return
+    replaying.value = true
+    try {
+      replayResult.value = await replayLog(entry.id)
+    } catch (e) {
+      showToast(e.message || 'Replay failed', 'error')
+    } finally {
+      replaying.value = false
+    }
+  }
+
+  function setFilter(name, value) {
+    filters[name] = value
+    clearTimeout(searchDebounceTimer)
+    searchDebounceTimer = setTimeout(() => loadLogs(), name === 'q' ? 280 : 0)
+  }
+
   onUnmounted(() => {
+    clearTimeout(searchDebounceTimer)
     selectedLogEntry.value = null
   })
 
   return {
     requestLogs,
     logsLoading,
+    logsTotal,
+    nextCursor,
+    loadingMore,
     selectedLogEntry,
+    filters,
+    exportUrl,
+    replayResult,
+    replaying,
     loadLogs,
+    loadMore,
+    setFilter,
+    replay,
     formatLogTime,
     formatLogBody,
   }
@@ -61,3 +61,15 @@ export function formatLogBody(raw) {
   }
   return s
 }
+
+/** Human-readable byte size, e.g. 1536 -> "1.5 KB". */
+export function formatBytes(n) {
+  if (!n) return '0 B'
+  const units = ['B', 'KB', 'MB', 'GB']
+  let i = 0
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024
+    i++
+  }
+  return `${i === 0 ? n : n.toFixed(1)} ${units[i]}`
+}
@@ -27,6 +27,21 @@ export function highlightSearch(text, query, shortTextFn = shortText, escapeHtml
   return `${before}<mark class="search-highlight">${match}</mark>${after}`
 }
 
+/**
+ * Render a server search snippet as HTML: the text is escaped and matches
+ * (wrapped in \u0002 ... \u0003 by the server) become <mark> elements.
+ */
+export function highlightSnippet(snippet, escapeHtmlFn = escapeHtml) {
+  return snippet
+    .split('\u0002')
+    .map((part, i) => {
+      if (i === 0) return escapeHtmlFn(part.replace(/\u0003/g, ''))
+      const [match, ...rest] = part.split('\u0003')
+      return `<mark class="search-highlight">${escapeHtmlFn(match)}</mark>${escapeHtmlFn(rest.join(''))}`
+    })
+    .join('')
+}
+
 /** Normalize line endings for multi-line text (e.g. \r\n, \r, Unicode separators -> \n). */
 export function normalizeLineEndings(s) {
   if (typeof s !== 'string') return s